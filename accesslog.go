@@ -0,0 +1,124 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// fetchTimings are the phases of a download from an SBC.  Connecting and the
+// TLS handshake are 0 for downloads reusing a connection.
+type fetchTimings struct {
+	mu        sync.Mutex
+	status    int
+	connect   time.Duration
+	tls       time.Duration
+	firstByte time.Duration
+	parse     time.Duration
+}
+
+// trace returns request with its connecting, TLS handshake and time to the
+// first response byte recorded in t.
+func (t *fetchTimings) trace(request *http.Request) *http.Request {
+	start := time.Now()
+	var connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			connectStart = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			t.connect += time.Since(connectStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tls += time.Since(tlsStart)
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Since(start)
+			t.mu.Unlock()
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
+// logRequest logs a finished probe request or download at info level if
+// --log.requests is set, and at warn level if it took longer than
+// --log.slow-threshold.
+func logRequest(logger log.Logger, duration time.Duration, keyvals ...interface{}) {
+	keyvals = append(keyvals, "duration_seconds", duration.Seconds())
+	switch {
+	case *slowThreshold > 0 && duration > *slowThreshold:
+		level.Warn(logger).Log(append([]interface{}{"msg", "Slow request", "slow_threshold", *slowThreshold}, keyvals...)...)
+	case *logRequests:
+		level.Info(logger).Log(append([]interface{}{"msg", "Finished request"}, keyvals...)...)
+	}
+}
+
+// logFetch logs the download of path from the SBC with its phases.
+func logFetch(logger log.Logger, path string, t *fetchTimings, duration time.Duration, err error) {
+	t.mu.Lock()
+	keyvals := []interface{}{
+		"request", "fetch",
+		"path", path,
+		"status_code", t.status,
+		"connect_seconds", t.connect.Seconds(),
+		"tls_seconds", t.tls.Seconds(),
+		"first_byte_seconds", t.firstByte.Seconds(),
+		"parse_seconds", t.parse.Seconds(),
+	}
+	t.mu.Unlock()
+	if err != nil {
+		keyvals = append(keyvals, "err", err)
+	}
+	logRequest(logger, duration, keyvals...)
+}
+
+// statusRecorder records the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestLogFetchSlow(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<mysqldump><database name="stats"></database></mysqldump>`))
+	}))
+	defer server.Close()
+	defer func(threshold time.Duration) { *slowThreshold = threshold }(*slowThreshold)
+	*slowThreshold = time.Nanosecond
+
+	var logs bytes.Buffer
+	c := collector{target: server.URL, targetPath: targetPath, logger: log.NewLogfmtLogger(&logs), client: server.Client()}
+	var wg sync.WaitGroup
+	result := make(chan interface{}, 1)
+	wg.Add(1)
+	ScrapeTarget(c, "stats/realtime", result, &wg)
+	if err, ok := (<-result).(error); ok {
+		t.Fatal(err)
+	}
+	var line string
+	for _, l := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(l, `msg="Slow request"`) {
+			line = l
+		}
+	}
+	if line == "" {
+		t.Fatalf("Expected a slow request warning, received %q", logs.String())
+	}
+	for _, want := range []string{"level=warn", "request=fetch", "path=stats/realtime", "status_code=200", "connect_seconds=", "tls_seconds=", "first_byte_seconds=", "parse_seconds="} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected %s in %q", want, line)
+		}
+	}
+	if strings.Contains(line, "tls_seconds=0 ") {
+		t.Errorf("Expected the TLS handshake to be timed, received %q", line)
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	defer func(threshold time.Duration, requests bool) {
+		*slowThreshold, *logRequests = threshold, requests
+	}(*slowThreshold, *logRequests)
+	for _, tt := range []struct {
+		threshold time.Duration
+		requests  bool
+		want      string
+	}{
+		{0, false, ""},
+		{0, true, "level=info"},
+		{time.Second, true, "level=info"},
+		{time.Millisecond, false, "level=warn"},
+	} {
+		*slowThreshold, *logRequests = tt.threshold, tt.requests
+		var logs bytes.Buffer
+		logRequest(log.NewLogfmtLogger(&logs), 10*time.Millisecond, "request", "probe")
+		if tt.want == "" && logs.Len() > 0 || !strings.Contains(logs.String(), tt.want) {
+			t.Errorf("Expected %q with threshold %s and request logging %v, received %q", tt.want, tt.threshold, tt.requests, logs.String())
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"gopkg.in/yaml.v2"
+)
+
+// adminPrefix is the path the admin API manages targets under.
+const adminPrefix = "/api/v1/targets"
+
+// adminState is the state file of the admin API, holding the targets added
+// and the configured targets removed at runtime so they survive restarts.
+type adminState struct {
+	Targets map[string]*Target `yaml:"targets,omitempty"`
+	Removed []string           `yaml:"removed,omitempty"`
+}
+
+// adminTarget is the body of a request adding a target.
+type adminTarget struct {
+	Name   string `yaml:"name"`
+	Target `yaml:",inline"`
+}
+
+// admin serves the authenticated API that adds, removes and polls targets at
+// runtime, so provisioning automation can register new SBCs without a
+// restart, and reads their logs through.
+type admin struct {
+	targets   *runtimeTargets
+	token     string
+	stateFile string
+	logger    log.Logger
+
+	mu    sync.Mutex
+	state adminState
+}
+
+func newAdmin(targets *runtimeTargets, token string, logger log.Logger) *admin {
+	return &admin{
+		targets: targets,
+		token:   token,
+		logger:  logger,
+		state:   adminState{Targets: map[string]*Target{}},
+	}
+}
+
+// loadToken reads the bearer token of the admin API from filename.
+func loadToken(filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", filename)
+	}
+	return token, nil
+}
+
+// restore applies the targets added and removed at runtime recorded in the
+// state file, if there is one.
+func (a *admin) restore() error {
+	if a.stateFile == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(a.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := adminState{}
+	if err := yaml.UnmarshalStrict(content, &state); err != nil {
+		return err
+	}
+	if state.Targets == nil {
+		state.Targets = map[string]*Target{}
+	}
+	for _, name := range state.Removed {
+		a.targets.remove(name)
+	}
+	for name, t := range state.Targets {
+		if t == nil {
+			t = &Target{}
+			state.Targets[name] = t
+		}
+		if err := a.targets.add(name, t); err != nil {
+			return err
+		}
+	}
+	a.state = state
+	return nil
+}
+
+// save writes the state file.
+func (a *admin) save() error {
+	if a.stateFile == "" {
+		return nil
+	}
+	content, err := yaml.Marshal(a.state)
+	if err != nil {
+		return err
+	}
+	// The state holds the targets' passwords.
+	return writeFileAtomic(a.stateFile, content, 0600)
+}
+
+// writeFileAtomic writes content to filename through a temporary file, so a
+// crash never leaves it truncated.
+func writeFileAtomic(filename string, content []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// ServeHTTP implements http.Handler.
+func (a *admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		unauthorized(w)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, adminPrefix), "/")
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		a.list(w)
+	case path == "" && r.Method == http.MethodPost:
+		a.add(w, r)
+	case path != "" && !strings.Contains(path, "/") && r.Method == http.MethodDelete:
+		a.remove(w, path)
+	case isLogsPath(path) && r.Method == http.MethodGet:
+		name, file := splitLogsPath(path)
+		a.logs(w, name, file)
+	case strings.HasSuffix(path, "/poke") && r.Method == http.MethodPost:
+		a.poke(w, strings.TrimSuffix(path, "/poke"))
+	case strings.HasSuffix(path, "/scrape") && r.Method == http.MethodPost:
+		a.scrape(w, strings.TrimSuffix(path, "/scrape"))
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// authorized reports whether the request carries the admin token.
+func (a *admin) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// protect serves h only to requests carrying the admin token.
+func (a *admin) protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			unauthorized(w)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// unauthorized asks for the admin token.
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="sansay_exporter"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// list writes the names of the configured targets.
+func (a *admin) list(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Targets []string `json:"targets"`
+	}{a.targets.conf.TargetNames()})
+}
+
+// add adds or replaces the target of the request body, given as YAML or JSON
+// in the format of the configuration file's targets plus their name.
+func (a *admin) add(w http.ResponseWriter, r *http.Request) {
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := adminTarget{}
+	if err := yaml.UnmarshalStrict(content, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" || strings.Contains(body.Name, "/") {
+		http.Error(w, "'name' must be given and must not contain '/'", http.StatusBadRequest)
+		return
+	}
+	t := body.Target
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	existed := a.targets.conf.HasTarget(body.Name)
+	if err := a.targets.add(body.Name, &t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.state.Targets[body.Name] = &t
+	a.state.Removed = without(a.state.Removed, body.Name)
+	if err := a.save(); err != nil {
+		level.Error(a.logger).Log("msg", "Error saving admin state", "err", err)
+		http.Error(w, fmt.Sprintf("Error saving state: %s", err), http.StatusInternalServerError)
+		return
+	}
+	level.Info(a.logger).Log("msg", "Added target", "target", body.Name)
+	if existed {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// remove removes the named target.
+func (a *admin) remove(w http.ResponseWriter, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.targets.remove(name) {
+		http.Error(w, fmt.Sprintf("unknown target %q", name), http.StatusNotFound)
+		return
+	}
+	if _, ok := a.state.Targets[name]; ok {
+		delete(a.state.Targets, name)
+	} else {
+		// Keep the configured target removed across restarts.
+		a.state.Removed = append(without(a.state.Removed, name), name)
+		sort.Strings(a.state.Removed)
+	}
+	if err := a.save(); err != nil {
+		level.Error(a.logger).Log("msg", "Error saving admin state", "err", err)
+		http.Error(w, fmt.Sprintf("Error saving state: %s", err), http.StatusInternalServerError)
+		return
+	}
+	level.Info(a.logger).Log("msg", "Removed target", "target", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// poke polls the named target immediately.
+func (a *admin) poke(w http.ResponseWriter, name string) {
+	if !a.targets.conf.HasTarget(name) {
+		http.Error(w, fmt.Sprintf("unknown target %q", name), http.StatusNotFound)
+		return
+	}
+	if !a.targets.poller.poke(name) {
+		http.Error(w, fmt.Sprintf("target %q is not polled in the background by this exporter", name), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// scrape polls the named target immediately and writes the outcomes once the
+// polls are done, failing with 502 if any of them failed, so recovery after
+// maintenance can be confirmed without waiting for the next poll.
+func (a *admin) scrape(w http.ResponseWriter, name string) {
+	if !a.targets.conf.HasTarget(name) {
+		http.Error(w, fmt.Sprintf("unknown target %q", name), http.StatusNotFound)
+		return
+	}
+	records, busy, ok := a.targets.poller.refresh(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("target %q is not polled in the background by this exporter", name), http.StatusConflict)
+		return
+	}
+	status := http.StatusOK
+	for _, r := range records {
+		if r.Error != "" {
+			status = http.StatusBadGateway
+		}
+	}
+	level.Info(a.logger).Log("msg", "Polled target on request", "target", name, "polls", len(records), "in_progress", len(busy))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Target     string         `json:"target"`
+		Polls      []scrapeRecord `json:"polls"`
+		InProgress []string       `json:"in_progress,omitempty"`
+	}{name, records, busy})
+}
+
+// isLogsPath reports whether path, relative to adminPrefix, is that of a
+// target's logs, name/logs or name/logs/file.
+func isLogsPath(path string) bool {
+	i := strings.Index(path, "/")
+	if i < 0 {
+		return false
+	}
+	rest := path[i+1:]
+	return rest == "logs" || strings.HasPrefix(rest, "logs/")
+}
+
+// splitLogsPath returns the target and the file of a logs path, the file
+// empty for the list of logs.
+func splitLogsPath(path string) (string, string) {
+	i := strings.Index(path, "/")
+	return path[:i], strings.TrimPrefix(strings.TrimPrefix(path[i+1:], "logs"), "/")
+}
+
+// without returns names without name.
+func without(names []string, name string) []string {
+	var kept []string
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func adminRequest(a *admin, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminUnauthorized(t *testing.T) {
+	conf := &Config{}
+	a := newAdmin(newRuntimeTargets(conf, conf), "secret", log.NewNopLogger())
+	for _, auth := range []string{"", "Bearer wrong", "Basic c2VjcmV0"} {
+		r := httptest.NewRequest("GET", adminPrefix, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for authorization %q, received %d", auth, w.Code)
+		}
+	}
+}
+
+func TestAdminAddRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.yml")
+
+	conf := &Config{Targets: map[string]*Target{"sbc1": {}}}
+	a := newAdmin(newRuntimeTargets(conf, conf), "secret", log.NewNopLogger())
+	a.stateFile = stateFile
+
+	if w := adminRequest(a, "POST", adminPrefix, `{"name": "sbc2", "username": "api", "password": "pass"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 adding a target, received %d: %s", w.Code, w.Body)
+	}
+	if got := conf.Target("sbc2"); got.Username != "api" || got.Password != "pass" {
+		t.Errorf("Expected the added target's credentials, received %q/%q", got.Username, got.Password)
+	}
+	if w := adminRequest(a, "POST", adminPrefix, "name: sbc2\nusername: other\n"); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 replacing a target, received %d: %s", w.Code, w.Body)
+	}
+	if w := adminRequest(a, "POST", adminPrefix, "name: sbc3\nunknown: true\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown field, received %d", w.Code)
+	}
+	if w := adminRequest(a, "POST", adminPrefix, "username: api\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a name, received %d", w.Code)
+	}
+	if w := adminRequest(a, "DELETE", adminPrefix+"/sbc1", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 removing a target, received %d", w.Code)
+	}
+	if w := adminRequest(a, "DELETE", adminPrefix+"/sbc1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 removing an unknown target, received %d", w.Code)
+	}
+	w := adminRequest(a, "GET", adminPrefix, "")
+	if got := strings.TrimSpace(w.Body.String()); got != `{"targets":["sbc2"]}` {
+		t.Errorf("Expected the remaining targets, received %s", got)
+	}
+
+	// A restarted exporter restores the changes from the state file.
+	restarted := &Config{Targets: map[string]*Target{"sbc1": {}}}
+	b := newAdmin(newRuntimeTargets(restarted, restarted), "secret", log.NewNopLogger())
+	b.stateFile = stateFile
+	if err := b.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(restarted.TargetNames(), ","); got != "sbc2" {
+		t.Errorf("Expected the restored targets sbc2, received %s", got)
+	}
+	if got := restarted.Target("sbc2").Username; got != "other" {
+		t.Errorf("Expected the replaced target's username other, received %q", got)
+	}
+}
+
+func TestAdminShard(t *testing.T) {
+	conf := &Config{}
+	shard := conf.Shard(0, 2)
+	a := newAdmin(newRuntimeTargets(conf, shard), "secret", log.NewNopLogger())
+	a.targets.shardIndex, a.targets.shardCount = 0, 2
+	for _, name := range []string{"sbc1", "sbc2", "sbc3", "sbc4"} {
+		if w := adminRequest(a, "POST", adminPrefix, "name: "+name); w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 adding %s, received %d: %s", name, w.Code, w.Body)
+		}
+		if got, want := shard.HasTarget(name), targetShard(name, 2) == 0; got != want {
+			t.Errorf("Expected %s in the shard %t, received %t", name, want, got)
+		}
+	}
+	if got := len(conf.TargetNames()); got != 4 {
+		t.Errorf("Expected 4 targets, received %d", got)
+	}
+}
+
+func TestAdminPoke(t *testing.T) {
+	conf := &Config{Targets: map[string]*Target{"sbc1": {}}}
+	a := newAdmin(newRuntimeTargets(conf, conf), "secret", log.NewNopLogger())
+	if w := adminRequest(a, "POST", adminPrefix+"/sbc1/poke", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 poking without background polling, received %d", w.Code)
+	}
+	if w := adminRequest(a, "POST", adminPrefix+"/unknown/poke", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 poking an unknown target, received %d", w.Code)
+	}
+}
+
+func TestAdminScrape(t *testing.T) {
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "media_server"):
+			w.Write([]byte(`<XBMediaServerRealTimeStatList/>`))
+			return
+		case strings.HasSuffix(r.URL.Path, "download/resource"):
+			w.Write([]byte(`<XBResourceList/>`))
+			return
+		}
+		w.Write([]byte(`<mysqldump><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table></database></mysqldump>`))
+	}))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+
+	conf := &Config{Targets: map[string]*Target{target: {Protocol: "http"}}}
+	targets := newRuntimeTargets(conf, conf)
+	a := newAdmin(targets, "secret", log.NewNopLogger())
+	if w := adminRequest(a, "POST", adminPrefix+"/"+target+"/scrape", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 scraping without background polling, received %d", w.Code)
+	}
+	targets.poller = newPoller(conf, time.Hour, 1, log.NewNopLogger())
+	if w := adminRequest(a, "POST", adminPrefix+"/unknown/scrape", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 scraping an unknown target, received %d", w.Code)
+	}
+
+	w := adminRequest(a, "POST", adminPrefix+"/"+target+"/scrape", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 scraping a healthy target, received %d", w.Code)
+	}
+	var body struct {
+		Polls []scrapeRecord `json:"polls"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Polls) != 1 || body.Polls[0].Series == 0 {
+		t.Errorf("Expected the outcome of the poll, received %s", w.Body)
+	}
+	if cached, _ := targets.poller.result(target, ""); len(cached.(*pollResult).metrics) == 0 {
+		t.Error("Expected the scrape to store the poll's metrics")
+	}
+
+	healthy = false
+	if w := adminRequest(a, "POST", adminPrefix+"/"+target+"/scrape", ""); w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("Expected status 502 with the error scraping a failing target, received %d: %s", w.Code, w.Body)
+	}
+}
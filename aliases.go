@@ -0,0 +1,134 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// MetricAlias keeps serving a renamed metric under its old name during a
+// transition, so dashboards can move to the new name at their own pace.
+type MetricAlias struct {
+	// Name is the metric's current name.
+	Name string `yaml:"name"`
+	// Alias is the old name it is also served as.
+	Alias string `yaml:"alias"`
+	// Scale multiplies the values of counters, gauges and untyped metrics
+	// served under the old name, e.g. 100 for a percentage renamed to a
+	// ratio.  1 if not set.
+	Scale float64 `yaml:"scale,omitempty"`
+	// Until is the date, as YYYY-MM-DD, from which the old name is no
+	// longer served.  It is served indefinitely if not set.
+	Until string `yaml:"until,omitempty"`
+
+	until time.Time
+}
+
+// validate checks the alias and fills in the defaults.
+func (a *MetricAlias) validate() error {
+	if !model.IsValidMetricName(model.LabelValue(a.Name)) {
+		return fmt.Errorf("name: %q is not a valid metric name", a.Name)
+	}
+	if !model.IsValidMetricName(model.LabelValue(a.Alias)) {
+		return fmt.Errorf("alias: %q is not a valid metric name", a.Alias)
+	}
+	if a.Alias == a.Name {
+		return fmt.Errorf("alias: must differ from the name")
+	}
+	if a.Scale == 0 {
+		a.Scale = 1
+	}
+	if a.Until != "" {
+		until, err := time.Parse("2006-01-02", a.Until)
+		if err != nil {
+			return fmt.Errorf("until: %q is not a YYYY-MM-DD date", a.Until)
+		}
+		a.until = until
+	}
+	return nil
+}
+
+// active reports whether the old name is still served at now.
+func (a *MetricAlias) active(now time.Time) bool {
+	return a.until.IsZero() || now.Before(a.until)
+}
+
+// aliasGatherer adds the series of metrics with active aliases under their
+// old names.
+type aliasGatherer struct {
+	prometheus.Gatherer
+	aliases []*MetricAlias
+}
+
+// Gather implements prometheus.Gatherer.
+func (g aliasGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	now := time.Now()
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	byName := map[string][]*MetricAlias{}
+	for _, a := range g.aliases {
+		if a.active(now) {
+			byName[a.Name] = append(byName[a.Name], a)
+		}
+	}
+	result := families
+	for _, family := range families {
+		for _, a := range byName[family.GetName()] {
+			// A metric already served under the old name is left alone.
+			if names[a.Alias] {
+				continue
+			}
+			names[a.Alias] = true
+			result = append(result, aliasFamily(family, a))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, err
+}
+
+// aliasFamily returns a copy of family under the alias's old name.
+func aliasFamily(family *dto.MetricFamily, a *MetricAlias) *dto.MetricFamily {
+	name := a.Alias
+	help := fmt.Sprintf("Deprecated, use %s.", a.Name)
+	if a.Until != "" {
+		help = fmt.Sprintf("Deprecated, use %s, removed on %s.", a.Name, a.Until)
+	}
+	alias := &dto.MetricFamily{Name: &name, Help: &help, Type: family.Type}
+	for _, m := range family.Metric {
+		c := &dto.Metric{Label: m.Label, Summary: m.Summary, Histogram: m.Histogram, TimestampMs: m.TimestampMs}
+		if m.Counter != nil {
+			v := m.Counter.GetValue() * a.Scale
+			c.Counter = &dto.Counter{Value: &v, Exemplar: m.Counter.Exemplar}
+		}
+		if m.Gauge != nil {
+			v := m.Gauge.GetValue() * a.Scale
+			c.Gauge = &dto.Gauge{Value: &v}
+		}
+		if m.Untyped != nil {
+			v := m.Untyped.GetValue() * a.Scale
+			c.Untyped = &dto.Untyped{Value: &v}
+		}
+		alias.Metric = append(alias.Metric, c)
+	}
+	return alias
+}
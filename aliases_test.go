@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestAliasGatherer(t *testing.T) {
+	aliases := []*MetricAlias{
+		{Name: "sansay_mem_used_ratio", Alias: "sansay_mem_used_pct", Scale: 100},
+		{Name: "sansay_cps", Alias: "sansay_calls_per_second", Until: "2000-01-01"},
+		{Name: "sansay_cps", Alias: "sansay_trunk_groups"},
+	}
+	for _, a := range aliases {
+		if err := a.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_mem_used_ratio", "Memory used", []string{"node"}), prometheus.GaugeValue, 0.25, "1")
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_cps", "Calls per second", nil), prometheus.GaugeValue, 5)
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_trunk_groups", "Trunk groups", nil), prometheus.GaugeValue, 3)
+	}))
+	expected := `
+# TYPE sansay_cps gauge
+sansay_cps 5
+# TYPE sansay_mem_used_pct gauge
+sansay_mem_used_pct{node="1"} 25
+# TYPE sansay_mem_used_ratio gauge
+sansay_mem_used_ratio{node="1"} 0.25
+# TYPE sansay_trunk_groups gauge
+sansay_trunk_groups 3
+`
+	families, err := aliasGatherer{Gatherer: registry, aliases: aliases}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	for _, family := range families {
+		expfmt.MetricFamilyToText(&got, family)
+	}
+	if stripHelp(got.String()) != stripHelp(expected) {
+		t.Errorf("Unexpected metrics, want:\n%s\ngot:\n%s", expected, got.String())
+	}
+}
+
+func TestMetricAliasValidate(t *testing.T) {
+	for _, tt := range []struct {
+		alias   MetricAlias
+		wantErr bool
+	}{
+		{MetricAlias{Name: "sansay_a", Alias: "sansay_b", Until: "2030-06-30"}, false},
+		{MetricAlias{Name: "sansay_a", Alias: "sansay_a"}, true},
+		{MetricAlias{Name: "sansay_a", Alias: "sansay-b"}, true},
+		{MetricAlias{Name: "sansay_a", Alias: "sansay_b", Until: "30/06/2030"}, true},
+	} {
+		if err := tt.alias.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Expected error %v for %+v, received %v", tt.wantErr, tt.alias, err)
+		}
+	}
+	a := MetricAlias{Name: "sansay_a", Alias: "sansay_b", Until: "2030-06-30"}
+	a.validate()
+	if !a.active(time.Date(2030, 6, 29, 23, 0, 0, 0, time.UTC)) || a.active(time.Date(2030, 6, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected the alias to be served until the end of the day before until")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// anomalyTypes are the kinds of impossible values a trunk group row may
+// report.
+var anomalyTypes = []string{"negative", "over_limit", "cps_over_limit"}
+
+// trunkAnomaly returns why the values of a trunk group's Group row are
+// impossible, or "" if they are plausible: negative counts, more sessions
+// than its session limit, or more calls per second than its CPS limit.
+func trunkAnomaly(trunk Trunk) string {
+	values := map[string]float64{}
+	for _, metric := range realtimeMetrics {
+		value, err := getField(&trunk, metric)
+		if err != nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		if v < 0 {
+			return "negative"
+		}
+		values[metric] = v
+	}
+	if limit := values["TotalLimit"]; limit > 0 && values["NumOrig"]+values["NumTerm"] > limit {
+		return "over_limit"
+	}
+	if limit := values["CpsLimit"]; limit > 0 && values["Cps"] > limit {
+		return "cps_over_limit"
+	}
+	return ""
+}
+
+// anomalyCounter counts the trunk group rows of each target that were not
+// exported because their values were impossible.
+type anomalyCounter struct {
+	mu      sync.Mutex
+	targets map[string]map[string]float64
+}
+
+func newAnomalyCounter() *anomalyCounter {
+	return &anomalyCounter{targets: map[string]map[string]float64{}}
+}
+
+// counts returns the counts of the target, creating them.  The caller must
+// hold the lock.
+func (a *anomalyCounter) counts(target string) map[string]float64 {
+	counts, ok := a.targets[target]
+	if !ok {
+		counts = map[string]float64{}
+		a.targets[target] = counts
+	}
+	return counts
+}
+
+// add counts an anomaly of the target.
+func (a *anomalyCounter) add(target, anomaly string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts(target)[anomaly]++
+}
+
+// collect exports the anomaly counts of the target.
+func (a *anomalyCounter) collect(ch chan<- prometheus.Metric, target string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counts := a.counts(target)
+	for _, anomaly := range anomalyTypes {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_data_anomaly_total", "Trunk group rows not exported because their values were impossible.", []string{"type"}),
+			prometheus.CounterValue, counts[anomaly], anomaly)
+	}
+}
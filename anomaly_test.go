@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTrunkAnomaly(t *testing.T) {
+	tests := []struct {
+		name  string
+		trunk Trunk
+		want  string
+	}{
+		{"Test that plausible values are no anomaly", Trunk{NumOrig: "5", NumTerm: "5", Cps: "2", TotalLimit: "10", CpsLimit: "2"}, ""},
+		{"Test that missing limits are no anomaly", Trunk{NumOrig: "50", Cps: "20", TotalLimit: "0"}, ""},
+		{"Test that negative counts are an anomaly", Trunk{NumOrig: "-1", NumTerm: "5"}, "negative"},
+		{"Test that sessions over the limit are an anomaly", Trunk{NumOrig: "8", NumTerm: "3", TotalLimit: "10"}, "over_limit"},
+		{"Test that calls per second over the limit are an anomaly", Trunk{Cps: "250", CpsLimit: "10"}, "cps_over_limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trunkAnomaly(tt.trunk); got != tt.want {
+				t.Errorf("Expected %q, received %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAnomalousTrunksSkipped(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">ok</field><field name="fqdn">Group</field><field name="numOrig">1</field><field name="numTerm">1</field><field name="cps">1</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">10</field><field name="cpsLimit">5</field></row>
+<row><field name="trunkId">200</field><field name="alias">bogus</field><field name="fqdn">Group</field><field name="numOrig">-4294967295</field><field name="numTerm">1</field><field name="cps">1</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">10</field><field name="cpsLimit">5</field></row>
+</table>
+</database></mysqldump>`
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{target: "sbc1", logger: log.NewNopLogger(), anomalies: newAnomalyCounter()}
+	collect := func(ch chan<- prometheus.Metric) { c.processCollection(ch, sansay) }
+	expected := `
+# TYPE sansay_data_anomaly_total counter
+sansay_data_anomaly_total{type="cps_over_limit"} 0
+sansay_data_anomaly_total{type="negative"} 1
+sansay_data_anomaly_total{type="over_limit"} 0
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="ok",trunkgroup="100"} 1
+`
+	compareMetrics(t, collect, expected, "sansay_data_anomaly_total", "sansay_trunk_numorig")
+
+	// The counter keeps counting across scrapes.
+	expected = `
+# TYPE sansay_data_anomaly_total counter
+sansay_data_anomaly_total{type="cps_over_limit"} 0
+sansay_data_anomaly_total{type="negative"} 2
+sansay_data_anomaly_total{type="over_limit"} 0
+`
+	compareMetrics(t, collect, expected, "sansay_data_anomaly_total")
+}
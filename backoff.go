@@ -0,0 +1,117 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRetryAfter is the backoff when a rate-limited response doesn't
+	// say when to retry.
+	defaultRetryAfter = 30 * time.Second
+	// maxRetryAfter caps the backoff, so a bogus Retry-After doesn't stop a
+	// target being scraped for long.
+	maxRetryAfter = 15 * time.Minute
+)
+
+// throttledError is returned for a path the SBC asked to be retried later.
+// The path is skipped rather than failing the scrape.
+type throttledError struct {
+	path  string
+	until time.Time
+}
+
+func (e throttledError) Error() string {
+	return fmt.Sprintf("%s throttled by the target until %s", e.path, e.until.Format(time.RFC3339))
+}
+
+// retryAfter returns when a 429 or 503 response asks to be retried, and
+// whether the response is rate limiting.  A 503 without Retry-After is an
+// outage rather than rate limiting.
+func retryAfter(resp *http.Response, now time.Time) (time.Time, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return time.Time{}, false
+	}
+	delay := defaultRetryAfter
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		delay = t.Sub(now)
+	} else if resp.StatusCode == http.StatusServiceUnavailable {
+		return time.Time{}, false
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return now.Add(delay), true
+}
+
+// backoffTracker holds the targets that asked not to be downloaded from
+// until a later time.
+type backoffTracker struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newBackoffTracker() *backoffTracker {
+	return &backoffTracker{until: map[string]time.Time{}}
+}
+
+// backoff records that the target asked not to be downloaded from until
+// the given time.
+func (t *backoffTracker) backoff(target string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until.After(t.until[target]) {
+		t.until[target] = until
+	}
+}
+
+// active returns when the target's backoff ends, and whether it is still
+// backing off at now.
+func (t *backoffTracker) active(target string, now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.until[target]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !until.After(now) {
+		delete(t.until, target)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// count returns the number of targets backing off at now.
+func (t *backoffTracker) count(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, until := range t.until {
+		if until.After(now) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       time.Duration
+		throttled  bool
+	}{
+		{"seconds", http.StatusTooManyRequests, "120", 2 * time.Minute, true},
+		{"date", http.StatusServiceUnavailable, "Wed, 01 Jan 2020 00:01:00 GMT", time.Minute, true},
+		{"missing on 429", http.StatusTooManyRequests, "", defaultRetryAfter, true},
+		{"missing on 503", http.StatusServiceUnavailable, "", 0, false},
+		{"capped", http.StatusTooManyRequests, "86400", maxRetryAfter, true},
+		{"other status", http.StatusInternalServerError, "120", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			until, throttled := retryAfter(resp, now)
+			if throttled != tt.throttled {
+				t.Fatalf("Expected throttled %v, received %v", tt.throttled, throttled)
+			}
+			if throttled && until.Sub(now) != tt.want {
+				t.Errorf("Expected to retry after %s, received %s", tt.want, until.Sub(now))
+			}
+		})
+	}
+}
+
+func TestScrapeTargetThrottled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := collector{target: server.URL, targetPath: targetPath, logger: log.NewNopLogger(), client: &http.Client{}, backoff: newBackoffTracker()}
+	for i := 0; i < 2; i++ {
+		var wg sync.WaitGroup
+		result := make(chan interface{}, 1)
+		wg.Add(1)
+		ScrapeTarget(c, "stats/realtime", result, &wg)
+		if _, ok := (<-result).(throttledError); !ok {
+			t.Fatalf("Expected the path to be throttled")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected no requests during the backoff, received %d", requests)
+	}
+	if _, ok := c.backoff.active(server.URL, time.Now()); !ok {
+		t.Error("Expected the target to be backing off")
+	}
+	if _, ok := c.backoff.active(server.URL, time.Now().Add(time.Minute)); ok {
+		t.Error("Expected the backoff to end after Retry-After")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// benchResult is the cost of running a dump through the collector.
+type benchResult struct {
+	iterations int
+	bytes      int
+	parse      time.Duration
+	process    time.Duration
+	allocs     uint64
+	allocBytes uint64
+	series     int
+}
+
+// runBench parses the dump in file, as downloaded from path, and creates its
+// metrics the given number of times.
+func runBench(file, path string, iterations int) (benchResult, error) {
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return benchResult{}, err
+	}
+	if iterations < 1 {
+		iterations = 1
+	}
+	c := collector{logger: log.NewNopLogger()}
+	result := benchResult{iterations: iterations, bytes: len(body)}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		obj, err := parseSansay(path, body)
+		if err != nil {
+			return benchResult{}, err
+		}
+		parsed := time.Now()
+		result.parse += parsed.Sub(start)
+
+		ch := make(chan prometheus.Metric, 100)
+		go func() {
+			c.processResult(ch, obj)
+			close(ch)
+		}()
+		series := 0
+		for range ch {
+			series++
+		}
+		result.process += time.Since(parsed)
+		result.series = series
+	}
+	runtime.ReadMemStats(&after)
+	result.allocs = after.Mallocs - before.Mallocs
+	result.allocBytes = after.TotalAlloc - before.TotalAlloc
+	return result, nil
+}
+
+// print writes the per-iteration cost of the dump.
+func (r benchResult) print(w io.Writer) {
+	n := time.Duration(r.iterations)
+	parse := r.parse / n
+	fmt.Fprintf(w, "iterations:      %d\n", r.iterations)
+	fmt.Fprintf(w, "input:           %d bytes\n", r.bytes)
+	fmt.Fprintf(w, "series:          %d\n", r.series)
+	fmt.Fprintf(w, "parse:           %s/op (%.1f MB/s)\n", parse, float64(r.bytes)/parse.Seconds()/1e6)
+	fmt.Fprintf(w, "process:         %s/op\n", r.process/n)
+	fmt.Fprintf(w, "allocations:     %d/op\n", r.allocs/uint64(r.iterations))
+	fmt.Fprintf(w, "allocated bytes: %d/op\n", r.allocBytes/uint64(r.iterations))
+}
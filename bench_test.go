@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunBench(t *testing.T) {
+	result, err := runBench("testdata/golden/soap/stats_realtime.xml", "stats/realtime", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.iterations != 3 {
+		t.Errorf("Expected 3 iterations, received %d", result.iterations)
+	}
+	if result.series != 34 {
+		t.Errorf("Expected 34 series, received %d", result.series)
+	}
+	var out bytes.Buffer
+	result.print(&out)
+	if !strings.Contains(out.String(), "series:          34\n") {
+		t.Errorf("Expected the series count in the output, received:\n%s", out.String())
+	}
+
+	if _, err := runBench("testdata/golden/missing.xml", "stats/realtime", 1); err == nil {
+		t.Error("Expected an error for a missing dump")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultScrapeTimeout is used when Prometheus does not send its scrape
+// timeout with the request.
+const defaultScrapeTimeout = 10 * time.Second
+
+// minPathTimeout is the least share of the scrape timeout a path is given.
+const minPathTimeout = 100 * time.Millisecond
+
+// deadlineError is returned for a path whose download exceeded its share of
+// the scrape deadline.  The path is skipped rather than failing the scrape.
+type deadlineError struct {
+	path    string
+	timeout time.Duration
+}
+
+func (e deadlineError) Error() string {
+	return fmt.Sprintf("%s exceeded its scrape budget of %s", e.path, e.timeout)
+}
+
+// scrapeTimeout returns the time available for a scrape: the scrape timeout
+// Prometheus sends, slightly reduced by offset to allow for network delays.
+func scrapeTimeout(r *http.Request, offset float64) time.Duration {
+	timeout := defaultScrapeTimeout
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	if reduced := timeout - time.Duration(offset*float64(time.Second)); reduced > 0 {
+		timeout = reduced
+	}
+	return timeout
+}
+
+// pathTimeout returns the share of the scrape timeout the download of path
+// may take.  The paths are downloaded concurrently, so without a configured
+// budget every path may use the whole timeout; with one the timeout is split
+// by the configured weights (unlisted paths weigh 1).
+func (c collector) pathTimeout(path string, paths []string) time.Duration {
+	if c.timeout == 0 || len(c.budget) == 0 {
+		return c.timeout
+	}
+	weight := func(p string) float64 {
+		if w, ok := c.budget[p]; ok {
+			return w
+		}
+		return 1
+	}
+	var total float64
+	for _, p := range paths {
+		total += weight(p)
+	}
+	if total <= 0 {
+		return c.timeout
+	}
+	timeout := time.Duration(float64(c.timeout) * weight(path) / total)
+	// A zero timeout would disable the HTTP client's timeout altogether.
+	if timeout < minPathTimeout {
+		timeout = minPathTimeout
+		if c.timeout < timeout {
+			timeout = c.timeout
+		}
+	}
+	return timeout
+}
+
+// withTimeout returns a copy of the collector whose HTTP client gives up
+// after timeout.
+func (c collector) withTimeout(timeout time.Duration) collector {
+	client := &http.Client{}
+	if c.client != nil {
+		copied := *c.client
+		client = &copied
+	}
+	client.Timeout = timeout
+	c.client = client
+	return c
+}
+
+// isTimeout reports whether err is a network or client timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestScrapeTimeout(t *testing.T) {
+	r := httptest.NewRequest("GET", "/sansay?target=sbc", nil)
+	if got := scrapeTimeout(r, 0.5); got != 9500*time.Millisecond {
+		t.Errorf("Expected the default timeout less the offset, received %s", got)
+	}
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "30")
+	if got := scrapeTimeout(r, 0.5); got != 29500*time.Millisecond {
+		t.Errorf("Expected the Prometheus timeout less the offset, received %s", got)
+	}
+}
+
+func TestPathTimeout(t *testing.T) {
+	paths := []string{"stats/realtime", "stats/resource", "download/tcd"}
+	c := collector{timeout: 8 * time.Second}
+	if got := c.pathTimeout("download/tcd", paths); got != 8*time.Second {
+		t.Errorf("Expected the whole timeout without a budget, received %s", got)
+	}
+	c.budget = map[string]float64{"stats/realtime": 2}
+	if got := c.pathTimeout("stats/realtime", paths); got != 4*time.Second {
+		t.Errorf("Expected half the timeout for weight 2 of 4, received %s", got)
+	}
+	if got := c.pathTimeout("download/tcd", paths); got != 2*time.Second {
+		t.Errorf("Expected a quarter of the timeout for weight 1 of 4, received %s", got)
+	}
+	c.budget = map[string]float64{"stats/realtime": 1e6}
+	if got := c.pathTimeout("download/tcd", paths); got != minPathTimeout {
+		t.Errorf("Expected the minimum timeout for a negligible weight, received %s", got)
+	}
+	c.budget["download/tcd"] = 0
+	if got := c.pathTimeout("download/tcd", paths); got == 0 {
+		t.Error("Expected a timeout for a zero weight, received none")
+	}
+}
+
+func TestScrapeTargetDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	c := collector{target: server.URL, targetPath: targetPath, logger: log.NewNopLogger()}.withTimeout(20 * time.Millisecond)
+	result := make(chan interface{})
+	wg.Add(1)
+	go ScrapeTarget(c, "stats/realtime", result, &wg)
+	if _, ok := (<-result).(deadlineError); !ok {
+		t.Error("Expected a deadline error for a slow path")
+	}
+	wg.Wait()
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hourPeak is the highest sessions and calls per second seen within a clock
+// hour.
+type hourPeak struct {
+	sessions, cps float64
+}
+
+// busyHours is a target's peaks of the day, by clock hour.
+type busyHours struct {
+	day   string
+	hours map[int]*hourPeak
+}
+
+// busyHourTracker keeps the peak sessions and calls per second of each
+// target's trunk groups per clock hour of the current day, as capacity
+// planning sizes for the busy hour rather than for the average load.  It is
+// fed by background polls, whose regular schedule makes the peaks
+// comparable.
+type busyHourTracker struct {
+	mu      sync.Mutex
+	targets map[string]*busyHours
+}
+
+func newBusyHourTracker() *busyHourTracker {
+	return &busyHourTracker{targets: map[string]*busyHours{}}
+}
+
+// observe records the target's sessions and calls per second at now.  The
+// peaks are reset when the day changes.
+func (t *busyHourTracker) observe(target string, sessions, cps float64, now time.Time) {
+	if t == nil {
+		return
+	}
+	day := now.Format("2006-01-02")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hours, ok := t.targets[target]
+	if !ok || hours.day != day {
+		hours = &busyHours{day: day, hours: map[int]*hourPeak{}}
+		t.targets[target] = hours
+	}
+	peak, ok := hours.hours[now.Hour()]
+	if !ok {
+		peak = &hourPeak{sessions: sessions, cps: cps}
+		hours.hours[now.Hour()] = peak
+	}
+	if sessions > peak.sessions {
+		peak.sessions = sessions
+	}
+	if cps > peak.cps {
+		peak.cps = cps
+	}
+}
+
+// collect exports the target's peaks of each hour of the day so far, and the
+// busy hour, the hour with the most sessions at its peak.
+func (t *busyHourTracker) collect(ch chan<- prometheus.Metric, target string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hours, ok := t.targets[target]
+	if !ok {
+		return
+	}
+	busiest := -1
+	for hour := 0; hour < 24; hour++ {
+		peak, ok := hours.hours[hour]
+		if !ok {
+			continue
+		}
+		label := fmt.Sprintf("%02d", hour)
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_hour_sessions_peak", "Highest originating and terminating sessions of all trunk groups within the clock hour of the current day.", []string{"hour"}),
+			prometheus.GaugeValue, peak.sessions, label)
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_hour_cps_peak", "Highest calls per second of all trunk groups within the clock hour of the current day.", []string{"hour"}),
+			prometheus.GaugeValue, peak.cps, label)
+		if busiest < 0 || peak.sessions > hours.hours[busiest].sessions {
+			busiest = hour
+		}
+	}
+	if busiest >= 0 {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_busy_hour", "Clock hour of the current day with the highest sessions peak.", nil),
+			prometheus.GaugeValue, float64(busiest))
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBusyHourTracker(t *testing.T) {
+	tracker := newBusyHourTracker()
+	day := time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	tracker.observe("sbc1", 500, 20, day.Add(35*time.Minute))
+	tracker.observe("sbc1", 100, 30, day.Add(50*time.Minute))
+	tracker.observe("sbc1", 800, 10, day.Add(9*time.Hour+5*time.Minute))
+	tracker.observe("sbc1", 900, 12, day.Add(9*time.Hour+55*time.Minute))
+
+	collect := func(ch chan<- prometheus.Metric) {
+		tracker.collect(ch, "sbc1")
+	}
+	compareMetrics(t, collect, `
+# TYPE sansay_busy_hour gauge
+sansay_busy_hour 9
+# TYPE sansay_hour_cps_peak gauge
+sansay_hour_cps_peak{hour="00"} 30
+sansay_hour_cps_peak{hour="09"} 12
+# TYPE sansay_hour_sessions_peak gauge
+sansay_hour_sessions_peak{hour="00"} 500
+sansay_hour_sessions_peak{hour="09"} 900
+`, "sansay_busy_hour", "sansay_hour_cps_peak", "sansay_hour_sessions_peak")
+
+	// The peaks are reset on the next day.
+	tracker.observe("sbc1", 50, 1, day.Add(24*time.Hour+10*time.Minute))
+	compareMetrics(t, collect, `
+# TYPE sansay_busy_hour gauge
+sansay_busy_hour 0
+# TYPE sansay_hour_sessions_peak gauge
+sansay_hour_sessions_peak{hour="00"} 50
+`, "sansay_busy_hour", "sansay_hour_sessions_peak")
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// downloadCache shares the parsed downloads of a target between the scrapes
+// of a scrape cycle, so modules downloading the same path only download it
+// once.  A scrape needing a path another scrape is downloading waits for that
+// download instead of starting its own.
+type downloadCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[downloadKey]*download
+	// swept is when the expired entries were last deleted.
+	swept time.Time
+}
+
+// downloadKey identifies a download by the target, the credentials it was
+// made with, so a probe only gets the downloads made with its own, and the
+// path.
+type downloadKey struct {
+	target, credentials, path string
+}
+
+type download struct {
+	// done is closed once result is set.
+	done    chan struct{}
+	result  interface{}
+	fetched time.Time
+}
+
+func newDownloadCache(ttl time.Duration) *downloadCache {
+	return &downloadCache{ttl: ttl, entries: map[downloadKey]*download{}}
+}
+
+// cacheCredentials identifies the username and password a download is made
+// with, without keeping the password.
+func cacheCredentials(username, password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return username + ":" + hex.EncodeToString(sum[:])
+}
+
+// get returns the parsed download of the path, calling fetch unless another
+// scrape with the same credentials downloaded it within the cache's TTL or
+// is downloading it.  Failed downloads aren't kept.
+func (d *downloadCache) get(target, credentials, path string, fetch func() interface{}) interface{} {
+	if d == nil || d.ttl <= 0 {
+		return fetch()
+	}
+	key := downloadKey{target: target, credentials: credentials, path: path}
+	d.mu.Lock()
+	if now := time.Now(); now.Sub(d.swept) >= d.ttl {
+		d.sweep(now)
+	}
+	if entry, ok := d.entries[key]; ok {
+		select {
+		case <-entry.done:
+			if time.Since(entry.fetched) < d.ttl {
+				d.mu.Unlock()
+				return entry.result
+			}
+		default:
+			d.mu.Unlock()
+			<-entry.done
+			return entry.result
+		}
+	}
+	entry := &download{done: make(chan struct{})}
+	d.entries[key] = entry
+	d.mu.Unlock()
+
+	entry.result = fetch()
+	entry.fetched = time.Now()
+	close(entry.done)
+	if _, failed := entry.result.(error); failed {
+		d.mu.Lock()
+		if d.entries[key] == entry {
+			delete(d.entries, key)
+		}
+		d.mu.Unlock()
+	}
+	return entry.result
+}
+
+// sweep deletes the downloads that are older than the TTL at now, as every
+// probe may name its own target.  d.mu must be held.
+func (d *downloadCache) sweep(now time.Time) {
+	for key, entry := range d.entries {
+		select {
+		case <-entry.done:
+			if now.Sub(entry.fetched) >= d.ttl {
+				delete(d.entries, key)
+			}
+		default:
+		}
+	}
+	d.swept = now
+}
+
+// len returns the number of downloads cached or in progress.
+func (d *downloadCache) len() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
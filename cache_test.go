@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadCache(t *testing.T) {
+	cache := newDownloadCache(time.Minute)
+	fetches := 0
+	release := make(chan struct{})
+	fetch := func() interface{} {
+		fetches++
+		<-release
+		return Sansay{Path: "stats/realtime"}
+	}
+
+	// Concurrent scrapes share the one download in flight.
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results <- cache.get("sbc", "", "stats/realtime", fetch)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results <- cache.get("sbc", "", "stats/realtime", fetch)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+	for result := range results {
+		if _, ok := result.(Sansay); !ok {
+			t.Errorf("Expected the shared download, received %v", result)
+		}
+	}
+	cache.get("sbc", "", "stats/realtime", fetch)
+	if fetches != 1 {
+		t.Errorf("Expected one download, received %d", fetches)
+	}
+
+	// Failed downloads are retried.
+	failures := 0
+	fail := func() interface{} {
+		failures++
+		return errors.New("connection refused")
+	}
+	cache.get("sbc", "", "stats/resource", fail)
+	cache.get("sbc", "", "stats/resource", fail)
+	if failures != 2 {
+		t.Errorf("Expected failed downloads to be retried, received %d", failures)
+	}
+}
+
+func TestDownloadCacheDisabled(t *testing.T) {
+	var cache *downloadCache
+	fetches := 0
+	for i := 0; i < 2; i++ {
+		cache.get("sbc", "", "stats/realtime", func() interface{} {
+			fetches++
+			return Sansay{}
+		})
+	}
+	if fetches != 2 {
+		t.Errorf("Expected a download per scrape, received %d", fetches)
+	}
+}
+
+func TestDownloadCacheCredentials(t *testing.T) {
+	cache := newDownloadCache(time.Minute)
+	fetches := 0
+	fetch := func() interface{} {
+		fetches++
+		return Sansay{}
+	}
+	cache.get("sbc", cacheCredentials("admin", "secret"), "stats/realtime", fetch)
+	cache.get("sbc", cacheCredentials("admin", "wrong"), "stats/realtime", fetch)
+	cache.get("sbc", cacheCredentials("", ""), "stats/realtime", fetch)
+	if fetches != 3 {
+		t.Errorf("Expected a download per set of credentials, received %d", fetches)
+	}
+	cache.get("sbc", cacheCredentials("admin", "secret"), "stats/realtime", fetch)
+	if fetches != 3 {
+		t.Errorf("Expected the download with the same credentials to be shared, received %d", fetches)
+	}
+}
+
+func TestDownloadCacheSweep(t *testing.T) {
+	cache := newDownloadCache(time.Minute)
+	for _, target := range []string{"sbc1", "sbc2"} {
+		cache.get(target, "", "stats/realtime", func() interface{} { return Sansay{} })
+	}
+	for _, entry := range cache.entries {
+		entry.fetched = entry.fetched.Add(-2 * time.Minute)
+	}
+	cache.swept = time.Time{}
+	cache.get("sbc3", "", "stats/realtime", func() interface{} { return Sansay{} })
+	if got := cache.len(); got != 1 {
+		t.Errorf("Expected the expired downloads to be deleted, received %d entries", got)
+	}
+}
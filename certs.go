@@ -0,0 +1,92 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// certTracker remembers when the certificate each target's management
+// interface last presented expires.
+type certTracker struct {
+	mu       sync.Mutex
+	notAfter map[string]time.Time
+}
+
+func newCertTracker() *certTracker {
+	return &certTracker{notAfter: map[string]time.Time{}}
+}
+
+// observe records the certificate the host presented on a connection, or
+// forgets the host's certificate if it answered without TLS.
+func (t *certTracker) observe(host string, state *tls.ConnectionState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state == nil || len(state.PeerCertificates) == 0 {
+		delete(t.notAfter, host)
+		return
+	}
+	t.notAfter[host] = state.PeerCertificates[0].NotAfter
+}
+
+// expiry returns when the certificate the host last presented expires.
+func (t *certTracker) expiry(host string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	notAfter, ok := t.notAfter[host]
+	return notAfter, ok
+}
+
+// certRoundTripper records the certificates presented on the responses to
+// the requests it sends, whether or not they are trusted.
+type certRoundTripper struct {
+	certs *certTracker
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *certRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err == nil {
+		rt.certs.observe(req.URL.Host, resp.TLS)
+	}
+	return resp, err
+}
+
+// collectManagementCert exports when the certificate the target's management
+// interface presented during the scrape expires, so an expiring certificate
+// alerts before it breaks the web UI and the scrapes with verification.
+func (c collector) collectManagementCert(ch chan<- prometheus.Metric) {
+	if c.certs == nil {
+		return
+	}
+	u, err := url.Parse(c.target)
+	if err != nil {
+		return
+	}
+	notAfter, ok := c.certs.expiry(u.Host)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_management_cert_expiry_timestamp_seconds", "Time the certificate presented by the SBC's management interface expires.", nil),
+		prometheus.GaugeValue,
+		float64(notAfter.Unix()))
+}
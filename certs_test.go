@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagementCert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	certs := newCertTracker()
+	client := server.Client()
+	client.Transport = &certRoundTripper{certs: certs, next: client.Transport}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	c := collector{target: server.URL, certs: certs}
+	expected := fmt.Sprintf(`
+# TYPE sansay_management_cert_expiry_timestamp_seconds gauge
+sansay_management_cert_expiry_timestamp_seconds %g
+`, float64(server.Certificate().NotAfter.Unix()))
+	compareMetrics(t, c.collectManagementCert, expected, "sansay_management_cert_expiry_timestamp_seconds")
+
+	// A target answering without TLS no longer has a certificate.
+	certs.observe(server.Listener.Addr().String(), nil)
+	compareMetrics(t, c.collectManagementCert, "", "sansay_management_cert_expiry_timestamp_seconds")
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// newDecoder returns a decoder of body that also reads the non-UTF-8
+// encodings dumps are declared in.
+func newDecoder(body []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charsetReader
+	return d
+}
+
+// charsetReader converts input in the charset declared by an XML prolog to
+// UTF-8.  Some firmware writes dumps in ISO-8859-1, which trunk aliases with
+// accented characters then depend on.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1":
+		content, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(latin1ToUTF8(content)), nil
+	case "us-ascii", "ascii":
+		// A subset of UTF-8.
+		return input, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+// latin1ToUTF8 returns ISO-8859-1 encoded content in UTF-8, whose first 256
+// code points are those of ISO-8859-1.
+func latin1ToUTF8(content []byte) []byte {
+	out := make([]byte, 0, len(content)+len(content)/8)
+	for _, b := range content {
+		if b < utf8.RuneSelf {
+			out = append(out, b)
+			continue
+		}
+		out = append(out, string(rune(b))...)
+	}
+	return out
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestParseSansayLatin1(t *testing.T) {
+	body := append([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>`+
+		`<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">`+
+		`<row><field name="alias">Telef`), 0xf3)
+	body = append(body, []byte(`nica</field></row></table></database></mysqldump>`)...)
+	obj, err := parseSansay("stats/realtime", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := obj.(Sansay).Database.Table[0].Row[0].Fields()["alias"]; got != "Telefónica" {
+		t.Errorf("Expected the alias Telefónica, received %q", got)
+	}
+}
+
+func TestParseSansayUnsupportedCharset(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="EBCDIC"?><mysqldump/>`)
+	if _, err := parseSansay("stats/realtime", body); err == nil {
+		t.Error("Expected an error for an unsupported charset, received none")
+	}
+}
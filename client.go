@@ -0,0 +1,210 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/common/version"
+)
+
+// newHTTPClient builds the HTTP client used for both the REST and SOAP calls
+// to a target, honouring the target's dialer, resolve, source IP, TLS and
+// HTTP version settings.
+func newHTTPClient(t *Target) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig, err := newTLSConfig(t.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	transport.DialContext = targetDialContext(t, &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	switch {
+	case t.Dialer.UnixSocket != "":
+		transport.Proxy = nil
+	case t.Dialer.ProxyURL != "":
+		proxyURL, err := url.Parse(t.Dialer.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	switch t.HTTPVersion {
+	case "1.1":
+		// Some load balancers in front of SBCs negotiate h2 and then stall
+		// large downloads.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	case "2":
+		transport.ForceAttemptHTTP2 = true
+	}
+	return &http.Client{Transport: &headerRoundTripper{headers: t.Headers, next: transport}}, nil
+}
+
+// dialFunc dials a connection, as net.Dialer's DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// targetDialContext returns the function dialing connections to the target
+// with dialer: bound to its source IP, through its unix socket, or to its
+// resolve address.  A proxy_url is left to the caller.
+func targetDialContext(t *Target, dialer *net.Dialer) dialFunc {
+	if t.SourceIP != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(t.SourceIP)}
+	}
+	switch {
+	case t.Dialer.UnixSocket != "":
+		socket := t.Dialer.UnixSocket
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	case t.Resolve != "":
+		ip := t.Resolve
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		}
+	}
+	return dialer.DialContext
+}
+
+// headerRoundTripper sets the exporter's User-Agent and any configured extra
+// headers on outgoing requests.
+type headerRoundTripper struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", "sansay_exporter/"+version.Version)
+	for name, value := range rt.headers {
+		req.Header.Set(name, value)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// tlsVersions are the TLS versions a target's TLS settings may name.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCipherSuite is a cipher suite a target's TLS settings may name.
+type tlsCipherSuite struct {
+	id       uint16
+	insecure bool
+}
+
+// tlsCipherSuites are the cipher suites a target's TLS settings may name, by
+// their IANA names, marked insecure as by tls.InsecureCipherSuites, which
+// needs Go 1.14.
+var tlsCipherSuites = map[string]tlsCipherSuite{
+	"TLS_AES_128_GCM_SHA256":                        {tls.TLS_AES_128_GCM_SHA256, false},
+	"TLS_AES_256_GCM_SHA384":                        {tls.TLS_AES_256_GCM_SHA384, false},
+	"TLS_CHACHA20_POLY1305_SHA256":                  {tls.TLS_CHACHA20_POLY1305_SHA256, false},
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          {tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, false},
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          {tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, false},
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            {tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, false},
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            {tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, false},
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         {tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, false},
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       {tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, false},
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         {tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, false},
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       {tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, false},
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   {tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, false},
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": {tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, false},
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":          {tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, false},
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":        {tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, false},
+	"TLS_RSA_WITH_RC4_128_SHA":                      {tls.TLS_RSA_WITH_RC4_128_SHA, true},
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":                 {tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, true},
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  {tls.TLS_RSA_WITH_AES_128_CBC_SHA, true},
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  {tls.TLS_RSA_WITH_AES_256_CBC_SHA, true},
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":               {tls.TLS_RSA_WITH_AES_128_GCM_SHA256, true},
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":               {tls.TLS_RSA_WITH_AES_256_GCM_SHA384, true},
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":               {tls.TLS_RSA_WITH_AES_128_CBC_SHA256, true},
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":              {tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA, true},
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":                {tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA, true},
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":           {tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, true},
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256":       {tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, true},
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":         {tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256, true},
+}
+
+// newTLSConfig returns the TLS client configuration of a target.  Like the
+// exporter's other connections, certificates are not verified.
+func newTLSConfig(c TLSConfig) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: true}
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version %q", c.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if c.MaxVersion != "" {
+		version, ok := tlsVersions[c.MaxVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown max_version %q", c.MaxVersion)
+		}
+		config.MaxVersion = version
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, fmt.Errorf("min_version %s is above max_version %s", c.MinVersion, c.MaxVersion)
+	}
+	for _, name := range c.CipherSuites {
+		suite, _, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, suite.id)
+	}
+	return config, nil
+}
+
+// cipherSuite looks up a cipher suite by name, and reports whether it is
+// insecure.
+func cipherSuite(name string) (tlsCipherSuite, bool, bool) {
+	suite, ok := tlsCipherSuites[name]
+	return suite, suite.insecure, ok
+}
+
+// legacyTLS describes the insecure TLS versions and cipher suites the
+// settings allow, so they can be logged.
+func legacyTLS(c TLSConfig) []string {
+	var legacy []string
+	if version, ok := tlsVersions[c.MinVersion]; ok && version < tls.VersionTLS12 {
+		legacy = append(legacy, "TLS "+c.MinVersion)
+	}
+	for _, name := range c.CipherSuites {
+		if _, insecure, _ := cipherSuite(name); insecure {
+			legacy = append(legacy, name)
+		}
+	}
+	return legacy
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewHTTPClientUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "sbc.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client, err := newHTTPClient(&Target{Dialer: Dialer{UnixSocket: socket}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://sbc.example.com/SSConfig/webresources/stats/realtime")
+	if err != nil {
+		t.Fatalf("Expected request through unix socket, received %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("Expected body 'ok', received %q", body)
+	}
+}
+
+func TestNewHTTPClientResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := newHTTPClient(&Target{Resolve: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://sbc.invalid:" + port + "/")
+	if err != nil {
+		t.Fatalf("Expected request to the pinned address, received %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "sbc.invalid:"+port {
+		t.Errorf("Expected the original Host header, received %q", body)
+	}
+}
+
+func TestNewHTTPClientSourceIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(host))
+	}))
+	defer server.Close()
+
+	client, err := newHTTPClient(&Target{SourceIP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "127.0.0.1" {
+		t.Errorf("Expected connection from 127.0.0.1, received %q", body)
+	}
+}
+
+func TestNewHTTPClientHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+
+	client, err := newHTTPClient(&Target{Headers: map[string]string{"X-Waf-Token": "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := received.Get("User-Agent"); !strings.HasPrefix(got, "sansay_exporter/") {
+		t.Errorf("Expected sansay_exporter User-Agent, received %q", got)
+	}
+	if got := received.Get("X-Waf-Token"); got != "secret" {
+		t.Errorf("Expected X-Waf-Token header 'secret', received %q", got)
+	}
+}
+
+func TestNewHTTPClientHTTPVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for version, want := range map[string]string{"": "HTTP/2.0", "2": "HTTP/2.0", "1.1": "HTTP/1.1"} {
+		client, err := newHTTPClient(&Target{HTTPVersion: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("Expected http_version %q to use %s, received %s", version, want, body)
+		}
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	config, err := newTLSConfig(TLSConfig{MinVersion: "1.0", MaxVersion: "1.1", CipherSuites: []string{"TLS_RSA_WITH_AES_128_CBC_SHA", "TLS_RSA_WITH_3DES_EDE_CBC_SHA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS10 || config.MaxVersion != tls.VersionTLS11 {
+		t.Errorf("Expected TLS 1.0 to 1.1, received %x to %x", config.MinVersion, config.MaxVersion)
+	}
+	if len(config.CipherSuites) != 2 {
+		t.Errorf("Expected 2 cipher suites, received %d", len(config.CipherSuites))
+	}
+
+	for _, c := range []TLSConfig{{MinVersion: "1.4"}, {MinVersion: "1.2", MaxVersion: "1.0"}, {CipherSuites: []string{"TLS_NONE"}}} {
+		if _, err := newTLSConfig(c); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
+
+func TestLegacyTLS(t *testing.T) {
+	legacy := legacyTLS(TLSConfig{MinVersion: "1.0", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_3DES_EDE_CBC_SHA"}})
+	if strings.Join(legacy, ",") != "TLS 1.0,TLS_RSA_WITH_3DES_EDE_CBC_SHA" {
+		t.Errorf("Expected TLS 1.0 and 3DES to be reported, received %v", legacy)
+	}
+	if legacy := legacyTLS(TLSConfig{MinVersion: "1.2"}); len(legacy) != 0 {
+		t.Errorf("Expected nothing to be reported, received %v", legacy)
+	}
+}
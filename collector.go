@@ -14,11 +14,13 @@
 package main
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -30,8 +32,8 @@ import (
 
 	"github.com/magna5/sansay_exporter/models"
 
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/hooklift/gowsdl/soap"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -45,24 +47,60 @@ var realtimeMetrics = []string{"NumOrig",
 	"TotalLimit",
 	"CpsLimit"}
 
+// Reasons a response from the SBC is rejected.
+var (
+	errAuthFailed    = errors.New("authentication failed, check the username and password")
+	errHTMLResponse  = errors.New("received an HTML page instead of XML, check the credentials and target path")
+	errTruncatedBody = errors.New("response body is truncated")
+	errNotXML        = errors.New("response is not XML, content type")
+)
+
 type Sansay struct {
-	XMLName  xml.Name `xml:"mysqldump"`
-	Text     string   `xml:",chardata"`
-	Database struct {
-		Text  string `xml:",chardata"`
-		Name  string `xml:"name,attr"`
-		Table []struct {
-			Text string `xml:",chardata"`
-			Name string `xml:"name,attr"`
-			Row  []struct {
-				Text  string `xml:",chardata"`
-				Field []struct {
-					Text string `xml:",chardata"`
-					Name string `xml:"name,attr"`
-				} `xml:"field"`
-			} `xml:"row"`
-		} `xml:"table"`
+	XMLName   xml.Name `xml:"mysqldump"`
+	Text      string   `xml:",chardata"`
+	Timestamp string   `xml:"timestamp,attr"`
+	Database  struct {
+		Text      string  `xml:",chardata"`
+		Name      string  `xml:"name,attr"`
+		Timestamp string  `xml:"timestamp,attr"`
+		Table     []Table `xml:"table"`
 	} `xml:"database"`
+	// Path is the API path the dump was downloaded from.
+	Path string `xml:"-"`
+	// Partial is whether the dump was truncated and holds only the tables
+	// received in full.
+	Partial bool `xml:"-"`
+	// Fetched is when the dump was downloaded, which for a dump shared from
+	// the download cache is before the scrape.
+	Fetched time.Time `xml:"-"`
+}
+
+// Table is a single table of a Sansay stats dump.
+type Table struct {
+	Text string `xml:",chardata"`
+	Name string `xml:"name,attr"`
+	Row  []Row  `xml:"row"`
+}
+
+// Row is a single row of a Sansay stats table.
+type Row struct {
+	Text  string  `xml:",chardata"`
+	Field []Field `xml:"field"`
+}
+
+// Field is a single named value of a Sansay stats row.
+type Field struct {
+	Text string `xml:",chardata"`
+	Name string `xml:"name,attr"`
+}
+
+// Fields returns the row's values keyed by field name.
+func (r Row) Fields() map[string]string {
+	fields := make(map[string]string, len(r.Field))
+	for _, field := range r.Field {
+		fields[field.Name] = field.Text
+	}
+	return fields
 }
 
 type XBMediaServerRealTimeStatList struct {
@@ -128,6 +166,10 @@ type Trunk struct {
 	Hour_PDD              string
 	Day_PDD               string
 	Direction             string
+	Node                  string
+	// Type is whether the trunk group originates or terminates calls, or
+	// both, see trunkType.
+	Type string
 }
 type collector struct {
 	target     string
@@ -136,6 +178,76 @@ type collector struct {
 	password   string
 	logger     log.Logger
 	useSoap    bool
+	client     *http.Client
+	content    *contentTracker
+	intervals  *intervalTracker
+	tcd        *tcdTracker
+	timeout    time.Duration
+	budget     map[string]float64
+	backoff    *backoffTracker
+	// fallback are tried in order when the username and password are
+	// rejected.
+	fallback    []Credentials
+	credentials *credentialTracker
+	// intervalTimestamps exports the interval stats at the end of their
+	// interval.
+	intervalTimestamps bool
+	// paths are the paths downloaded, scrapePaths if empty.
+	paths     []string
+	downloads *downloadCache
+	// trunks zero-fills the provisioned trunk groups and those seen within
+	// trunkRetention that are missing from the realtime stats.
+	trunks         *trunkTracker
+	provisioned    []string
+	trunkRetention time.Duration
+	// utilization is the share of its session limit above which a trunk
+	// group counts as highly utilized, defaultUtilizationThreshold if 0.
+	utilization float64
+	// topTrunks limits the realtime trunk group series to the busiest
+	// topTrunks trunk groups by topTrunksBy, the rest are aggregated.
+	topTrunks   int
+	topTrunksBy string
+	// outcome counts the downloads processed and failed, if not nil.
+	outcome *scrapeOutcome
+	// timings records the phases of the download in progress, for the
+	// request log.
+	timings *fetchTimings
+	// customers maps trunk group IDs to customers, whose trunk groups'
+	// sessions and calls per second are totalled.
+	customers map[string]string
+	// anomalies counts the trunk group rows skipped for impossible values.
+	anomalies *anomalyCounter
+	// thresholds counts the crossings of the thresholdLevels by the trunk
+	// groups, if not nil.
+	thresholds      *thresholdTracker
+	thresholdLevels []float64
+	// busyHours keeps the hourly peaks of the trunk group totals, if not nil.
+	busyHours *busyHourTracker
+	// cps derives the trunk groups' call attempt rates, if not nil.
+	cps *cpsTracker
+	// sipTLS are the SIP-TLS addresses whose certificates are checked.
+	sipTLS []string
+	// sipTLSDial dials the SIP-TLS addresses as the target's other
+	// connections are, or directly if nil.
+	sipTLSDial dialFunc
+	// certs records the certificates of the management interface, if not
+	// nil.
+	certs *certTracker
+	// units are the device units of system_stat fields to convert to base
+	// units, by field name.
+	units map[string]string
+	// strict fails scrapes of dumps with unknown tables or fields, and stops
+	// exporting unknown system_stat fields as-is.
+	strict bool
+	// knownFields are further fields to accept as known.
+	knownFields map[string]bool
+	// unknownTables exports the numeric fields of unknown tables generically.
+	unknownTables bool
+	// nativePath is the path of the metrics the target serves in the
+	// Prometheus text format, merged with nativePrefix prepended to their
+	// names.
+	nativePath   string
+	nativePrefix string
 }
 
 func init() {
@@ -144,6 +256,9 @@ func init() {
 	}
 }
 
+// scrapePaths are downloaded on every scrape.
+var scrapePaths = []string{"stats/realtime", "stats/resource", "stats/media_server", "download/resource"}
+
 // Describe implements Prometheus.Collector.
 func (c collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- prometheus.NewDesc("dummy", "dummy", nil, nil)
@@ -151,32 +266,46 @@ func (c collector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect implements Prometheus.Collector.
 func (c collector) Collect(ch chan<- prometheus.Metric) {
-	paths := []string{"stats/realtime", "stats/resource", "stats/media_server", "download/resource"}
+	paths := append([]string(nil), scrapePaths...)
+	if len(c.paths) > 0 {
+		paths = append([]string(nil), c.paths...)
+	}
 	var wg sync.WaitGroup
 	var err error
 	start := time.Now()
+	intervalsDue := c.intervals != nil && c.intervals.due(c.target, start)
+	if intervalsDue {
+		paths = append(paths, intervalPath)
+	}
+	if c.tcd != nil {
+		paths = append(paths, tcdPath)
+	}
 	results := make(chan interface{})
 	defer close(results)
 	for _, path := range paths {
 		wg.Add(1)
-		go ScrapeTarget(c, path, results, &wg)
+		pc := c
+		if c.timeout > 0 {
+			pc = c.withTimeout(c.pathTimeout(path, paths))
+		}
+		go pc.download(path, results, &wg)
 	}
+	exceeded := map[string]bool{}
+	throttled := map[string]bool{}
 	for i := 0; i < len(paths); i++ {
 		result := <-results
 		switch obj := result.(type) {
-		case Sansay:
-			err = nil
-			c.processCollection(ch, obj)
-		case XBMediaServerRealTimeStatList:
+		case deadlineError:
 			err = nil
-			c.processMediaCollection(ch, obj)
-		case models.XBResourceList:
+			exceeded[obj.path] = true
+			level.Info(c.logger).Log("msg", "Skipping path", "err", obj)
+		case throttledError:
 			err = nil
-			c.processXBResourceList(ch, obj)
-		case error:
-			err = obj
+			throttled[obj.path] = true
+			level.Info(c.logger).Log("msg", "Skipping path", "err", obj)
 		default:
-			err = errors.New("Invalid type returned from target")
+			err = c.processResult(ch, obj)
+			c.outcome.record(err)
 		}
 		if err != nil {
 			level.Info(c.logger).Log("msg", "Error scraping target", "err", err)
@@ -184,13 +313,102 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 	wg.Wait()
+	if intervalsDue {
+		c.intervals.attempted(c.target, start)
+	}
+	if c.nativePath != "" {
+		c.collectNative(ch)
+	}
+	if len(c.sipTLS) > 0 {
+		c.collectSIPTLS(ch)
+	}
+	c.collectManagementCert(ch)
+	for _, path := range paths {
+		value := 0.0
+		if exceeded[path] {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_scrape_deadline_exceeded", "Whether the path was skipped for exceeding its share of the scrape deadline.", []string{"path"}),
+			prometheus.GaugeValue,
+			value, path)
+	}
+	if c.backoff != nil {
+		for _, path := range paths {
+			value := 0.0
+			if throttled[path] {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_scrape_throttled", "Whether the path was skipped because the target asked to be retried later.", []string{"path"}),
+				prometheus.GaugeValue,
+				value, path)
+		}
+		remaining := 0.0
+		if until, ok := c.backoff.active(c.target, time.Now()); ok {
+			remaining = time.Until(until).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_backoff_seconds", "Time left until the target may be downloaded from again.", nil),
+			prometheus.GaugeValue,
+			remaining)
+	}
+	if i, ok := c.credentials.index(c.target); ok && len(c.fallback) > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_credentials_index", "Index of the credentials the target accepted, 0 for the primary username and password and 1 for the first fallback.", nil),
+			prometheus.GaugeValue,
+			float64(i))
+	}
+	if c.intervals != nil {
+		c.intervals.collect(ch, c.target, c.intervalTimestamps)
+	}
+	if c.tcd != nil {
+		c.tcd.collect(ch, c.target)
+	}
+	if c.content != nil {
+		for _, path := range paths {
+			if unchanged, ok := c.content.unchanged(c.target, path); ok {
+				ch <- prometheus.MustNewConstMetric(
+					newDesc("sansay_scrape_content_unchanged_total", "Scrapes that returned a body identical to the previous scrape.", []string{"path"}),
+					prometheus.CounterValue,
+					unchanged, path)
+			}
+		}
+	}
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("sansay_scrape_duration_seconds", "Total sansay time scrape took (walk and processing).", nil, nil),
+		newDesc("sansay_scrape_duration_seconds", "Total sansay time scrape took (walk and processing).", nil),
 		prometheus.GaugeValue,
 		time.Since(start).Seconds())
 
 }
 
+// processResult creates the metrics for a download returned by ScrapeTarget.
+func (c collector) processResult(ch chan<- prometheus.Metric, result interface{}) error {
+	switch obj := result.(type) {
+	case Sansay:
+		c.processCollection(ch, obj)
+	case XBMediaServerRealTimeStatList:
+		c.processMediaCollection(ch, obj)
+	case models.XBResourceList:
+		c.processXBResourceList(ch, obj)
+	case error:
+		return obj
+	default:
+		return errors.New("Invalid type returned from target")
+	}
+	return nil
+}
+
+// processDump creates the metrics for a body downloaded from path, as a scrape
+// would.  It allows saved dumps to be run through the same pipeline.
+func (c collector) processDump(ch chan<- prometheus.Metric, path string, body []byte) error {
+	obj, err := parseSansay(path, body)
+	if err != nil {
+		return err
+	}
+	return c.processResult(ch, obj)
+}
+
 // processMediaCollection creates the metrics for the media server statistics.  The media server stats are
 // a totally different format than then other endpoints.
 func (c collector) processMediaCollection(ch chan<- prometheus.Metric, media XBMediaServerRealTimeStatList) {
@@ -214,32 +432,77 @@ func (c collector) processMediaCollection(ch chan<- prometheus.Metric, media XBM
 }
 
 // processXBResourceList creates the metrics for the resource configurations.
+// Every provisioned trunk group is exported as configured, including the
+// disabled and idle ones the realtime stats leave out.
 func (c collector) processXBResourceList(ch chan<- prometheus.Metric, resources models.XBResourceList) {
-	labels := []string{"trunkgroup", "alias"}
-	var labelValues []string
 	for _, resource := range resources.XBResource {
-		labelValues = []string{resource.TrunkId, resource.Name}
+		if resource.TrunkId != "" {
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_trunk_configured", "Trunk groups provisioned on the SBC, by their administrative state.", []string{"trunkgroup", "alias", "admin_state"}),
+				prometheus.GaugeValue,
+				1, resource.TrunkId, resource.Name, trunkAdminState(resource.TypeSIPgw.ServiceState))
+		}
+		labels := []string{"trunkgroup", "alias"}
+		labelValues := []string{resource.TrunkId, resource.Name}
+		if typ := trunkType(resource.TypeSIPgw.Direction); typ != "" {
+			labels = append(labels, "type")
+			labelValues = append(labelValues, typ)
+		}
 		addLabeledMetric(ch, "config_trunk_sessions_max", resource.Capacity, labels, labelValues)
 		addLabeledMetric(ch, "config_trunk_cps_max", resource.CpsLimit, labels, labelValues)
 	}
 }
 
 func (c collector) processCollection(ch chan<- prometheus.Metric, sansay Sansay) {
+	c.processStatsTimestamp(ch, sansay)
+	c.collectParseStats(ch, sansay)
+	var alarms []Table
 	for _, table := range sansay.Database.Table {
+		c.checkSchema(ch, table)
 		var direction string
 		switch table.Name {
 		case "system_stat":
 			for _, row := range table.Row {
+				// Clustered deployments report one row per node.
+				var labels, labelValues []string
+				if node := nodeLabel(row.Fields()); node != "" {
+					labels, labelValues = []string{"node"}, []string{node}
+				}
 				for _, field := range row.Field {
+					if handle, ok := systemFieldHandlers[field.Name]; ok {
+						handle(ch, field.Text, labels, labelValues)
+						continue
+					}
+					if isNodeField(field.Name) {
+						continue
+					}
+					if c.strict && !isKnownSystemField(field.Name) && !c.knownFields[field.Name] {
+						// Not exported until the exporter learns of it.
+						continue
+					}
 					switch field.Name {
 					case "ha_pre_state":
-					case "ha_current_state":
 					default:
-						addMetric(ch, field.Name, field.Text)
+						name, value := normalizeUnit(field.Name, field.Text, c.units[field.Name])
+						addLabeledMetric(ch, name, value, labels, labelValues)
 					}
 				}
 			}
 		case "XBResourceRealTimeStatList":
+			rollups := trunkRollups{}
+			summary := trunkSummary{utilization: c.utilization}
+			customers := customerTotals{customers: c.customers}
+			var groups, skipped []Trunk
+			var rows []realtimeGroup
+			now := time.Now()
+			rates := map[string]float64{}
+			// Rates are derived between downloads, not between scrapes
+			// sharing a cached download.
+			fetched := sansay.Fetched
+			if fetched.IsZero() {
+				fetched = now
+			}
+			peers := map[string]bool{}
 			for _, row := range table.Row {
 				trunk := Trunk{}
 				for _, field := range row.Field {
@@ -248,13 +511,67 @@ func (c collector) processCollection(ch chan<- prometheus.Metric, sansay Sansay)
 						ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
 					}
 				}
+				fields := row.Fields()
+				trunk.Node = nodeLabel(fields)
+				trunk.Type = trunkType(firstField(fields, trunkTypeFields...))
+				// The direction label is for the resource tables, a realtime
+				// row's direction is its type.
+				trunk.Direction = ""
 				if trunk.Fqdn == "Group" {
-					err := addTrunkMetrics(ch, trunk, realtimeMetrics)
-					if err != nil {
-						ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+					if anomaly := trunkAnomaly(trunk); anomaly != "" {
+						// Impossible values would wreck dashboards.
+						level.Debug(c.logger).Log("msg", "Skipping trunk group with impossible values", "trunkgroup", trunk.TrunkId, "type", anomaly)
+						c.anomalies.add(c.target, anomaly)
+						skipped = append(skipped, trunk)
+						continue
 					}
+					rows = append(rows, realtimeGroup{trunk: trunk, fields: fields})
+					groups = append(groups, trunk)
+					summary.add(trunk)
+					customers.add(trunk)
+					c.thresholds.observe(c.target, trunk, c.thresholdLevels, now)
+					if rate, ok := c.cps.observe(c.target, trunk, fields, fetched); ok {
+						rates[trunkKey(trunk)] = rate
+					}
+					addParentMetric(ch, trunk, fields)
+				}
+				addPeerMetrics(ch, trunk, fields, peers)
+				rollups.add(trunk)
+			}
+			top, others := topTrunks(rows, c.topTrunks, c.topTrunksBy)
+			for _, row := range top {
+				err := addTrunkMetrics(ch, row.trunk, realtimeMetrics)
+				if err != nil {
+					ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+				}
+				addTrunkFields(ch, row.trunk, row.fields, trunkRejections)
+				addTrunkFields(ch, row.trunk, row.fields, trunkAttempts)
+				if rate, ok := rates[trunkKey(row.trunk)]; ok {
+					addDerivedCPS(ch, row.trunk, rate)
+				}
+			}
+			for _, other := range others {
+				err := addTrunkMetrics(ch, other, realtimeMetrics)
+				if err != nil {
+					ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
 				}
 			}
+			if others != nil {
+				ch <- prometheus.MustNewConstMetric(
+					newDesc("sansay_trunk_groups_aggregated", "Trunk groups outside the top N exported as the \"other\" trunk group.", nil),
+					prometheus.GaugeValue, float64(len(rows)-len(top)))
+			}
+			rollups.collect(ch)
+			summary.collect(ch)
+			c.busyHours.observe(c.target, summary.sessions, summary.cps, now)
+			c.busyHours.collect(ch, c.target)
+			customers.collect(ch)
+			c.anomalies.collect(ch, c.target)
+			c.thresholds.collect(ch, c.target)
+			// Zero-filled trunk groups would be outside the top N.
+			if c.trunks != nil && c.topTrunks == 0 {
+				c.trunks.fill(ch, c.target, groups, skipped, c.provisioned, c.trunkRetention, now)
+			}
 			// Resource tables
 		case "ingress_stat":
 			direction = "ingress"
@@ -279,64 +596,169 @@ func (c collector) processCollection(ch chan<- prometheus.Metric, sansay Sansay)
 						ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
 					}
 				}
+				trunk.Node = nodeLabel(row.Fields())
 				err := addTrunkMetrics(ch, trunk, resourceMetrics)
 				if err != nil {
 					ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
 				}
 			}
+		case "alarm", "alarm_stat", "active_alarm":
+			alarms = append(alarms, table)
+		case "response_code_stat", "sip_response_stat", "XBResourceResponseCodeStatList":
+			c.processResponseCodeTable(ch, table)
+		case "media_quality_stat", "qos_stat", "XBResourceMediaQualityStatList":
+			c.processQualityTable(ch, table)
+		case "transcoding_stat", "dsp_stat", "XBTranscodingStatList":
+			c.processTranscodingTable(ch, table)
+		case "rtp_port_stat", "media_port_stat", "port_stat":
+			c.processRTPPortTable(ch, table)
+		case "blacklist", "dynamic_blacklist", "dyn_blacklist":
+			c.processBlacklistTable(ch, table)
+		case "emergency_stat", "e911_stat":
+			c.processStatTable(ch, table, emergencyFields)
+		case "radius_stat", "acct_server_stat", "billing_server_stat":
+			c.processAccountingServerTable(ch, table)
+		case "dns_stat", "dns_resolver_stat":
+			c.processStatTable(ch, table, dnsFields)
+		case "interval_stat", "XBResourceIntervalStatList":
+			if c.intervals != nil {
+				c.intervals.record(c.target, table)
+			}
+		case "tcd", "tcd_record":
+			if c.tcd != nil {
+				c.tcd.record(c.target, table)
+			}
+		default:
+			if c.unknownTables {
+				c.processGenericTable(ch, table)
+			}
 		}
 	}
+	if len(alarms) > 0 {
+		c.processAlarmTables(ch, alarms)
+	}
+}
+
+// download sends the parsed download of path to result, shared with the
+// other scrapes of the target through the download cache.
+func (c collector) download(path string, result chan<- interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	result <- c.downloads.get(c.target, cacheCredentials(c.username, c.password), path, func() interface{} {
+		var inner sync.WaitGroup
+		single := make(chan interface{}, 1)
+		inner.Add(1)
+		ScrapeTarget(c, path, single, &inner)
+		return <-single
+	})
 }
 
 // ScrapeTarget scrapes the Sansay API
 func ScrapeTarget(c collector, path string, result chan<- interface{}, wg *sync.WaitGroup) {
 	logger := c.logger
-	var obj interface{}
-	var sansay Sansay
-	var media XBMediaServerRealTimeStatList
-	var resourceList models.XBResourceList
 	var body []byte
 	var err error
 
-	if c.useSoap {
-		body, err = callSoapAPI(c, path)
-		if err != nil {
-			result <- err
+	// The body is only needed until it is unmarshalled, which copies out
+	// everything it keeps.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if c.backoff != nil {
+		if until, ok := c.backoff.active(c.target, time.Now()); ok {
+			result <- throttledError{path: path, until: until}
 			wg.Done()
 			return
 		}
+	}
+	start := time.Now()
+	timings := &fetchTimings{}
+	c.timings = timings
+	defer func() { logFetch(logger, path, timings, time.Since(start), err) }()
+	if c.useSoap {
+		body, err = callSoapAPI(c, path)
 	} else {
-		body, err = callRestAPI(c, path)
-		if err != nil {
-			result <- err
-			wg.Done()
-			return
+		body, err = callRestAPI(c, path, buf)
+	}
+	fetched := time.Now()
+	if errors.Is(err, errTruncatedBody) && body != nil {
+		// Parsing what was received salvages its complete tables.
+		err = nil
+	}
+	if err != nil {
+		if isTimeout(err) && c.client != nil && c.client.Timeout > 0 {
+			err = deadlineError{path: path, timeout: c.client.Timeout}
 		}
+		var throttled throttledError
+		if errors.As(err, &throttled) && c.backoff != nil {
+			c.backoff.backoff(c.target, throttled.until)
+			err = throttled
+		}
+		result <- err
+		wg.Done()
+		return
 	}
-	if strings.HasSuffix(path, "media_server") {
-		err = xml.Unmarshal(body, &media)
-		obj = media
-	} else if strings.HasSuffix(path, "download/resource") {
-		err = xml.Unmarshal(body, &resourceList)
-		obj = resourceList
-	} else {
-		err = xml.Unmarshal(body, &sansay)
-		obj = sansay
+	if c.content != nil {
+		c.content.observe(c.target, path, body)
 	}
+	parseStart := time.Now()
+	obj, err := parseSansay(path, body)
+	timings.mu.Lock()
+	timings.parse = time.Since(parseStart)
+	timings.mu.Unlock()
 	if err != nil {
 		level.Error(logger).Log("msg", "Error parsing XML", "path", path, "err", err)
 		result <- err
 		wg.Done()
 		return
 	}
+	if sansay, ok := obj.(Sansay); ok {
+		if sansay.Partial {
+			level.Warn(logger).Log("msg", "Truncated response, exporting the tables received in full", "path", path, "tables", len(sansay.Database.Table))
+		}
+		sansay.Fetched = fetched
+		obj = sansay
+	}
 	result <- obj
 	wg.Done()
 	return
 }
 
-func callRestAPI(c collector, path string) ([]byte, error) {
-	username := c.username
-	password := c.password
+// parseSansay unmarshals the body downloaded from path into the type the
+// path returns.
+func parseSansay(path string, body []byte) (interface{}, error) {
+	if strings.HasSuffix(path, "media_server") {
+		var media XBMediaServerRealTimeStatList
+		if err := unmarshalDump(body, &media); err != nil {
+			return nil, parseError(body, err)
+		}
+		return media, nil
+	}
+	if strings.HasSuffix(path, "download/resource") {
+		var resourceList models.XBResourceList
+		if err := unmarshalDump(body, &resourceList); err != nil {
+			return nil, parseError(body, err)
+		}
+		return resourceList, nil
+	}
+	var sansay Sansay
+	if err := unmarshalDump(body, &sansay); err != nil {
+		err = parseError(body, err)
+		salvaged, ok := salvageDump(body)
+		if !errors.Is(err, errTruncatedBody) || !ok {
+			return nil, err
+		}
+		sansay = salvaged
+		sansay.Partial = true
+	}
+	if err := validateDump(body, sansay); err != nil {
+		return nil, err
+	}
+	sansay.Path = path
+	return sansay, nil
+}
+
+// callRestAPI downloads path from the REST API.  The body is read into buf,
+// unless the SBC has no REST API and the SOAP API is used instead.
+func callRestAPI(c collector, path string, buf *bytes.Buffer) ([]byte, error) {
 	logger := c.logger
 	target := fmt.Sprintf("%s%s%s", c.target, c.targetPath, path)
 	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
@@ -348,42 +770,154 @@ func callRestAPI(c collector, path string) ([]byte, error) {
 		level.Error(logger).Log("msg", "Could not parse target URL", "err", err)
 		return nil, err
 	}
-	client := &http.Client{}
-	request, err := http.NewRequest("GET", target, http.NoBody)
+	resp, err := getWithCredentials(c, target, "")
 	if err != nil {
-		level.Error(logger).Log("msg", "Error creating HTTP request", "err", err)
 		return nil, err
 	}
-
-	request.SetBasicAuth(username, password)
-	resp, err := client.Do(request)
-
-	if err != nil {
-		level.Error(logger).Log("msg", "Error for HTTP request", "err", err)
-		return nil, err
-	}
-	level.Info(logger).Log("msg", "Received HTTP response", "status_code", resp.StatusCode)
 	if resp.StatusCode == 404 {
 		resp.Body.Close()
 		return callSoapAPI(c, path)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: HTTP %d", errAuthFailed, resp.StatusCode)
+	}
+	if until, ok := retryAfter(resp, time.Now()); ok {
+		return nil, throttledError{path: path, until: until}
+	}
 	if resp.StatusCode > 300 {
 		err = fmt.Errorf("Invalid response from server: %d", resp.StatusCode)
 		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	if resp.ContentLength > 0 && resp.ContentLength <= maxPooledBuffer {
+		buf.Grow(int(resp.ContentLength) + bytes.MinRead)
+	}
+	_, err = buf.ReadFrom(resp.Body)
+	body := buf.Bytes()
 	if err != nil {
 		level.Info(logger).Log("msg", "Failed to read HTTP response body", "err", err)
+		if err == io.ErrUnexpectedEOF {
+			// What was received is returned along with the error, its
+			// complete tables may still be salvaged.
+			return body, fmt.Errorf("%w: %s", errTruncatedBody, err)
+		}
 		return nil, err
 	}
-	if err != nil {
+	if err := validateXMLResponse(resp.Header.Get("Content-Type"), body); err != nil {
 		return nil, err
 	}
 	return body, nil
 }
 
+// getWithCredentials requests target with the collector's credentials,
+// trying the next whenever they are rejected, starting from those the target
+// last accepted.  accept is the Accept header sent, if not empty.
+func getWithCredentials(c collector, target, accept string) (*http.Response, error) {
+	logger := c.logger
+	client := c.client
+	if client == nil {
+		client = &http.Client{}
+	}
+	credentials := c.credentialList()
+	order := c.credentials.order(c.target, len(credentials))
+	var resp *http.Response
+	for n, i := range order {
+		request, err := http.NewRequest("GET", target, http.NoBody)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error creating HTTP request", "err", err)
+			return nil, err
+		}
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+
+		if c.timings != nil {
+			request = c.timings.trace(request)
+		}
+
+		request.SetBasicAuth(credentials[i].Username, credentials[i].Password)
+		resp, err = client.Do(request)
+
+		if err != nil {
+			level.Error(logger).Log("msg", "Error for HTTP request", "err", err)
+			return nil, err
+		}
+		level.Info(logger).Log("msg", "Received HTTP response", "status_code", resp.StatusCode)
+		if c.timings != nil {
+			c.timings.mu.Lock()
+			c.timings.status = resp.StatusCode
+			c.timings.mu.Unlock()
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			c.credentials.accepted(c.target, i)
+			break
+		}
+		if n < len(order)-1 {
+			level.Info(logger).Log("msg", "Credentials rejected, trying the next", "username", credentials[i].Username)
+			resp.Body.Close()
+		}
+	}
+	return resp, nil
+}
+
+// maxPooledBuffer is the largest response buffer kept for reuse, so that one
+// unusually large download doesn't pin its memory.
+const maxPooledBuffer = 8 << 20
+
+// bodyPool holds the buffers response bodies are read into.  A scrape reads
+// several bodies of similar size, so reusing buffers saves growing a new one
+// for each download.
+var bodyPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bodyPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bodyPool.Put(buf)
+}
+
+// validateXMLResponse checks that a response body looks like an XML document
+// before it is unmarshalled, so that login pages and other unexpected content
+// are reported as such rather than as XML syntax errors.
+func validateXMLResponse(contentType string, body []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return fmt.Errorf("%w: empty response", errTruncatedBody)
+	}
+	prefix := trimmed
+	if len(prefix) > 64 {
+		prefix = prefix[:64]
+	}
+	lower := bytes.ToLower(prefix)
+	if mediaType == "text/html" || bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")) {
+		return errHTMLResponse
+	}
+	if trimmed[0] != '<' {
+		return fmt.Errorf("%w %q", errNotXML, mediaType)
+	}
+	return nil
+}
+
+// parseError locates an error returned by xml.Unmarshal in body, and
+// classifies it.
+func parseError(body []byte, err error) error {
+	err = locateXMLError(body, err)
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF" {
+		return fmt.Errorf("%w: %s", errTruncatedBody, err)
+	}
+	return err
+}
+
 // callSoapAPI makes a SOAP call to the Sansay SBC -- used for older OS versions
 func callSoapAPI(c collector, path string) ([]byte, error) {
 	var err error
@@ -402,17 +936,22 @@ func callSoapAPI(c collector, path string) ([]byte, error) {
 	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
 		target = "http://" + target
 	}
-	client := soap.NewClient(target, soap.WithTLS(&tls.Config{InsecureSkipVerify: true}))
+	opt := soap.WithTLS(&tls.Config{InsecureSkipVerify: true})
+	if c.client != nil {
+		opt = soap.WithHTTPClient(c.client)
+	}
+	client := soap.NewClient(target, opt)
 	service := NewSansayWS(client)
-	if strings.HasSuffix(path, "download/resource") {
+	if strings.HasPrefix(path, "download/") {
 		params := &DownloadParams{
 			Username: c.username,
 			Password: c.password,
 			Page:     0,
-			Table:    "resource",
+			Table:    statName,
 		}
 
-		if reply, err := service.DoDownloadXmlFile(params); err == nil {
+		var reply *DownloadResult
+		if reply, err = service.DoDownloadXmlFile(params); err == nil {
 			response = []byte(reply.Xmlfile)
 		}
 	} else {
@@ -421,7 +960,8 @@ func callSoapAPI(c collector, path string) ([]byte, error) {
 			Password: c.password,
 			StatName: statName,
 		}
-		if reply, err := service.DoRealTimeStats(params); err == nil {
+		var reply *RealTimeStatsResult
+		if reply, err = service.DoRealTimeStats(params); err == nil {
 			response = []byte(reply.Xmlfile)
 		}
 	}
@@ -438,10 +978,15 @@ func addMetric(ch chan<- prometheus.Metric, name string, value string) error {
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc(metricName, "", nil, nil),
+	// Field names come from the device and may not be valid metric names.
+	metric, err := prometheus.NewConstMetric(
+		newDesc(metricName, "", nil),
 		prometheus.GaugeValue,
 		floatValue)
+	if err != nil {
+		return err
+	}
+	ch <- metric
 	return nil
 }
 
@@ -451,10 +996,15 @@ func addLabeledMetric(ch chan<- prometheus.Metric, name string, value string, la
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc(metricName, "", labels, nil),
+	// Field names come from the device and may not be valid metric names.
+	metric, err := prometheus.NewConstMetric(
+		newDesc(metricName, "", labels),
 		prometheus.GaugeValue,
 		floatValue, labelValues...)
+	if err != nil {
+		return err
+	}
+	ch <- metric
 	return nil
 }
 
@@ -474,8 +1024,7 @@ func addTrunkMetrics(ch chan<- prometheus.Metric, trunk Trunk, metricNames []str
 			continue
 		}
 		//fmt.Printf("New Metric: %s TG=%s Alias=%s\n", metricName, trunk.TrunkId, trunk.Alias)
-		labels := []string{"trunkgroup", "alias"}
-		labelValues := []string{trunk.TrunkId, trunk.Alias}
+		labels, labelValues := trunkLabels(trunk)
 		if trunk.Direction != "" {
 			labels = append(labels, "direction")
 			labelValues = append(labelValues, trunk.Direction)
@@ -487,16 +1036,35 @@ func addTrunkMetrics(ch chan<- prometheus.Metric, trunk Trunk, metricNames []str
 			}
 		}
 		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc(metricName, "", labels, nil),
+			newDesc(metricName, "", labels),
 			prometheus.GaugeValue,
 			floatValue, labelValues...)
 	}
 	return nil
 }
 
+// trunkLabels returns the labels identifying a trunk group.
+func trunkLabels(trunk Trunk) ([]string, []string) {
+	labels := []string{"trunkgroup", "alias"}
+	labelValues := []string{trunk.TrunkId, trunk.Alias}
+	if trunk.Node != "" {
+		labels = append(labels, "node")
+		labelValues = append(labelValues, trunk.Node)
+	}
+	if trunk.Type != "" {
+		labels = append(labels, "type")
+		labelValues = append(labelValues, trunk.Type)
+	}
+	return labels, labelValues
+}
+
 // setField sets field of v with given name to given value.
 func setField(v interface{}, name string, value string) error {
 	// v must be a pointer to a struct
+	if name == "" {
+		// Fields without a name can't match a struct field.
+		return nil
+	}
 	nme := []rune(name)
 	nme[0] = unicode.ToUpper(nme[0])
 	name = string(nme)
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
-	"github.com/go-kit/kit/log"
+	"github.com/go-kit/log"
 	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestScrapeTarget(t *testing.T) {
@@ -59,3 +67,147 @@ func TestScrapeTarget(t *testing.T) {
 		})
 	}
 }
+
+func TestCallRestAPIErrors(t *testing.T) {
+	testCollector := collector{target: "http://localhost:8888", targetPath: targetPath, username: "user", password: "pass", logger: log.NewNopLogger()}
+	htmlResponse := httpmock.NewStringResponse(200, "<!DOCTYPE html><html><body>Login</body></html>")
+	htmlResponse.Header.Set("Content-Type", "text/html")
+
+	tests := []struct {
+		name     string
+		httpMock httpmock.Responder
+		wantErr  error
+	}{
+		{
+			name:     "Test that authentication failures are reported",
+			httpMock: httpmock.NewStringResponder(401, "Unauthorized"),
+			wantErr:  errAuthFailed,
+		},
+		{
+			name:     "Test that HTML login pages are reported",
+			httpMock: httpmock.ResponderFromResponse(htmlResponse),
+			wantErr:  errHTMLResponse,
+		},
+		{
+			name:     "Test that empty bodies are reported as truncated",
+			httpMock: httpmock.NewStringResponder(200, ""),
+			wantErr:  errTruncatedBody,
+		},
+		{
+			name:     "Test that non-XML bodies are reported",
+			httpMock: httpmock.NewStringResponder(200, "not xml"),
+			wantErr:  errNotXML,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			httpmock.RegisterResponder("GET", "http://localhost:8888/SSConfig/webresources/stats/realtime", tt.httpMock)
+			_, err := callRestAPI(testCollector, "stats/realtime", new(bytes.Buffer))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %q, received %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseErrorTruncated(t *testing.T) {
+	var sansay Sansay
+	body := []byte(`<mysqldump><database name="x"><table name="system_stat">`)
+	err := parseError(body, xml.Unmarshal(body, &sansay))
+	if !errors.Is(err, errTruncatedBody) {
+		t.Errorf("Expected a truncated body error, received %v", err)
+	}
+}
+
+// malformedDumps are bodies that processing must reject or skip without
+// panicking. They also seed FuzzParseSansay.
+var malformedDumps = []struct {
+	name string
+	path string
+	body []byte
+}{
+	{"realtime", "stats/realtime", benchmarkDump(2)},
+	{"truncated realtime", "stats/realtime", benchmarkDump(2)[:200]},
+	{"system", "stats/system", []byte(`<mysqldump><database name="stats"><table name="system_stat"><row><field name="timestamp">2018-10-17 10:42:01</field></row></table></database></mysqldump>`)},
+	{"media server", "stats/media_server", []byte(`<XBMediaServerRealTimeStatList><XBMediaServerRealTimeStat><ID>1</ID></XBMediaServerRealTimeStat></XBMediaServerRealTimeStatList>`)},
+	{"resource", "download/resource", []byte(`<XBResourceList><XBResource><trunkId>1</trunkId></XBResource></XBResourceList>`)},
+	{"login page", "stats/realtime", []byte(`<html><body>Login</body></html>`)},
+	{"empty field name", "stats/realtime", []byte(`<mysqldump><database e=""><table e=""><row><field e=""></field></row></table><table name="XBResourceRealTimeStatList"><row><field ame="trunkId">0</field><field name="alias">trunk0</field><field name="fqdn">Group</field><field name="numOrig">0</field></row></table></database></mysqldump>`)},
+	{"invalid metric name", "stats/system", []byte(`<mysqldump><database><table name="system_stat"><row><field name=" imestamp">01</field></row></table></database></mysqldump>`)},
+}
+
+func TestProcessDumpMalformed(t *testing.T) {
+	c := collector{logger: log.NewNopLogger()}
+	for _, d := range malformedDumps {
+		t.Run(d.name, func(t *testing.T) {
+			ch := make(chan prometheus.Metric)
+			go func() {
+				c.processDump(ch, d.path, d.body)
+				close(ch)
+			}()
+			for range ch {
+			}
+		})
+	}
+}
+
+// benchmarkDump returns a realtime stats dump with the given number of trunks.
+func benchmarkDump(trunks int) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><mysqldump><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table><table name="XBResourceRealTimeStatList">`)
+	for i := 0; i < trunks; i++ {
+		fmt.Fprintf(&b, `<row><field name="trunkId">%d</field><field name="alias">trunk%d</field><field name="fqdn">Group</field>`, i, i)
+		for _, name := range []string{"numOrig", "numTerm", "cps", "numPeak", "totalCLZ", "numCLZCps", "totalLimit", "cpsLimit"} {
+			fmt.Fprintf(&b, `<field name="%s">%d</field>`, name, i)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</table></database></mysqldump>`)
+	return []byte(b.String())
+}
+
+func BenchmarkScrapeTarget(b *testing.B) {
+	dump := benchmarkDump(1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(dump)
+	}))
+	defer server.Close()
+	c := collector{target: server.URL, targetPath: targetPath, logger: log.NewNopLogger(), client: &http.Client{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		result := make(chan interface{}, 1)
+		wg.Add(1)
+		ScrapeTarget(c, "stats/realtime", result, &wg)
+		if _, ok := (<-result).(Sansay); !ok {
+			b.Fatal("Expected a parsed dump")
+		}
+	}
+}
+
+func BenchmarkProcessCollection(b *testing.B) {
+	var sansay Sansay
+	if err := xml.Unmarshal(benchmarkDump(1000), &sansay); err != nil {
+		b.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger()}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ch := make(chan prometheus.Metric, 100)
+		go func() {
+			c.processCollection(ch, sansay)
+			close(ch)
+		}()
+		for range ch {
+		}
+	}
+}
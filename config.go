@@ -0,0 +1,504 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the sansay exporter configuration file.
+type Config struct {
+	// Targets is keyed by the value passed in the 'target' URL parameter.
+	Targets map[string]*Target `yaml:"targets,omitempty"`
+	// Modules is keyed by the value passed in the 'module' URL parameter.
+	Modules map[string]*Module `yaml:"modules,omitempty"`
+	// MetadataLabels map the targets' metadata to labels of their metrics.
+	MetadataLabels []*RelabelConfig `yaml:"metadata_labels,omitempty"`
+	// MetricRelabelConfigs rewrite or drop the series served for every
+	// target.
+	MetricRelabelConfigs []*RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
+	// MetricAliases serve renamed metrics under their old names too, for a
+	// transition.
+	MetricAliases []*MetricAlias `yaml:"metric_aliases,omitempty"`
+	// MetricSmoothing serve noisy gauges smoothed too.
+	MetricSmoothing []*MetricSmoothing `yaml:"metric_smoothing,omitempty"`
+	// Tenants are keyed by the value passed in the 'tenant' URL parameter.
+	Tenants map[string]*Tenant `yaml:"tenants,omitempty"`
+
+	// adminToken is the admin API's bearer token, which also gets the full
+	// view when tenants are configured.
+	adminToken string
+
+	// mu guards Targets, as targets may be added and removed at runtime.
+	mu sync.RWMutex
+}
+
+// Module selects the paths a scrape downloads, so that e.g. the system stats
+// can be scraped more often than the full set.
+type Module struct {
+	Paths []string `yaml:"paths"`
+	// PollInterval is how often the module is polled in the background,
+	// overriding the target's and --background.interval.
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+}
+
+// Target holds the settings used when scraping a single SBC.  URL parameters
+// given on the scrape request take precedence over these values.
+type Target struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// FallbackCredentials are tried in order when the target rejects the
+	// username and password with a 401, e.g. while a password rotation is
+	// rolled out.
+	FallbackCredentials []Credentials `yaml:"fallback_credentials,omitempty"`
+	Protocol            string        `yaml:"protocol,omitempty"`
+	// ProtocolFallback retries requests on the other of HTTPS and HTTP
+	// when the connection on the configured protocol fails, and keeps
+	// using the protocol the target answered on.
+	ProtocolFallback bool   `yaml:"protocol_fallback,omitempty"`
+	API              string `yaml:"api,omitempty"`
+	Dialer           Dialer `yaml:"dialer,omitempty"`
+	// Resolve pins the target hostname to this IP address instead of
+	// looking it up in DNS.
+	Resolve string `yaml:"resolve,omitempty"`
+	// SourceIP is the local address outbound connections are bound to.
+	SourceIP string `yaml:"source_ip,omitempty"`
+	// Headers are added to every request sent to the target, and may
+	// override the default User-Agent.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// IntervalStats enables downloading the completed 15 minute interval
+	// stats once per interval.
+	IntervalStats bool `yaml:"interval_stats,omitempty"`
+	// IntervalTimestamps exports the interval stats with the end of their
+	// interval as their timestamp.
+	IntervalTimestamps bool `yaml:"interval_timestamps,omitempty"`
+	// TCD enables downloading the terminated call detail records and
+	// counting them by release cause and trunk.
+	TCD bool `yaml:"tcd,omitempty"`
+	// BusyHours enables exporting the peak sessions and calls per second of
+	// each clock hour of the day, in background polling mode.
+	BusyHours bool `yaml:"busy_hours,omitempty"`
+	// SIPTLS are the SIP over TLS addresses of the SBC, port 5061 if not
+	// given, whose certificates' expiry is exported.
+	SIPTLS []string `yaml:"sip_tls,omitempty"`
+	// LogPath is the path of the SBC's log download API, below the REST
+	// API's, that the admin API reads log archives through.
+	LogPath string `yaml:"log_path,omitempty"`
+	// Budget splits the scrape deadline across the downloaded paths by
+	// weight.  Unlisted paths weigh 1.
+	Budget map[string]float64 `yaml:"budget,omitempty"`
+	// TLS restricts the TLS versions and cipher suites used with the target.
+	TLS TLSConfig `yaml:"tls,omitempty"`
+	// HTTPVersion is "1.1" to only use HTTP/1.1, or "2" to also use HTTP/2
+	// when the target negotiates it, which is the default.
+	HTTPVersion string `yaml:"http_version,omitempty"`
+	// RateLimit caps the download rate from the target in bytes per second,
+	// for SBCs behind low-bandwidth management links.  0 is unlimited.
+	RateLimit int64 `yaml:"rate_limit,omitempty"`
+	// Trunks are the provisioned trunk group IDs, exported as zero sessions
+	// while missing from the realtime stats.
+	Trunks []string `yaml:"trunks,omitempty"`
+	// TrunkRetention is how long trunk groups that disappear from the
+	// realtime stats keep being exported as zero sessions.
+	TrunkRetention time.Duration `yaml:"trunk_retention,omitempty"`
+	// PollInterval is how often the target is polled in the background,
+	// overriding --background.interval.
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	// MaxInFlight bounds the concurrent requests to the target, overriding
+	// --scrape.max-in-flight.
+	MaxInFlight int `yaml:"max_in_flight,omitempty"`
+	// UtilizationThreshold is the share of its session limit above which a
+	// trunk group counts in sansay_trunk_groups_over_utilization, 0.8 if not
+	// set.
+	UtilizationThreshold float64 `yaml:"utilization_threshold,omitempty"`
+	// UtilizationThresholds are the shares of their session limit whose
+	// crossings by each trunk group, and the time spent above them, are
+	// counted across scrapes.
+	UtilizationThresholds []float64 `yaml:"utilization_thresholds,omitempty"`
+	// DerivedCPS enables deriving the trunk groups' call attempt rates from
+	// their call attempt counters in successive scrapes.
+	DerivedCPS bool `yaml:"derived_cps,omitempty"`
+	// TopTrunks limits the realtime trunk group series to the busiest
+	// TopTrunks trunk groups, aggregating the rest into "other".  0 exports
+	// every trunk group.
+	TopTrunks int `yaml:"top_trunks,omitempty"`
+	// TopTrunksBy is what trunk groups are ranked by, "sessions" (the
+	// default) or "cps".
+	TopTrunksBy string `yaml:"top_trunks_by,omitempty"`
+	// HAPeer is the target name of the SBC's HA mate, scraped along with it
+	// to export how far the pair's state diverges.
+	HAPeer string `yaml:"ha_peer,omitempty"`
+	// HACompare are the metrics whose sums are compared with the HA peer,
+	// the sessions, calls per second and trunk groups if not set.
+	HACompare []string `yaml:"ha_compare,omitempty"`
+	// TrunkCustomers maps trunk group IDs to the customers they belong to,
+	// for the per-customer session and calls per second totals.
+	TrunkCustomers map[string]string `yaml:"trunk_customers,omitempty"`
+	// Units are the device units of system_stat fields, by field name, to
+	// convert to Prometheus base units: milliseconds, seconds, bytes,
+	// kilobytes, megabytes or percent.
+	Units map[string]string `yaml:"units,omitempty"`
+	// KnownFields are table fields the exporter doesn't know of to accept in
+	// --strict mode, e.g. once a firmware upgrade's new fields were reviewed.
+	KnownFields []string `yaml:"known_fields,omitempty"`
+	// Metadata describes the target, e.g. the tags or annotations of the
+	// discovery it came from, for metadata_labels to map to labels.
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+	// MetricRelabelConfigs rewrite or drop the target's series, after those
+	// of the file.
+	MetricRelabelConfigs []*RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
+	// NativeMetrics is the path, e.g. /metrics, of the metrics newer builds
+	// serve in the Prometheus text format, to merge with the exporter's.
+	NativeMetrics string `yaml:"native_metrics,omitempty"`
+	// NativeMetricsPrefix is prepended to the names of the native metrics,
+	// keeping them apart from the exporter's.
+	NativeMetricsPrefix string `yaml:"native_metrics_prefix,omitempty"`
+}
+
+// TLSConfig holds the TLS versions ("1.0" to "1.3") and cipher suites, by
+// their Go names, a target may use.  Empty values keep Go's defaults.
+type TLSConfig struct {
+	MinVersion   string   `yaml:"min_version,omitempty"`
+	MaxVersion   string   `yaml:"max_version,omitempty"`
+	CipherSuites []string `yaml:"cipher_suites,omitempty"`
+}
+
+// Credentials are a username and password a target may accept.
+type Credentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Dialer controls how connections to a target are established.  At most one
+// of UnixSocket and ProxyURL may be set.
+type Dialer struct {
+	// UnixSocket is the path of a local socket (e.g. an stunnel endpoint)
+	// that all connections to the target are made through.
+	UnixSocket string `yaml:"unix_socket,omitempty"`
+	// ProxyURL is a socks5:// (or http://) proxy the target is reached via.
+	ProxyURL string `yaml:"proxy_url,omitempty"`
+}
+
+// LoadFile reads and validates the configuration file at filename.  The file,
+// or individual secrets in it, may be encrypted with age to the identities,
+// and secrets may be kept in a cloud secret manager.
+func LoadFile(filename string, identities ...age.Identity) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isEncrypted(content) {
+		if content, err = decrypt(content, identities); err != nil {
+			return nil, err
+		}
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, err
+	}
+	for name, t := range cfg.Targets {
+		if t == nil {
+			cfg.Targets[name] = &Target{}
+			continue
+		}
+		if err := t.decryptSecrets(identities); err != nil {
+			return nil, fmt.Errorf("target %q: %s", name, err)
+		}
+		if err := t.mapSecrets(cloudSecrets.fetch); err != nil {
+			return nil, fmt.Errorf("target %q: %s", name, err)
+		}
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("target %q: %s", name, err)
+		}
+	}
+	for name, m := range cfg.Modules {
+		if m == nil || len(m.Paths) == 0 {
+			return nil, fmt.Errorf("module %q: no paths", name)
+		}
+		if m.PollInterval < 0 {
+			return nil, fmt.Errorf("module %q: poll_interval must not be negative", name)
+		}
+	}
+	for i, m := range cfg.MetadataLabels {
+		if m == nil {
+			return nil, fmt.Errorf("metadata_labels %d: empty", i)
+		}
+		if err := validateMetadataLabel(m); err != nil {
+			return nil, fmt.Errorf("metadata_labels %d: %s", i, err)
+		}
+	}
+	for i, c := range cfg.MetricRelabelConfigs {
+		if c == nil {
+			return nil, fmt.Errorf("metric_relabel_configs %d: empty", i)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("metric_relabel_configs %d: %s", i, err)
+		}
+	}
+	for i, a := range cfg.MetricAliases {
+		if a == nil {
+			return nil, fmt.Errorf("metric_aliases %d: empty", i)
+		}
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("metric_aliases %d: %s", i, err)
+		}
+	}
+	for i, m := range cfg.MetricSmoothing {
+		if m == nil {
+			return nil, fmt.Errorf("metric_smoothing %d: empty", i)
+		}
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("metric_smoothing %d: %s", i, err)
+		}
+	}
+	tokens := map[string]string{}
+	for name, t := range cfg.Tenants {
+		if t == nil || t.BearerToken == "" {
+			return nil, fmt.Errorf("tenants %q: bearer_token must be set", name)
+		}
+		if other, ok := tokens[t.BearerToken]; ok {
+			return nil, fmt.Errorf("tenants %q: bearer_token is also that of tenant %q", name, other)
+		}
+		tokens[t.BearerToken] = name
+	}
+	return cfg, nil
+}
+
+// Module returns the paths of the named module, or those of every scrape if
+// name is empty.
+func (c *Config) Module(name string) ([]string, error) {
+	if name == "" {
+		return scrapePaths, nil
+	}
+	m, ok := c.Modules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q", name)
+	}
+	return m.Paths, nil
+}
+
+// Target returns the configuration for the named target, or an empty one if
+// the target is not configured.
+func (c *Config) Target(name string) *Target {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if t, ok := c.Targets[name]; ok {
+		return t
+	}
+	return &Target{}
+}
+
+// HasTarget reports whether the named target is configured.
+func (c *Config) HasTarget(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.Targets[name]
+	return ok
+}
+
+// TargetNames returns the names of the configured targets, sorted.
+func (c *Config) TargetNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.Targets))
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddTarget validates the target and adds it, replacing any target of the
+// same name.
+func (c *Config) AddTarget(name string, t *Target) error {
+	if err := t.validate(); err != nil {
+		return fmt.Errorf("target %q: %s", name, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Targets == nil {
+		c.Targets = map[string]*Target{}
+	}
+	c.Targets[name] = t
+	return nil
+}
+
+// RemoveTarget removes the named target, and reports whether it was
+// configured.
+func (c *Config) RemoveTarget(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.Targets[name]
+	delete(c.Targets, name)
+	return ok
+}
+
+// Shard returns a copy of the configuration holding only the targets assigned
+// to shard index of count, chosen by a hash of the target name so every
+// replica derives the same assignment from the same file.  Everything but
+// the targets is kept as is.
+func (c *Config) Shard(index, count int) *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	shard := &Config{
+		Targets:              map[string]*Target{},
+		Modules:              c.Modules,
+		MetadataLabels:       c.MetadataLabels,
+		MetricRelabelConfigs: c.MetricRelabelConfigs,
+		MetricAliases:        c.MetricAliases,
+		MetricSmoothing:      c.MetricSmoothing,
+		Tenants:              c.Tenants,
+		adminToken:           c.adminToken,
+	}
+	for name, t := range c.Targets {
+		if targetShard(name, count) == index {
+			shard.Targets[name] = t
+		}
+	}
+	return shard
+}
+
+// targetShard returns the shard of count the named target is assigned to.
+func targetShard(name string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(count))
+}
+
+func (t *Target) validate() error {
+	if t.Dialer.UnixSocket != "" && t.Dialer.ProxyURL != "" {
+		return fmt.Errorf("dialer: unix_socket and proxy_url are mutually exclusive")
+	}
+	if t.Resolve != "" {
+		if net.ParseIP(t.Resolve) == nil {
+			return fmt.Errorf("resolve: %q is not an IP address", t.Resolve)
+		}
+		if t.Dialer.UnixSocket != "" || t.Dialer.ProxyURL != "" {
+			return fmt.Errorf("resolve cannot be combined with a dialer")
+		}
+	}
+	if t.SourceIP != "" {
+		if net.ParseIP(t.SourceIP) == nil {
+			return fmt.Errorf("source_ip: %q is not an IP address", t.SourceIP)
+		}
+		if t.Dialer.UnixSocket != "" {
+			return fmt.Errorf("source_ip cannot be combined with a unix socket dialer")
+		}
+	}
+	for path, weight := range t.Budget {
+		if weight <= 0 {
+			return fmt.Errorf("budget: weight for %q must be positive", path)
+		}
+	}
+	if _, err := newTLSConfig(t.TLS); err != nil {
+		return fmt.Errorf("tls: %s", err)
+	}
+	switch t.HTTPVersion {
+	case "", "1.1", "2":
+	default:
+		return fmt.Errorf("http_version: %q is not 1.1 or 2", t.HTTPVersion)
+	}
+	if t.RateLimit < 0 {
+		return fmt.Errorf("rate_limit: must not be negative")
+	}
+	if t.TrunkRetention < 0 {
+		return fmt.Errorf("trunk_retention: must not be negative")
+	}
+	if t.PollInterval < 0 {
+		return fmt.Errorf("poll_interval: must not be negative")
+	}
+	if t.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight: must not be negative")
+	}
+	if t.UtilizationThreshold < 0 || t.UtilizationThreshold > 1 {
+		return fmt.Errorf("utilization_threshold: must be between 0 and 1")
+	}
+	if t.IntervalTimestamps && !t.IntervalStats {
+		return fmt.Errorf("interval_timestamps: requires interval_stats")
+	}
+	for _, address := range t.SIPTLS {
+		if address == "" {
+			return fmt.Errorf("sip_tls: empty address")
+		}
+	}
+	if len(t.SIPTLS) > 0 && t.Dialer.ProxyURL != "" {
+		return fmt.Errorf("sip_tls cannot be combined with a proxy_url dialer")
+	}
+	for _, threshold := range t.UtilizationThresholds {
+		if threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("utilization_thresholds: %g is not between 0 and 1", threshold)
+		}
+	}
+	if t.TopTrunks < 0 {
+		return fmt.Errorf("top_trunks: must not be negative")
+	}
+	for _, name := range t.HACompare {
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			return fmt.Errorf("ha_compare: %q is not a valid metric name", name)
+		}
+	}
+	for trunk, customer := range t.TrunkCustomers {
+		if customer == "" {
+			return fmt.Errorf("trunk_customers: empty customer for trunk group %q", trunk)
+		}
+	}
+	for field, name := range t.Units {
+		if _, ok := units[name]; !ok {
+			return fmt.Errorf("units: unknown unit %q for %q", name, field)
+		}
+	}
+	switch t.TopTrunksBy {
+	case "", "sessions", "cps":
+	default:
+		return fmt.Errorf("top_trunks_by: %q is not sessions or cps", t.TopTrunksBy)
+	}
+	for i, c := range t.MetricRelabelConfigs {
+		if c == nil {
+			return fmt.Errorf("metric_relabel_configs %d: empty", i)
+		}
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("metric_relabel_configs %d: %s", i, err)
+		}
+	}
+	if t.NativeMetrics != "" && !strings.HasPrefix(t.NativeMetrics, "/") {
+		return fmt.Errorf("native_metrics: %q must start with /", t.NativeMetrics)
+	}
+	if t.NativeMetricsPrefix != "" && !model.IsValidMetricName(model.LabelValue(t.NativeMetricsPrefix)) {
+		return fmt.Errorf("native_metrics_prefix: %q is not a valid metric name prefix", t.NativeMetricsPrefix)
+	}
+	if t.Dialer.ProxyURL != "" {
+		u, err := url.Parse(t.Dialer.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("dialer: invalid proxy_url: %s", err)
+		}
+		switch u.Scheme {
+		case "socks5", "http", "https":
+		default:
+			return fmt.Errorf("dialer: unsupported proxy scheme %q", u.Scheme)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{
+			name: "Test that a valid file is loaded",
+			file: "testdata/sansay.yml",
+		},
+		{
+			name:    "Test that conflicting dialer settings are rejected",
+			file:    "testdata/invalid-dialer.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a resolve override must be an IP address",
+			file:    "testdata/invalid-resolve.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a metadata label must have a valid name",
+			file:    "testdata/invalid-metadata-labels.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a native metrics path must be absolute",
+			file:    "testdata/invalid-native-metrics.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a metric alias's end must be a date",
+			file:    "testdata/invalid-metric-aliases.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a tenant must have a bearer token",
+			file:    "testdata/invalid-tenant-token.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a budget weight must be positive",
+			file:    "testdata/invalid-budget.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that SIP-TLS addresses can't be probed through a proxy",
+			file:    "testdata/invalid-sip-tls.yml",
+			wantErr: true,
+		},
+		{
+			name:    "Test that a missing file is an error",
+			file:    "testdata/missing.yml",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigTarget(t *testing.T) {
+	cfg, err := LoadFile("testdata/sansay.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Target("sbc1.example.com").Username; got != "user" {
+		t.Errorf("Expected username 'user', received %q", got)
+	}
+	if got := cfg.Target("sbc2.example.com").Dialer.UnixSocket; got != "/run/stunnel/sbc2.sock" {
+		t.Errorf("Expected unix socket path, received %q", got)
+	}
+	if got := cfg.Target("sbc1.example.com").TrunkRetention; got != time.Hour {
+		t.Errorf("Expected a trunk retention of 1h, received %s", got)
+	}
+	if got := cfg.Target("unknown"); got == nil {
+		t.Error("Expected an empty target for unknown names")
+	}
+}
+
+func TestConfigModule(t *testing.T) {
+	cfg, err := LoadFile("testdata/sansay.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths, err := cfg.Module("system"); err != nil || !reflect.DeepEqual(paths, []string{"stats/realtime"}) {
+		t.Errorf("Expected the system module's paths, received %v, %v", paths, err)
+	}
+	if paths, _ := cfg.Module(""); !reflect.DeepEqual(paths, scrapePaths) {
+		t.Errorf("Expected every path without a module, received %v", paths)
+	}
+	if _, err := cfg.Module("unknown"); err == nil {
+		t.Error("Expected an error for an unknown module")
+	}
+}
+
+func TestConfigShard(t *testing.T) {
+	cfg := &Config{Targets: map[string]*Target{}}
+	for _, name := range []string{"sbc1", "sbc2", "sbc3", "sbc4", "sbc5", "sbc6", "sbc7", "sbc8"} {
+		cfg.Targets[name] = &Target{}
+	}
+	seen := map[string]int{}
+	for index := 0; index < 3; index++ {
+		for name := range cfg.Shard(index, 3).Targets {
+			seen[name]++
+		}
+	}
+	for name := range cfg.Targets {
+		if seen[name] != 1 {
+			t.Errorf("Expected %s to be assigned to exactly one shard, assigned to %d", name, seen[name])
+		}
+	}
+	if got := len(cfg.Shard(0, 1).Targets); got != len(cfg.Targets) {
+		t.Errorf("Expected a single shard to hold all targets, received %d", got)
+	}
+}
+
+func TestConfigShardKeepsSettings(t *testing.T) {
+	cfg := &Config{
+		Targets:              map[string]*Target{"sbc1": {}},
+		Modules:              map[string]*Module{"system": {Paths: []string{"stats/system"}}},
+		MetadataLabels:       []*RelabelConfig{{SourceLabels: []string{"site"}, TargetLabel: "site"}},
+		MetricRelabelConfigs: []*RelabelConfig{{SourceLabels: []string{"__name__"}, Regex: "go_.*", Action: "drop"}},
+		MetricAliases:        []*MetricAlias{{Name: "sansay_uptime_seconds", Alias: "sansay_uptime"}},
+		MetricSmoothing:      []*MetricSmoothing{{Name: "sansay_trunk_cps", HalfLife: time.Minute}},
+		Tenants:              map[string]*Tenant{"acme": {BearerToken: "acme-token"}},
+		adminToken:           "secret",
+	}
+	want := reflect.ValueOf(cfg).Elem()
+	got := reflect.ValueOf(cfg.Shard(1, 2)).Elem()
+	for i := 0; i < want.NumField(); i++ {
+		name := want.Type().Field(i).Name
+		if name == "Targets" || name == "mu" {
+			continue
+		}
+		// Every setting is set above, so one added later must be too.
+		if want.Field(i).IsZero() {
+			t.Fatalf("Expected %s to be set in the test configuration", name)
+		}
+		if fmt.Sprint(got.Field(i)) != fmt.Sprint(want.Field(i)) {
+			t.Errorf("Expected the shard to keep %s", name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v2"
+)
+
+// metricMappingFields are the settings that change the names, labels or
+// values of the exported series, whose changes may break dashboards.
+var metricMappingFields = map[string]bool{
+	"metadata_labels":        true,
+	"metric_relabel_configs": true,
+	"metric_aliases":         true,
+	"metric_smoothing":       true,
+	"metadata":               true,
+	"units":                  true,
+	"native_metrics_prefix":  true,
+	"top_trunks":             true,
+	"top_trunks_by":          true,
+	"trunk_customers":        true,
+}
+
+// diffConfigs returns the targets, modules and settings that differ between
+// old and new, one per line: added (+), removed (-) or changed (~).  Changes
+// to the metric mapping are marked, values are left out as they may be
+// secrets.
+func diffConfigs(old, new *Config) []string {
+	var lines []string
+	for _, name := range unionKeys(old.Targets, new.Targets) {
+		o, n := old.Targets[name], new.Targets[name]
+		switch {
+		case o == nil:
+			lines = append(lines, fmt.Sprintf("+ target %q", name))
+		case n == nil:
+			lines = append(lines, fmt.Sprintf("- target %q", name))
+		default:
+			for _, field := range changedFields(o, n) {
+				lines = append(lines, fmt.Sprintf("~ target %q: %s", name, describeField(field)))
+			}
+		}
+	}
+	for _, name := range unionKeys(old.Modules, new.Modules) {
+		o, n := old.Modules[name], new.Modules[name]
+		switch {
+		case o == nil:
+			lines = append(lines, fmt.Sprintf("+ module %q", name))
+		case n == nil:
+			lines = append(lines, fmt.Sprintf("- module %q", name))
+		default:
+			for _, field := range changedFields(o, n) {
+				lines = append(lines, fmt.Sprintf("~ module %q: %s", name, field))
+			}
+		}
+	}
+	for _, field := range changedFields(old, new) {
+		if field == "targets" || field == "modules" {
+			continue
+		}
+		lines = append(lines, "~ "+describeField(field))
+	}
+	return lines
+}
+
+// describeField returns the setting's name, marked if it changes the metric
+// mapping.
+func describeField(field string) string {
+	if metricMappingFields[field] {
+		return field + " (metric mapping)"
+	}
+	return field
+}
+
+// changedFields returns the YAML names of the fields that differ between the
+// structs old and new point to.
+func changedFields(old, new interface{}) []string {
+	o, n := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	var fields []string
+	for i := 0; i < o.NumField(); i++ {
+		field := o.Type().Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || field.PkgPath != "" {
+			continue
+		}
+		// Unexported state, such as compiled regexps, is ignored.
+		before, err := yaml.Marshal(o.Field(i).Interface())
+		if err != nil {
+			continue
+		}
+		after, err := yaml.Marshal(n.Field(i).Interface())
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(before, after) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// unionKeys returns the keys of both maps, sorted.
+func unionKeys(a, b interface{}) []string {
+	seen := map[string]bool{}
+	for _, m := range []interface{}{a, b} {
+		for _, key := range reflect.ValueOf(m).MapKeys() {
+			seen[key.String()] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printConfigDiff writes the differences between old and new.
+func printConfigDiff(w io.Writer, old, new *Config) {
+	lines := diffConfigs(old, new)
+	if len(lines) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// runCheckConfig loads the configuration files, and with diff set writes the
+// differences between the two given.
+func runCheckConfig(w io.Writer, files []string, diff bool, identities ...age.Identity) error {
+	if diff && len(files) != 2 {
+		return fmt.Errorf("--diff needs the old and the new file, received %d files", len(files))
+	}
+	confs := make([]*Config, 0, len(files))
+	for _, file := range files {
+		conf, err := LoadFile(file, identities...)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		confs = append(confs, conf)
+	}
+	if diff {
+		printConfigDiff(w, confs[0], confs[1])
+		return nil
+	}
+	for _, file := range files {
+		fmt.Fprintf(w, "%s: OK\n", file)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old := &Config{
+		Targets: map[string]*Target{
+			"sbc1": {Username: "admin", Password: "old", Units: map[string]string{"mem_used_pct": "percent"}},
+			"sbc2": {},
+		},
+		Modules: map[string]*Module{"system": {Paths: []string{"stats/system"}}},
+		MetricRelabelConfigs: []*RelabelConfig{
+			{SourceLabels: []string{"__name__"}, Regex: "sansay_trunk_interval_.*", Action: "drop"},
+		},
+	}
+	new := &Config{
+		Targets: map[string]*Target{
+			"sbc1": {Username: "admin", Password: "new"},
+			"sbc3": {},
+		},
+		Modules: map[string]*Module{"system": {Paths: []string{"stats/system", "stats/realtime"}}},
+		MetricRelabelConfigs: []*RelabelConfig{
+			{SourceLabels: []string{"__name__"}, Regex: "sansay_trunk_interval_.*", Action: "drop"},
+		},
+	}
+	for _, c := range append(old.MetricRelabelConfigs, new.MetricRelabelConfigs...) {
+		if err := c.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		`~ target "sbc1": password`,
+		`~ target "sbc1": units (metric mapping)`,
+		`- target "sbc2"`,
+		`+ target "sbc3"`,
+		`~ module "system": paths`,
+	}
+	if got := diffConfigs(old, new); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, received %q", expected, got)
+	}
+
+	var out bytes.Buffer
+	printConfigDiff(&out, old, old)
+	if out.String() != "No changes\n" {
+		t.Errorf("Expected no changes between a file and itself, received %q", out.String())
+	}
+}
+
+func TestRunCheckConfig(t *testing.T) {
+	var out bytes.Buffer
+	if err := runCheckConfig(&out, []string{"testdata/sansay.yml"}, true); err == nil {
+		t.Error("Expected an error for --diff with one file")
+	}
+	if err := runCheckConfig(&out, []string{"testdata/sansay.yml", "testdata/invalid-dialer.yml"}, true); err == nil {
+		t.Error("Expected an error for an invalid file")
+	}
+	out.Reset()
+	if err := runCheckConfig(&out, []string{"testdata/sansay.yml", "testdata/sansay.yml"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "No changes\n" {
+		t.Errorf("Expected no changes, received %q", out.String())
+	}
+}
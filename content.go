@@ -0,0 +1,71 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// contentTracker remembers a hash of the last response body per target and
+// path, and counts the scrapes that returned an identical body.  Some SBC
+// firmware has a bug where the stats generator hangs and keeps serving the
+// same file, which otherwise looks like perfectly flat metrics.
+type contentTracker struct {
+	mu      sync.Mutex
+	entries map[contentKey]*contentEntry
+}
+
+type contentKey struct {
+	target, path string
+}
+
+type contentEntry struct {
+	hash      [sha256.Size]byte
+	unchanged float64
+}
+
+func newContentTracker() *contentTracker {
+	return &contentTracker{entries: map[contentKey]*contentEntry{}}
+}
+
+// observe records the body returned for the target and path.
+func (t *contentTracker) observe(target, path string, body []byte) {
+	hash := sha256.Sum256(body)
+	key := contentKey{target: target, path: path}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[key]
+	if !ok {
+		t.entries[key] = &contentEntry{hash: hash}
+		return
+	}
+	if entry.hash == hash {
+		entry.unchanged++
+	}
+	entry.hash = hash
+}
+
+// unchanged returns the number of identical bodies seen for the target and
+// path, and whether the path has been seen at all.
+func (t *contentTracker) unchanged(target, path string) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[contentKey{target: target, path: path}]
+	if !ok {
+		return 0, false
+	}
+	return entry.unchanged, true
+}
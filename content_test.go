@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestContentTracker(t *testing.T) {
+	tracker := newContentTracker()
+	if _, ok := tracker.unchanged("sbc", "stats/realtime"); ok {
+		t.Error("Expected no entry before the first observation")
+	}
+
+	tracker.observe("sbc", "stats/realtime", []byte("<a/>"))
+	tracker.observe("sbc", "stats/realtime", []byte("<a/>"))
+	tracker.observe("sbc", "stats/realtime", []byte("<b/>"))
+	tracker.observe("sbc", "stats/realtime", []byte("<b/>"))
+	tracker.observe("sbc", "stats/resource", []byte("<a/>"))
+
+	if got, _ := tracker.unchanged("sbc", "stats/realtime"); got != 2 {
+		t.Errorf("Expected 2 unchanged bodies, received %v", got)
+	}
+	if got, ok := tracker.unchanged("sbc", "stats/resource"); !ok || got != 0 {
+		t.Errorf("Expected 0 unchanged bodies for a new path, received %v", got)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trunkAttempts is the cumulative call attempt counter of the realtime
+// trunk table's Group rows.
+var trunkAttempts = []statField{
+	{"sansay_trunk_call_attempts_total", "Call attempts on the trunk group.", prometheus.CounterValue, 1, []string{"numAttempt", "numAttempts", "totalAttempt", "callAttempts", "numCallAttempt"}},
+}
+
+// cpsRetention is how long the call attempt counter of a trunk group that
+// is no longer observed is kept.
+const cpsRetention = time.Hour
+
+// cpsSample is the call attempt counter of a trunk group when last observed,
+// and the rate derived then.
+type cpsSample struct {
+	attempts float64
+	observed time.Time
+	rate     float64
+	hasRate  bool
+}
+
+// cpsTracker derives the call attempt rate of the trunk groups of each
+// target from their call attempt counters in successive dumps, as several
+// firmware versions report a stale Cps field.
+type cpsTracker struct {
+	mu      sync.Mutex
+	targets map[string]map[string]*cpsSample
+	// swept is when the samples past cpsRetention were last deleted.
+	swept time.Time
+}
+
+func newCPSTracker() *cpsTracker {
+	return &cpsTracker{targets: map[string]map[string]*cpsSample{}}
+}
+
+// observe records the call attempt counter in the fields of a trunk group's
+// Group row of a dump fetched at fetched, and returns the rate of attempts
+// per second since the previous dump.  A dump fetched no later than the
+// previous one, such as the same dump shared from the download cache,
+// returns the rate derived before.  There is no rate for the first
+// observation, nor when the counter went backwards, e.g. after the SBC
+// restarted.
+func (t *cpsTracker) observe(target string, group Trunk, fields map[string]string, fetched time.Time) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	attempts, err := strconv.ParseFloat(firstField(fields, trunkAttempts[0].fields...), 64)
+	if err != nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if fetched.Sub(t.swept) >= cpsRetention {
+		t.sweep(fetched)
+	}
+	samples, ok := t.targets[target]
+	if !ok {
+		samples = map[string]*cpsSample{}
+		t.targets[target] = samples
+	}
+	key := trunkKey(group)
+	last, ok := samples[key]
+	if !ok {
+		samples[key] = &cpsSample{attempts: attempts, observed: fetched}
+		return 0, false
+	}
+	if !fetched.After(last.observed) {
+		return last.rate, last.hasRate
+	}
+	sample := &cpsSample{attempts: attempts, observed: fetched}
+	if attempts >= last.attempts {
+		sample.rate = (attempts - last.attempts) / fetched.Sub(last.observed).Seconds()
+		sample.hasRate = true
+	}
+	samples[key] = sample
+	return sample.rate, sample.hasRate
+}
+
+// sweep deletes the samples of the trunk groups not observed within
+// cpsRetention of now, and the targets left without any.  t.mu must be held.
+func (t *cpsTracker) sweep(now time.Time) {
+	for target, samples := range t.targets {
+		for key, sample := range samples {
+			if now.Sub(sample.observed) > cpsRetention {
+				delete(samples, key)
+			}
+		}
+		if len(samples) == 0 {
+			delete(t.targets, target)
+		}
+	}
+	t.swept = now
+}
+
+// addDerivedCPS exports the call attempt rate of a trunk group derived by
+// the exporter, alongside the Cps field reported by the SBC.
+func addDerivedCPS(ch chan<- prometheus.Metric, group Trunk, rate float64) {
+	labels, labelValues := trunkLabels(group)
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_trunk_cps_derived", "Call attempts per second on the trunk group, derived from its call attempt counter in successive scrapes.", labels),
+		prometheus.GaugeValue,
+		rate, labelValues...)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCPSTracker(t *testing.T) {
+	tracker := newCPSTracker()
+	group := Trunk{TrunkId: "100", Alias: "carrier"}
+	start := time.Unix(1000, 0)
+	for i, tt := range []struct {
+		attempts string
+		at       time.Duration
+		rate     float64
+		ok       bool
+	}{
+		{"1000", 0, 0, false},
+		{"1600", time.Minute, 10, true},
+		// The same dump replayed from the download cache keeps its rate.
+		{"1600", time.Minute, 10, true},
+		{"1600", 2 * time.Minute, 0, true},
+		// The counter was reset.
+		{"30", 3 * time.Minute, 0, false},
+		{"330", 4 * time.Minute, 5, true},
+		{"", 5 * time.Minute, 0, false},
+	} {
+		fields := map[string]string{"numAttempt": tt.attempts}
+		rate, ok := tracker.observe("sbc1", group, fields, start.Add(tt.at))
+		if rate != tt.rate || ok != tt.ok {
+			t.Errorf("%d: Expected %g, %t, received %g, %t", i, tt.rate, tt.ok, rate, ok)
+		}
+	}
+	// Trunk groups of other targets are tracked separately.
+	if _, ok := tracker.observe("sbc2", group, map[string]string{"numAttempt": "5000"}, start.Add(time.Hour)); ok {
+		t.Error("Expected no rate on the first observation of another target")
+	}
+
+	var disabled *cpsTracker
+	if _, ok := disabled.observe("sbc1", group, map[string]string{"numAttempt": "1"}, start); ok {
+		t.Error("Expected no rate without a tracker")
+	}
+}
+
+func TestCPSTrackerRetention(t *testing.T) {
+	tracker := newCPSTracker()
+	start := time.Unix(1000, 0)
+	tracker.observe("sbc1", Trunk{TrunkId: "100"}, map[string]string{"numAttempt": "1000"}, start)
+	tracker.observe("sbc2", Trunk{TrunkId: "100"}, map[string]string{"numAttempt": "1000"}, start)
+	tracker.observe("sbc1", Trunk{TrunkId: "200"}, map[string]string{"numAttempt": "1000"}, start.Add(2*cpsRetention))
+
+	if _, ok := tracker.targets["sbc2"]; ok {
+		t.Error("Expected the target no longer observed to be deleted")
+	}
+	if _, ok := tracker.targets["sbc1"][trunkKey(Trunk{TrunkId: "100"})]; ok {
+		t.Error("Expected the trunk group no longer observed to be deleted")
+	}
+	if _, ok := tracker.observe("sbc1", Trunk{TrunkId: "100"}, map[string]string{"numAttempt": "2000"}, start.Add(2*cpsRetention+time.Minute)); ok {
+		t.Error("Expected no rate against a sample past the retention")
+	}
+}
+
+func TestDerivedCPS(t *testing.T) {
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		addDerivedCPS(ch, Trunk{TrunkId: "100", Alias: "carrier", Type: "egress"}, 12.5)
+	}, `
+# TYPE sansay_trunk_cps_derived gauge
+sansay_trunk_cps_derived{alias="carrier",trunkgroup="100",type="egress"} 12.5
+`, "sansay_trunk_cps_derived")
+}
+
+func TestTrunkCallAttempts(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="numOrig">0</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field><field name="numAttempt">4200</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_trunk_call_attempts_total counter
+sansay_trunk_call_attempts_total{alias="carrier",trunkgroup="100"} 4200
+`
+	compareCollection(t, dump, expected, "sansay_trunk_call_attempts_total", "sansay_trunk_cps_derived")
+}
+
+func TestDerivedCPSFetchTime(t *testing.T) {
+	dump := func(attempts string) Sansay {
+		var sansay Sansay
+		body := `<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="numOrig">0</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field><field name="numAttempt">` + attempts + `</field></row>
+</table></database></mysqldump>`
+		if err := xml.Unmarshal([]byte(body), &sansay); err != nil {
+			t.Fatal(err)
+		}
+		return sansay
+	}
+	c := collector{logger: log.NewNopLogger(), cps: newCPSTracker()}
+	first, second := dump("1000"), dump("1300")
+	first.Fetched = time.Now().Add(-2 * time.Minute)
+	second.Fetched = first.Fetched.Add(time.Minute)
+	expected := `
+# TYPE sansay_trunk_cps_derived gauge
+sansay_trunk_cps_derived{alias="carrier",trunkgroup="100"} 5
+`
+	discard := make(chan prometheus.Metric, 100)
+	c.processCollection(discard, first)
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, second)
+	}, expected, "sansay_trunk_cps_derived")
+	// Scrapes sharing the cached second dump keep its rate.
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, second)
+	}, expected, "sansay_trunk_cps_derived")
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+)
+
+// credentialTracker remembers which of its credentials each target last
+// accepted, so that during a password rotation targets still on the old
+// password aren't sent the new one (and a 401) on every download.
+type credentialTracker struct {
+	mu      sync.Mutex
+	working map[string]int
+}
+
+func newCredentialTracker() *credentialTracker {
+	return &credentialTracker{working: map[string]int{}}
+}
+
+// order returns the indexes of the target's n credentials in the order they
+// are tried: the last accepted first, then the rest as configured.  Without
+// a tracker they are tried as configured.
+func (t *credentialTracker) order(target string, n int) []int {
+	first := 0
+	if i, ok := t.index(target); ok && i < n {
+		first = i
+	}
+	order := []int{first}
+	for i := 0; i < n; i++ {
+		if i != first {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// accepted records that the target accepted the credentials at index i.
+func (t *credentialTracker) accepted(target string, i int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.working[target] = i
+}
+
+// index returns the index of the credentials the target last accepted.
+func (t *credentialTracker) index(target string) (int, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i, ok := t.working[target]
+	return i, ok
+}
+
+// credentialList returns the credentials of the collector, the primary
+// username and password first.
+func (c collector) credentialList() []Credentials {
+	return append([]Credentials{{Username: c.username, Password: c.password}}, c.fallback...)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestCallRestAPIFallbackCredentials(t *testing.T) {
+	var passwords []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, _ := r.BasicAuth()
+		passwords = append(passwords, password)
+		if password != "new" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte("<mysqldump/>"))
+	}))
+	defer server.Close()
+
+	c := collector{target: server.URL, targetPath: targetPath, username: "user", password: "old", logger: log.NewNopLogger(),
+		fallback: []Credentials{{Username: "user", Password: "older"}, {Username: "user", Password: "new"}}, credentials: newCredentialTracker()}
+	if _, err := callRestAPI(c, "stats/realtime", new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callRestAPI(c, "stats/realtime", new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	// The second download starts with the credentials accepted by the first.
+	if expected := []string{"old", "older", "new", "new"}; !reflect.DeepEqual(passwords, expected) {
+		t.Errorf("Expected passwords %q, received %q", expected, passwords)
+	}
+	if i, _ := c.credentials.index(server.URL); i != 2 {
+		t.Errorf("Expected the second fallback to be remembered, received %d", i)
+	}
+
+	c.fallback = nil
+	c.credentials = nil
+	if _, err := callRestAPI(c, "stats/realtime", new(bytes.Buffer)); !errors.Is(err, errAuthFailed) {
+		t.Errorf("Expected an authentication failure without fallbacks, received %v", err)
+	}
+}
+
+func TestCredentialTrackerOrder(t *testing.T) {
+	var tracker *credentialTracker
+	if got := tracker.order("sbc", 3); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("Expected the configured order without a tracker, received %v", got)
+	}
+	tracker = newCredentialTracker()
+	tracker.accepted("sbc", 1)
+	if got := tracker.order("sbc", 3); !reflect.DeepEqual(got, []int{1, 0, 2}) {
+		t.Errorf("Expected the accepted credentials first, received %v", got)
+	}
+	if got := tracker.order("sbc", 1); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("Expected a removed fallback to be ignored, received %v", got)
+	}
+}
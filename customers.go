@@ -0,0 +1,82 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// customerTotal is the sum of the Group rows of a customer's trunk groups.
+type customerTotal struct {
+	groups   int
+	sessions float64
+	cps      float64
+}
+
+// customerTotals sums the realtime trunk group Group rows by the customer
+// each trunk group is mapped to, so per-customer SLAs can be charted without
+// aggregating every trunk group series.  Trunk groups without a customer are
+// left out.
+type customerTotals struct {
+	customers map[string]string
+	totals    map[string]*customerTotal
+}
+
+// add records a trunk group's Group row under its customer.
+func (s *customerTotals) add(group Trunk) {
+	customer, ok := s.customers[group.TrunkId]
+	if !ok {
+		return
+	}
+	if s.totals == nil {
+		s.totals = map[string]*customerTotal{}
+	}
+	total := s.totals[customer]
+	if total == nil {
+		total = &customerTotal{}
+		s.totals[customer] = total
+	}
+	orig, _ := strconv.ParseFloat(group.NumOrig, 64)
+	term, _ := strconv.ParseFloat(group.NumTerm, 64)
+	cps, _ := strconv.ParseFloat(group.Cps, 64)
+	total.groups++
+	total.sessions += orig + term
+	total.cps += cps
+}
+
+// collect exports the totals of each customer with trunk groups in the
+// realtime stats.
+func (s *customerTotals) collect(ch chan<- prometheus.Metric) {
+	customers := make([]string, 0, len(s.totals))
+	for customer := range s.totals {
+		customers = append(customers, customer)
+	}
+	sort.Strings(customers)
+	labels := []string{"customer"}
+	for _, customer := range customers {
+		total := s.totals[customer]
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_customer_trunk_groups", "Trunk groups of the customer in the realtime stats.", labels),
+			prometheus.GaugeValue, float64(total.groups), customer)
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_customer_sessions_active", "Originating and terminating sessions of the customer's trunk groups.", labels),
+			prometheus.GaugeValue, total.sessions, customer)
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_customer_cps", "Calls per second of the customer's trunk groups.", labels),
+			prometheus.GaugeValue, total.cps, customer)
+	}
+}
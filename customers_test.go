@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCustomerTotals(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">east</field><field name="fqdn">Group</field><field name="numOrig">50</field><field name="numTerm">35</field><field name="cps">4</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">100</field><field name="alias">east</field><field name="fqdn">10.0.0.1</field><field name="numOrig">50</field><field name="numTerm">35</field><field name="cps">4</field></row>
+<row><field name="trunkId">200</field><field name="alias">west</field><field name="fqdn">Group</field><field name="numOrig">5</field><field name="numTerm">0</field><field name="cps">1.5</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">300</field><field name="alias">other</field><field name="fqdn">Group</field><field name="numOrig">10</field><field name="numTerm">2</field><field name="cps">1</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">400</field><field name="alias">unmapped</field><field name="fqdn">Group</field><field name="numOrig">7</field><field name="numTerm">0</field><field name="cps">3</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger(), customers: map[string]string{"100": "acme", "200": "acme", "300": "globex"}}
+	expected := `
+# TYPE sansay_customer_cps gauge
+sansay_customer_cps{customer="acme"} 5.5
+sansay_customer_cps{customer="globex"} 1
+# TYPE sansay_customer_sessions_active gauge
+sansay_customer_sessions_active{customer="acme"} 90
+sansay_customer_sessions_active{customer="globex"} 12
+# TYPE sansay_customer_trunk_groups gauge
+sansay_customer_trunk_groups{customer="acme"} 2
+sansay_customer_trunk_groups{customer="globex"} 1
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, sansay)
+	}, expected, "sansay_customer_cps", "sansay_customer_sessions_active", "sansay_customer_trunk_groups")
+}
+
+func TestCustomerTotalsUnmapped(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">east</field><field name="fqdn">Group</field><field name="numOrig">50</field><field name="numTerm">35</field><field name="cps">4</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	compareCollection(t, dump, "", "sansay_customer_cps", "sansay_customer_sessions_active", "sansay_customer_trunk_groups")
+}
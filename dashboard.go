@@ -0,0 +1,153 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// grafanaDashboard is the subset of the Grafana dashboard model the
+// generated dashboard uses.
+type grafanaDashboard struct {
+	Title         string            `json:"title"`
+	UID           string            `json:"uid"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Refresh       string            `json:"refresh"`
+	Time          grafanaTimeRange  `json:"time"`
+	Templating    grafanaTemplating `json:"templating"`
+	Panels        []grafanaPanel    `json:"panels"`
+	Tags          []string          `json:"tags"`
+}
+
+type grafanaTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaTemplating struct {
+	List []grafanaVariable `json:"list"`
+}
+
+type grafanaVariable struct {
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Type       string `json:"type"`
+	Query      string `json:"query"`
+	Datasource string `json:"datasource,omitempty"`
+	Refresh    int    `json:"refresh,omitempty"`
+	Multi      bool   `json:"multi,omitempty"`
+	IncludeAll bool   `json:"includeAll,omitempty"`
+}
+
+type grafanaPanel struct {
+	ID          int                `json:"id"`
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Description string             `json:"description,omitempty"`
+	Datasource  string             `json:"datasource"`
+	GridPos     grafanaGridPos     `json:"gridPos"`
+	Targets     []grafanaTarget    `json:"targets"`
+	FieldConfig grafanaFieldConfig `json:"fieldConfig"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+type grafanaFieldConfig struct {
+	Defaults grafanaFieldDefaults `json:"defaults"`
+}
+
+type grafanaFieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+// dashboardPanels are the panels of the generated dashboard, laid out two
+// per row.
+var dashboardPanels = []struct {
+	title, description, typ, unit string
+	targets                       []grafanaTarget
+}{
+	{"Trunk utilization", "Active sessions of each trunk group as a share of its session limit.", "timeseries", "percentunit", []grafanaTarget{
+		{`sum by (instance, trunkgroup, alias) (sansay_trunk_numorig{instance=~"$instance"} + sansay_trunk_numterm{instance=~"$instance"}) / sum by (instance, trunkgroup, alias) (sansay_trunk_totallimit{instance=~"$instance"} > 0)`, "{{instance}} {{alias}}", "A"},
+	}},
+	{"Calls per second", "Call attempts per second of each trunk group.", "timeseries", "short", []grafanaTarget{
+		{`sum by (instance, trunkgroup, alias) (sansay_trunk_cps{instance=~"$instance"})`, "{{instance}} {{alias}}", "A"},
+	}},
+	{"Answer seizure ratio", "Share of the call attempts of the last hour that were answered.", "timeseries", "percentunit", []grafanaTarget{
+		{`sum by (instance, alias, direction) (sansay_trunk_hour_calls{instance=~"$instance",status="answer"}) / sum by (instance, alias, direction) (sansay_trunk_hour_calls{instance=~"$instance",status="attempt"} > 0)`, "{{instance}} {{alias}} {{direction}}", "A"},
+	}},
+	{"CPU usage", "CPU of the SBC in use.", "timeseries", "percent", []grafanaTarget{
+		{`100 - sansay_cpu_idle{instance=~"$instance"}`, "{{instance}} {{node}}", "A"},
+	}},
+	{"HA state", "High availability state of each SBC.", "stat", "", []grafanaTarget{
+		{`sansay_ha_state_info{instance=~"$instance"}`, "{{instance}} {{state}}", "A"},
+	}},
+	{"Media servers", "Sessions on each media server.", "timeseries", "short", []grafanaTarget{
+		{`sansay_mediaserver_sessions{instance=~"$instance"}`, "{{instance}} {{server}}", "A"},
+	}},
+	{"Scrape health", "Whether the target could be scraped, and the downloads skipped for exceeding the scrape deadline.", "timeseries", "short", []grafanaTarget{
+		{`up{instance=~"$instance"}`, "{{instance}} up", "A"},
+		{`sum by (instance) (sansay_scrape_deadline_exceeded{instance=~"$instance"})`, "{{instance}} deadline exceeded", "B"},
+	}},
+	{"Scrape duration", "Time taken to scrape the target.", "timeseries", "s", []grafanaTarget{
+		{`sansay_scrape_duration_seconds{instance=~"$instance"}`, "{{instance}}", "A"},
+	}},
+}
+
+// newDashboard builds the Grafana dashboard of the exporter's metrics.
+func newDashboard(title string) grafanaDashboard {
+	d := grafanaDashboard{
+		Title:         title,
+		UID:           "sansay-exporter",
+		SchemaVersion: 27,
+		Refresh:       "1m",
+		Time:          grafanaTimeRange{From: "now-6h", To: "now"},
+		Tags:          []string{"sansay"},
+		Templating: grafanaTemplating{List: []grafanaVariable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{Name: "instance", Label: "SBC", Type: "query", Query: "label_values(sansay_scrape_duration_seconds, instance)", Datasource: "$datasource", Refresh: 2, Multi: true, IncludeAll: true},
+		}},
+	}
+	for i, p := range dashboardPanels {
+		d.Panels = append(d.Panels, grafanaPanel{
+			ID:          i + 1,
+			Type:        p.typ,
+			Title:       p.title,
+			Description: p.description,
+			Datasource:  "$datasource",
+			GridPos:     grafanaGridPos{H: 8, W: 12, X: 12 * (i % 2), Y: 8 * (i / 2)},
+			Targets:     p.targets,
+			FieldConfig: grafanaFieldConfig{Defaults: grafanaFieldDefaults{Unit: p.unit}},
+		})
+	}
+	return d
+}
+
+// writeDashboard writes the dashboard as JSON ready to import into Grafana.
+func writeDashboard(w io.Writer, title string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newDashboard(title))
+}
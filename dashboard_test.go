@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteDashboard(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeDashboard(&out, "SBCs"); err != nil {
+		t.Fatal(err)
+	}
+	var dashboard grafanaDashboard
+	if err := json.Unmarshal(out.Bytes(), &dashboard); err != nil {
+		t.Fatal(err)
+	}
+	if dashboard.Title != "SBCs" {
+		t.Errorf("Expected title SBCs, received %s", dashboard.Title)
+	}
+	if len(dashboard.Panels) != len(dashboardPanels) {
+		t.Errorf("Expected %d panels, received %d", len(dashboardPanels), len(dashboard.Panels))
+	}
+
+	known := knownMetrics(t)
+	for _, panel := range dashboard.Panels {
+		for _, target := range panel.Targets {
+			checkMetricRefs(t, known, target.Expr)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// descs caches the descriptors of the exported metrics.  The metrics are
+// built from the dumps on every scrape, so without the cache every sample
+// would validate and hash its own copy of the same descriptor.
+var descs = newDescCache()
+
+// descCache holds descriptors by metric name, help and label names.  It is
+// bounded by the metrics the SBCs report, not by the label values.
+type descCache struct {
+	mu    sync.RWMutex
+	descs map[string]*prometheus.Desc
+}
+
+func newDescCache() *descCache {
+	return &descCache{descs: map[string]*prometheus.Desc{}}
+}
+
+// get returns the descriptor of the metric, creating it on first use.
+func (c *descCache) get(name, help string, labels []string) *prometheus.Desc {
+	key := name + "\xff" + help + "\xff" + strings.Join(labels, "\xff")
+	c.mu.RLock()
+	desc, ok := c.descs[key]
+	c.mu.RUnlock()
+	if ok {
+		return desc
+	}
+	desc = prometheus.NewDesc(name, help, labels, nil)
+	c.mu.Lock()
+	c.descs[key] = desc
+	c.mu.Unlock()
+	return desc
+}
+
+// newDesc returns the cached descriptor of the metric.
+func newDesc(name, help string, labels []string) *prometheus.Desc {
+	return descs.get(name, help, labels)
+}
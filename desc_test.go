@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDescCache(t *testing.T) {
+	cache := newDescCache()
+	desc := cache.get("sansay_trunk_sessions", "", []string{"trunkgroup", "alias"})
+	if got := cache.get("sansay_trunk_sessions", "", []string{"trunkgroup", "alias"}); got != desc {
+		t.Errorf("Expected the cached descriptor to be reused")
+	}
+	if got := cache.get("sansay_trunk_sessions", "", []string{"trunkgroup"}); got == desc {
+		t.Errorf("Expected a different descriptor for different label names")
+	}
+	if got := cache.get("sansay_trunk_sessions", "Sessions.", []string{"trunkgroup", "alias"}); got == desc {
+		t.Errorf("Expected a different descriptor for different help")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// runDiff scrapes the target twice, interval apart, and writes the series
+// that changed between the scrapes.
+func runDiff(w io.Writer, c collector, interval time.Duration) error {
+	before, err := scrapeSeries(c)
+	if err != nil {
+		return err
+	}
+	time.Sleep(interval)
+	after, err := scrapeSeries(c)
+	if err != nil {
+		return err
+	}
+	changes := diffSeries(before, after)
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "No metrics changed in %s\n", interval)
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Fprintln(w, change)
+	}
+	return nil
+}
+
+// scrapeSeries scrapes the target and returns the value of each series.
+func scrapeSeries(c collector) (map[string]float64, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	series := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			default:
+				continue
+			}
+			series[seriesName(family.GetName(), m.Label)] = value
+		}
+	}
+	return series, nil
+}
+
+// seriesName formats a series as in the exposition format.
+func seriesName(name string, labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l.GetName(), l.GetValue()))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// diffSeries describes the series that changed, appeared or disappeared
+// between two scrapes, sorted by series.
+func diffSeries(before, after map[string]float64) []string {
+	var changes []string
+	for name, value := range after {
+		old, ok := before[name]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s new %g", name, value))
+		case value != old:
+			changes = append(changes, fmt.Sprintf("%s %g -> %g (%+g)", name, old, value, value-old))
+		}
+	}
+	for name, value := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, fmt.Sprintf("%s gone (was %g)", name, value))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
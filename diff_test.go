@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSeries(t *testing.T) {
+	before := map[string]float64{
+		`sansay_trunk_numorig{alias="a",trunkgroup="1"}`: 3,
+		`sansay_trunk_numterm{alias="a",trunkgroup="1"}`: 2,
+		`sansay_cpu_idle`: 90,
+	}
+	after := map[string]float64{
+		`sansay_trunk_numorig{alias="a",trunkgroup="1"}`:        5,
+		`sansay_trunk_numterm{alias="a",trunkgroup="1"}`:        2,
+		`sansay_alarm_active{category="link",severity="major"}`: 1,
+	}
+	expected := []string{
+		`sansay_alarm_active{category="link",severity="major"} new 1`,
+		`sansay_cpu_idle gone (was 90)`,
+		`sansay_trunk_numorig{alias="a",trunkgroup="1"} 3 -> 5 (+2)`,
+	}
+	if got := diffSeries(before, after); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, received %q", expected, got)
+	}
+	if got := diffSeries(before, before); len(got) != 0 {
+		t.Errorf("Expected no changes, received %q", got)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// explainTimeout bounds each download of the explain command.
+const explainTimeout = 30 * time.Second
+
+// explanation describes how a dump field is turned into a metric, or why it
+// is dropped.
+type explanation struct {
+	field  string
+	role   string
+	metric string
+	typ    string
+	labels string
+	help   string
+}
+
+// family is a metric family created from a dump.
+type family struct {
+	typ    string
+	help   string
+	labels []string
+	series map[string]float64
+}
+
+// explainSansay explains each field of the dump's tables.  The metrics a
+// field contributes to are found by processing each table again with the
+// field's values altered: the field is the value of the metrics whose values
+// change, a label of those whose series change, and required by those that
+// vanish.  Fields whose altered values change nothing are tried once more
+// without the field.
+func (c collector) explainSansay(sansay Sansay) []explanation {
+	var explanations []explanation
+	for i, table := range sansay.Database.Table {
+		base := c.explainMetrics(sansay, i, nil)
+		for _, field := range tableFields(table) {
+			name := table.Name + "." + field
+			altered := c.explainMetrics(sansay, i, func(f Field) (Field, bool) {
+				if f.Name == field {
+					f.Text = alterValue(f.Text)
+				}
+				return f, true
+			})
+			removed := c.explainMetrics(sansay, i, func(f Field) (Field, bool) {
+				return f, f.Name != field
+			})
+			var found []explanation
+			for metric, f := range base {
+				role := fieldRole(f, altered[metric])
+				if role == "" {
+					role = fieldRole(f, removed[metric])
+				}
+				if role == "" {
+					continue
+				}
+				found = append(found, explanation{name, role, metric, f.typ, strings.Join(f.labels, ","), f.help})
+			}
+			if len(found) == 0 {
+				found = append(found, explanation{field: name, role: "dropped", help: dropReason(table, field, base)})
+			}
+			sort.Slice(found, func(i, j int) bool { return found[i].metric < found[j].metric })
+			explanations = append(explanations, found...)
+		}
+	}
+	return explanations
+}
+
+// alterValue returns a different value of the same kind.
+func alterValue(value string) string {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(f*2+1, 'g', -1, 64)
+	}
+	return value + "_"
+}
+
+// explainMetrics returns the metrics created from the dump's table, with its
+// fields passed through edit if it isn't nil.  Fields edit returns false for
+// are left out.
+func (c collector) explainMetrics(sansay Sansay, table int, edit func(Field) (Field, bool)) map[string]*family {
+	t := sansay.Database.Table[table]
+	if edit != nil {
+		rows := make([]Row, len(t.Row))
+		for i, row := range t.Row {
+			rows[i] = Row{Text: row.Text}
+			for _, field := range row.Field {
+				if field, ok := edit(field); ok {
+					rows[i].Field = append(rows[i].Field, field)
+				}
+			}
+		}
+		t.Row = rows
+	}
+	single := sansay
+	single.Database.Table = []Table{t}
+	// Trackers are fresh, so interval and TCD rows are always counted.
+	c.intervals, c.tcd = newIntervalTracker(), newTCDTracker()
+	return gatherFamilies(func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, single)
+		c.intervals.collect(ch, c.target, false)
+		c.tcd.collect(ch, c.target)
+	})
+}
+
+// timeDependent are the metrics that change with the time they are created.
+var timeDependent = map[string]bool{
+	"sansay_stats_age_seconds": true,
+}
+
+// schemaMetrics describe the fields of a dump rather than export them.
+var schemaMetrics = map[string]bool{
+	"sansay_unknown_fields":       true,
+	"sansay_parse_tables":         true,
+	"sansay_parse_rows":           true,
+	"sansay_parse_fields":         true,
+	"sansay_parse_fields_skipped": true,
+	"sansay_parse_partial":        true,
+}
+
+// gatherFamilies returns the metric families collect creates.  Invalid, time
+// dependent and schema metrics are left out.
+func gatherFamilies(collect func(ch chan<- prometheus.Metric)) map[string]*family {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsFunc(collect))
+	// Gather returns the valid families along with any errors.
+	gathered, _ := registry.Gather()
+	families := map[string]*family{}
+	for _, mf := range gathered {
+		if timeDependent[mf.GetName()] || schemaMetrics[mf.GetName()] {
+			continue
+		}
+		f := &family{typ: strings.ToLower(mf.GetType().String()), help: mf.GetHelp(), series: map[string]float64{}}
+		labels := map[string]bool{}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				labels[l.GetName()] = true
+			}
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			}
+			f.series[seriesName(mf.GetName(), m.Label)] = value
+		}
+		for l := range labels {
+			f.labels = append(f.labels, l)
+		}
+		sort.Strings(f.labels)
+		families[mf.GetName()] = f
+	}
+	return families
+}
+
+// metricsFunc adapts a function emitting metrics to an unchecked
+// prometheus.Collector.
+type metricsFunc func(ch chan<- prometheus.Metric)
+
+func (f metricsFunc) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f metricsFunc) Collect(ch chan<- prometheus.Metric) { f(ch) }
+
+// fieldRole returns the role of a field in a metric family, given the family
+// with and without the field, or "" if the field doesn't affect it.
+func fieldRole(with, without *family) string {
+	if without == nil || len(without.series) < len(with.series) {
+		return "required"
+	}
+	sameSeries := true
+	for series := range with.series {
+		if _, ok := without.series[series]; !ok {
+			sameSeries = false
+			break
+		}
+	}
+	if !sameSeries {
+		return "label"
+	}
+	for series, value := range with.series {
+		if without.series[series] != value {
+			return "value"
+		}
+	}
+	return ""
+}
+
+// dropReason explains why a field contributes to no metric.
+func dropReason(table Table, field string, base map[string]*family) string {
+	if len(base) == 0 {
+		return "table is not exported"
+	}
+	numeric := false
+	for _, row := range table.Row {
+		if value, ok := row.Fields()[field]; ok {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				numeric = true
+			}
+		}
+	}
+	if !numeric {
+		return "value is not numeric"
+	}
+	return "field is not exported"
+}
+
+// tableFields returns the names of the table's fields in the order they
+// first appear.
+func tableFields(table Table) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, row := range table.Row {
+		for _, field := range row.Field {
+			if !seen[field.Name] {
+				seen[field.Name] = true
+				names = append(names, field.Name)
+			}
+		}
+	}
+	return names
+}
+
+// explainResult explains a download.  Downloads other than table dumps have
+// a fixed layout, so only the metrics they create are listed.
+func (c collector) explainResult(path string, obj interface{}) []explanation {
+	if sansay, ok := obj.(Sansay); ok {
+		return c.explainSansay(sansay)
+	}
+	var explanations []explanation
+	families := gatherFamilies(func(ch chan<- prometheus.Metric) {
+		c.processResult(ch, obj)
+	})
+	for metric, f := range families {
+		explanations = append(explanations, explanation{path, "fixed", metric, f.typ, strings.Join(f.labels, ","), f.help})
+	}
+	sort.Slice(explanations, func(i, j int) bool { return explanations[i].metric < explanations[j].metric })
+	return explanations
+}
+
+// explainTarget downloads the paths from the target and explains them.
+func (c collector) explainTarget(paths []string) ([]explanation, error) {
+	var explanations []explanation
+	for _, path := range paths {
+		var wg sync.WaitGroup
+		result := make(chan interface{}, 1)
+		wg.Add(1)
+		pc := c
+		if c.timeout > 0 {
+			pc = c.withTimeout(c.timeout)
+		}
+		ScrapeTarget(pc, path, result, &wg)
+		obj := <-result
+		if err, ok := obj.(error); ok {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		explanations = append(explanations, c.explainResult(path, obj)...)
+	}
+	return explanations, nil
+}
+
+// printExplanations writes the explanations as a table.
+func printExplanations(w io.Writer, explanations []explanation) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tROLE\tMETRIC\tTYPE\tLABELS\tHELP")
+	for _, e := range explanations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.field, e.role, dash(e.metric), dash(e.typ), dash(e.labels), e.help)
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// explainDump explains the saved dump in file, as downloaded from path.
+func explainDump(file, path string) ([]explanation, error) {
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := parseSansay(path, body)
+	if err != nil {
+		return nil, err
+	}
+	c := collector{logger: log.NewNopLogger()}
+	return c.explainResult(path, obj), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestExplainSansay(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="system_stat"><row><field name="cpu_idle">90</field><field name="ha_pre_state">active</field><field name="node_id">1</field></row></table>
+<table name="unknown_stat"><row><field name="calls">3</field></row></table>
+</database></mysqldump>`
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger()}
+	explanations := map[string]explanation{}
+	for _, e := range c.explainSansay(sansay) {
+		explanations[e.field+" "+e.metric] = e
+	}
+
+	expected := []explanation{
+		{field: "system_stat.cpu_idle", role: "value", metric: "sansay_cpu_idle", typ: "gauge", labels: "node"},
+		{field: "system_stat.node_id", role: "label", metric: "sansay_cpu_idle", typ: "gauge", labels: "node"},
+		{field: "system_stat.ha_pre_state", role: "dropped", help: "value is not numeric"},
+		{field: "unknown_stat.calls", role: "dropped", help: "table is not exported"},
+	}
+	for _, e := range expected {
+		if got := explanations[e.field+" "+e.metric]; got != e {
+			t.Errorf("Expected %+v, received %+v", e, got)
+		}
+	}
+	if len(explanations) != len(expected) {
+		t.Errorf("Expected %d explanations, received %v", len(expected), explanations)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrapeOutcome counts the downloads of a scrape that were processed and
+// those that failed.
+type scrapeOutcome struct {
+	mu        sync.Mutex
+	succeeded int
+	failed    int
+}
+
+// record counts a processed download, failed if err is not nil.
+func (o *scrapeOutcome) record(err error) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err != nil {
+		o.failed++
+	} else {
+		o.succeeded++
+	}
+}
+
+// total reports whether every download of the scrape failed.
+func (o *scrapeOutcome) total() bool {
+	if o == nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.failed > 0 && o.succeeded == 0
+}
+
+// failOnGatherer decides which scrape errors fail the probe with HTTP 500,
+// as selected by --scrape.fail-on: any error, only a total failure of the
+// scrape, or never.  Errors that don't fail the probe are dropped, serving
+// the rest of the series.
+type failOnGatherer struct {
+	prometheus.Gatherer
+	failOn  string
+	outcome *scrapeOutcome
+}
+
+// Gather implements prometheus.Gatherer.
+func (g failOnGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	if err == nil {
+		return families, nil
+	}
+	switch g.failOn {
+	case "never":
+		return families, nil
+	case "total":
+		if !g.outcome.total() {
+			return families, nil
+		}
+	}
+	return families, err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestHandlerFailOn(t *testing.T) {
+	defer func(f string) { *failOn = f }(*failOn)
+	partial := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "stats/realtime") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`<mysqldump><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table></database></mysqldump>`))
+	}))
+	defer partial.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	for _, tt := range []struct {
+		failOn     string
+		server     *httptest.Server
+		wantStatus int
+	}{
+		{"any", partial, http.StatusInternalServerError},
+		{"any", down, http.StatusInternalServerError},
+		{"total", partial, http.StatusOK},
+		{"total", down, http.StatusInternalServerError},
+		{"never", down, http.StatusOK},
+	} {
+		*failOn = tt.failOn
+		target := strings.TrimPrefix(tt.server.URL, "http://")
+		conf := &Config{Targets: map[string]*Target{target: {Protocol: "http"}}}
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/sansay?target="+target, nil), conf, nil, log.NewNopLogger())
+		if w.Code != tt.wantStatus {
+			t.Errorf("Expected HTTP %d with --scrape.fail-on=%s, received %d: %s", tt.wantStatus, tt.failOn, w.Code, w.Body.String())
+		}
+		if tt.failOn == "total" && tt.server == partial && !strings.Contains(w.Body.String(), "sansay_cpu_idle 90") {
+			t.Errorf("Expected the partial scrape's series, received %s", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fuzzPaths are the paths dumps are downloaded from.  The fuzzed bodies are
+// processed as a dump of one of them, the path itself not coming from the SBC.
+var fuzzPaths = append([]string{"stats/system", "stats/interval", "download/tcd"}, scrapePaths...)
+
+// FuzzParseSansay runs arbitrary bodies through parsing and metric creation,
+// which must fail with an error rather than panic on malformed dumps.
+func FuzzParseSansay(f *testing.F) {
+	for _, d := range malformedDumps {
+		for i, path := range fuzzPaths {
+			if path == d.path {
+				f.Add(uint8(i), d.body)
+			}
+		}
+	}
+
+	c := collector{logger: log.NewNopLogger()}
+	f.Fuzz(func(t *testing.T, path uint8, body []byte) {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.processDump(ch, fuzzPaths[int(path)%len(fuzzPaths)], body)
+			close(ch)
+		}()
+		for range ch {
+		}
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// processGenericTable exports the numeric fields of a table the exporter
+// doesn't know of as sansay_<table>_<field>, so data of new firmware is
+// visible before the exporter supports it.  The non-numeric fields label the
+// rows, and rows whose labels repeat an earlier row's are left out.
+func (c collector) processGenericTable(ch chan<- prometheus.Metric, table Table) {
+	numeric := map[string]bool{}
+	var names []string
+	for _, row := range table.Row {
+		for _, field := range row.Field {
+			if field.Name == "" {
+				continue
+			}
+			isNumber, seen := numeric[field.Name]
+			if !seen {
+				names = append(names, field.Name)
+				isNumber = true
+			}
+			if strings.TrimSpace(field.Text) != "" {
+				if _, err := strconv.ParseFloat(strings.TrimSpace(field.Text), 64); err != nil {
+					isNumber = false
+				}
+			}
+			numeric[field.Name] = isNumber
+		}
+	}
+	var labelFields, valueFields, labels []string
+	for _, name := range names {
+		if numeric[name] && !isNodeField(name) {
+			valueFields = append(valueFields, name)
+		} else {
+			labelFields = append(labelFields, name)
+		}
+	}
+	sort.Strings(labelFields)
+	for _, name := range labelFields {
+		label := invalidNameChars.ReplaceAllString(name, "_")
+		if isNodeField(name) {
+			label = "node"
+		}
+		labels = append(labels, label)
+	}
+	if hasDuplicates(labels) {
+		// Distinct fields sanitize to the same label name.
+		return
+	}
+
+	prefix := "sansay_" + invalidNameChars.ReplaceAllString(strings.ToLower(table.Name), "_") + "_"
+	seen := map[string]bool{}
+	for _, row := range table.Row {
+		fields := row.Fields()
+		labelValues := make([]string, 0, len(labelFields))
+		for _, name := range labelFields {
+			labelValues = append(labelValues, fields[name])
+		}
+		key := strings.Join(labelValues, "\xff")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		for _, name := range valueFields {
+			value, err := strconv.ParseFloat(strings.TrimSpace(fields[name]), 64)
+			if err != nil {
+				continue
+			}
+			metric, err := prometheus.NewConstMetric(
+				newDesc(prefix+invalidNameChars.ReplaceAllString(strings.ToLower(name), "_"), "Field of a table the exporter doesn't know of.", labels),
+				prometheus.GaugeValue, value, labelValues...)
+			if err != nil {
+				continue
+			}
+			ch <- metric
+		}
+	}
+}
+
+// hasDuplicates reports whether names repeat.
+func hasDuplicates(names []string) bool {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			return true
+		}
+		seen[name] = true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGenericTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="sip_trunk_health">
+<row><field name="peer">carrier-a</field><field name="node_id">1</field><field name="latency">12.5</field><field name="up">1</field></row>
+<row><field name="peer">carrier-b</field><field name="node_id">1</field><field name="latency"></field><field name="up">0</field></row>
+<row><field name="peer">carrier-b</field><field name="node_id">1</field><field name="latency">3</field><field name="up">1</field></row>
+</table>
+<table name="system_stat">
+<row><field name="cpu_idle">90</field></row>
+</table>
+</database></mysqldump>`
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger(), unknownTables: true}
+	expected := `
+# TYPE sansay_sip_trunk_health_latency gauge
+sansay_sip_trunk_health_latency{node="1",peer="carrier-a"} 12.5
+# TYPE sansay_sip_trunk_health_up gauge
+sansay_sip_trunk_health_up{node="1",peer="carrier-a"} 1
+sansay_sip_trunk_health_up{node="1",peer="carrier-b"} 0
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, sansay)
+	}, expected, "sansay_sip_trunk_health_latency", "sansay_sip_trunk_health_up", "sansay_system_stat_cpu_idle")
+
+	// Unknown tables are not exported by default.
+	c.unknownTables = false
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, sansay)
+	}, "", "sansay_sip_trunk_health_latency", "sansay_sip_trunk_health_up")
+}
@@ -1,16 +1,17 @@
 module github.com/magna5/sansay_exporter
 
 require (
+	filippo.io/age v1.0.0
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
-	github.com/alecthomas/units v0.0.0-20190717042225-c3de453c63f4 // indirect
-	github.com/go-kit/kit v0.8.0
+	github.com/go-kit/log v0.1.0
 	github.com/hooklift/gowsdl v0.4.0
 	github.com/jarcoal/httpmock v1.0.4
-	github.com/pkg/errors v0.8.1 // indirect
-	github.com/prometheus/client_golang v1.0.0
-	github.com/prometheus/common v0.6.0
-	golang.org/x/sys v0.0.0-20200107162124-548cf772de50 // indirect
+	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.26.0
+	golang.org/x/sys v0.0.0-20210903071746-97244b99971b
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 go 1.13
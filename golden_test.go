@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata/golden.")
+
+// goldenPath returns the path a fixture dump was downloaded from, which is
+// its file name with the first "_" standing in for "/".
+func goldenPath(file string) string {
+	return strings.Replace(strings.TrimSuffix(filepath.Base(file), ".xml"), "_", "/", 1)
+}
+
+// TestGolden runs the dumps saved in each testdata/golden directory through
+// the collection pipeline and compares the result with the directory's
+// metrics.prom.  Run with -update to regenerate the golden files after an
+// intended change.
+func TestGolden(t *testing.T) {
+	dirs, err := filepath.Glob("testdata/golden/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			got := goldenMetrics(t, dir)
+			golden := filepath.Join(dir, "metrics.prom")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Metrics differ from %s, run go test -run TestGolden -update if the change is intended.\nwant:\n%s\ngot:\n%s", golden, want, got)
+			}
+		})
+	}
+}
+
+// goldenMetrics returns the exposition text of the dumps in dir.
+func goldenMetrics(t *testing.T, dir string) []byte {
+	t.Helper()
+	dumps, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := collector{target: filepath.Base(dir), logger: log.NewNopLogger(), intervals: newIntervalTracker(), tcd: newTCDTracker(), anomalies: newAnomalyCounter()}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		for _, dump := range dumps {
+			body, err := ioutil.ReadFile(dump)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if err := c.processDump(ch, goldenPath(dump), body); err != nil {
+				t.Errorf("Error processing %s: %s", dump, err)
+			}
+		}
+		c.intervals.collect(ch, c.target, false)
+		c.tcd.collect(ch, c.target)
+	}))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	for _, family := range families {
+		if !timeDependent[family.GetName()] {
+			expfmt.MetricFamilyToText(&out, family)
+		}
+	}
+	return out.Bytes()
+}
+
+// knownMetrics returns the names of the metrics in the golden files and those
+// every scrape adds.
+func knownMetrics(t *testing.T) map[string]bool {
+	t.Helper()
+	known := map[string]bool{
+		"sansay_scrape_duration_seconds":        true,
+		"sansay_scrape_deadline_exceeded":       true,
+		"sansay_scrape_content_unchanged_total": true,
+		"sansay_stats_age_seconds":              true,
+	}
+	files, err := filepath.Glob("testdata/golden/*/metrics.prom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(text), "\n") {
+			if fields := strings.Fields(line); len(fields) > 2 && fields[1] == "TYPE" {
+				known[fields[2]] = true
+			}
+		}
+	}
+	return known
+}
+
+// metricRefs matches the exporter's metric names in PromQL expressions.
+var metricRefs = regexp.MustCompile(`\bsansay_[a-z0-9_]+`)
+
+// checkMetricRefs fails the test for each metric expr refers to that the
+// exporter doesn't create.
+func checkMetricRefs(t *testing.T, known map[string]bool, expr string) {
+	t.Helper()
+	for _, name := range metricRefs.FindAllString(expr, -1) {
+		if !known[name] {
+			t.Errorf("Unknown metric %s in %s", name, expr)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// defaultHACompare are the metrics compared with a target's HA peer if the
+// target doesn't list its own.
+var defaultHACompare = []string{"sansay_sessions_active", "sansay_cps", "sansay_trunk_groups"}
+
+// haGatherer gathers a target's HA peer alongside the target, and adds how
+// far the sums of the compared metrics diverge between them.  The state
+// tables of a healthy pair agree, so a growing divergence points to broken
+// state replication.
+type haGatherer struct {
+	prometheus.Gatherer
+	// peer gathers the HA peer, nil if it couldn't be set up.
+	peer    prometheus.Gatherer
+	compare []string
+	// labels are the target's metadata labels.
+	labels prometheus.Labels
+}
+
+// newHAGatherer returns g with the HA peer of target gathered alongside it,
+// from the peer's last background poll if it is polled, otherwise by scraping
+// the peer's paths within timeout.
+func newHAGatherer(g prometheus.Gatherer, conf *Config, target, module string, paths []string, timeout time.Duration, poller *poller, logger log.Logger) haGatherer {
+	targetConf := conf.Target(target)
+	h := haGatherer{Gatherer: g, compare: targetConf.HACompare, labels: conf.TargetLabels(target)}
+	if len(h.compare) == 0 {
+		h.compare = defaultHACompare
+	}
+	peer := targetConf.HAPeer
+	registry := prometheus.NewRegistry()
+	if cached, ok := poller.result(peer, module); ok {
+		registry.MustRegister(cached)
+	} else {
+		c, err := newCollector(peer, conf.Target(peer), nil, log.With(logger, "ha_peer", peer))
+		if err != nil {
+			level.Error(logger).Log("msg", "Error creating client for HA peer", "ha_peer", peer, "err", err)
+			return h
+		}
+		c.paths = paths
+		c.downloads = downloads
+		c.timeout = timeout
+		registry.MustRegister(c)
+	}
+	h.peer = registry
+	return h
+}
+
+// Gather implements prometheus.Gatherer.
+func (g haGatherer) Gather() ([]*dto.MetricFamily, error) {
+	var peerFamilies []*dto.MetricFamily
+	var peerErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if g.peer != nil {
+			peerFamilies, peerErr = g.peer.Gather()
+		}
+	}()
+	families, err := g.Gatherer.Gather()
+	<-done
+
+	local := sumFamilies(families)
+	peer := sumFamilies(peerFamilies)
+	up := 0.0
+	if g.peer != nil && peerErr == nil {
+		up = 1
+	}
+	registry := prometheus.NewRegistry()
+	prometheus.WrapRegistererWith(g.labels, registry).MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_ha_peer_up", "Whether the HA peer was scraped without errors.", nil),
+			prometheus.GaugeValue, up)
+		for _, name := range g.compare {
+			l, ok := local[name]
+			if !ok {
+				continue
+			}
+			p, ok := peer[name]
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_ha_peer_value", "Sum of the series of the metric on the HA peer.", []string{"metric"}),
+				prometheus.GaugeValue, p, name)
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_ha_divergence", "Sum of the series of the metric on the SBC minus that on its HA peer.", []string{"metric"}),
+				prometheus.GaugeValue, l-p, name)
+		}
+	}))
+	ha, haErr := registry.Gather()
+	if err == nil {
+		err = haErr
+	}
+	families = append(families, ha...)
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	return families, err
+}
+
+// sumFamilies returns the sum of the values of the series of each counter,
+// gauge and untyped family.
+func sumFamilies(families []*dto.MetricFamily) map[string]float64 {
+	sums := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			switch {
+			case m.Gauge != nil:
+				sums[family.GetName()] += m.Gauge.GetValue()
+			case m.Counter != nil:
+				sums[family.GetName()] += m.Counter.GetValue()
+			case m.Untyped != nil:
+				sums[family.GetName()] += m.Untyped.GetValue()
+			}
+		}
+	}
+	return sums
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandlerHADivergence(t *testing.T) {
+	conf := &Config{Targets: map[string]*Target{
+		"sbc1": {HAPeer: "sbc2", Metadata: map[string]string{"site": "dal1"}},
+		"sbc2": {},
+	}, MetadataLabels: []*RelabelConfig{{SourceLabels: []string{"site"}, TargetLabel: "site"}}}
+	for _, m := range conf.MetadataLabels {
+		if err := validateMetadataLabel(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	p.results[pollKey{target: "sbc1"}] = &pollResult{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(newDesc("sansay_sessions_active", "Sessions", nil), prometheus.GaugeValue, 120),
+		prometheus.MustNewConstMetric(newDesc("sansay_cps", "Calls per second", nil), prometheus.GaugeValue, 4),
+	}}
+	p.results[pollKey{target: "sbc2"}] = &pollResult{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(newDesc("sansay_sessions_active", "Sessions", nil), prometheus.GaugeValue, 117),
+	}}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/sansay?target=sbc1", nil), conf, p, log.NewNopLogger())
+	body := w.Body.String()
+	for _, want := range []string{
+		"\nsansay_ha_peer_up{site=\"dal1\"} 1\n",
+		"\nsansay_ha_divergence{metric=\"sansay_sessions_active\",site=\"dal1\"} 3\n",
+		"\nsansay_ha_peer_value{metric=\"sansay_sessions_active\",site=\"dal1\"} 117\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q, received %s", want, body)
+		}
+	}
+	// The peer doesn't report calls per second, which can't be compared.
+	if strings.Contains(body, `metric="sansay_cps"`) {
+		t.Errorf("Expected no divergence of a metric missing on the peer, received %s", body)
+	}
+}
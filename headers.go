@@ -0,0 +1,67 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// summaryGatherer sets the X-Sansay-Scrape-Duration (in seconds since start)
+// and X-Sansay-Series-Count headers of the probe response once its series are
+// gathered, before the body is written, so a scrape can be checked with
+// curl -I or curl -D - without reading the body.
+type summaryGatherer struct {
+	prometheus.Gatherer
+	header http.Header
+	start  time.Time
+}
+
+// Gather implements prometheus.Gatherer.
+func (g summaryGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	g.header.Set("X-Sansay-Scrape-Duration", strconv.FormatFloat(time.Since(g.start).Seconds(), 'f', 3, 64))
+	g.header.Set("X-Sansay-Series-Count", strconv.Itoa(seriesCount(families)))
+	return families, err
+}
+
+// seriesCount returns the number of series the families are exposed as,
+// counting the quantiles, buckets, sum and count of summaries and
+// histograms.
+func seriesCount(families []*dto.MetricFamily) int {
+	n := 0
+	for _, family := range families {
+		for _, m := range family.Metric {
+			switch {
+			case m.Summary != nil:
+				n += len(m.Summary.Quantile) + 2
+			case m.Histogram != nil:
+				buckets := m.Histogram.Bucket
+				n += len(buckets) + 2
+				// The +Inf bucket is implicit unless given.
+				if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+					n++
+				}
+			default:
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandlerSummaryHeaders(t *testing.T) {
+	conf := &Config{Targets: map[string]*Target{"sbc1": {}}}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	p.results[pollKey{target: "sbc1"}] = &pollResult{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(newDesc("sansay_system_cpu_idle", "CPU idle", nil), prometheus.GaugeValue, 90),
+		prometheus.MustNewConstMetric(newDesc("sansay_system_cpu_busy", "CPU busy", nil), prometheus.GaugeValue, 10),
+	}}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/sansay?target=sbc1", nil), conf, p, log.NewNopLogger())
+	// The two series, and the exporter's build info.
+	if got := w.Header().Get("X-Sansay-Series-Count"); got != "3" {
+		t.Errorf("Expected a series count of 3, received %q", got)
+	}
+	if d, err := strconv.ParseFloat(w.Header().Get("X-Sansay-Scrape-Duration"), 64); err != nil || d < 0 {
+		t.Errorf("Expected a scrape duration, received %q", w.Header().Get("X-Sansay-Scrape-Duration"))
+	}
+}
+
+func TestSeriesCount(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "h", Buckets: []float64{1, 2}})
+	s := prometheus.NewSummary(prometheus.SummaryOpts{Name: "s", Objectives: map[float64]float64{0.5: 0.05}})
+	registry.MustRegister(h, s, prometheus.NewGauge(prometheus.GaugeOpts{Name: "g"}))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 buckets, sum and count; a quantile, sum and count; the gauge.
+	if got := seriesCount(families); got != 9 {
+		t.Errorf("Expected 9 series, received %d", got)
+	}
+}
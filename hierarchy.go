@@ -0,0 +1,42 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trunkParentFields are the realtime trunk Group row fields that may hold the
+// trunk group a subgroup belongs to, on firmware with trunk group hierarchies.
+var trunkParentFields = []string{"parentTrunkId", "parentTrunkGroup", "parentGroupId", "parentGroup", "parentId"}
+
+// addParentMetric exports the parent of a trunk group's Group row, if it is a
+// subgroup, as a mapping to join the trunk group's series with so child
+// trunk groups can be summed into their parent's capacity pool.
+func addParentMetric(ch chan<- prometheus.Metric, group Trunk, fields map[string]string) {
+	parent := firstField(fields, trunkParentFields...)
+	if parent == "" || parent == "0" || parent == group.TrunkId {
+		return
+	}
+	labels := []string{"trunkgroup", "parent"}
+	labelValues := []string{group.TrunkId, parent}
+	if group.Node != "" {
+		labels = append(labels, "node")
+		labelValues = append(labelValues, group.Node)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_trunk_parent", "Parent trunk group of a trunk group that is a subgroup, always 1.", labels),
+		prometheus.GaugeValue,
+		1, labelValues...)
+}
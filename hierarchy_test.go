@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestTrunkParent(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="fqdn">Group</field><field name="numOrig">0</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">101</field><field name="fqdn">Group</field><field name="numOrig">0</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field><field name="parentTrunkId">100</field></row>
+<row><field name="trunkId">101</field><field name="fqdn">10.0.0.1</field><field name="parentTrunkId">100</field></row>
+<row><field name="trunkId">102</field><field name="fqdn">Group</field><field name="numOrig">0</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field><field name="parentGroup">100</field><field name="node_id">2</field></row>
+<row><field name="trunkId">103</field><field name="fqdn">Group</field><field name="numOrig">0</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field><field name="parentTrunkId">0</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_trunk_parent gauge
+sansay_trunk_parent{parent="100",trunkgroup="101"} 1
+sansay_trunk_parent{node="2",parent="100",trunkgroup="102"} 1
+`
+	compareCollection(t, dump, expected, "sansay_trunk_parent")
+}
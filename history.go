@@ -0,0 +1,160 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrapeRecord is the outcome of a scrape of a target.
+type scrapeRecord struct {
+	Time     time.Time `json:"time"`
+	Module   string    `json:"module,omitempty"`
+	Source   string    `json:"source"`
+	Duration float64   `json:"duration_seconds"`
+	Series   int       `json:"series"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// maxHistorySize caps the records kept per target, whatever
+// --scrape.history-size asks for.
+const maxHistorySize = 1000
+
+// scrapeHistory keeps the last outcomes of the scrapes of each target, so
+// failures during the night can be looked into the next morning.
+type scrapeHistory struct {
+	size int
+
+	mu      sync.Mutex
+	targets map[string][]scrapeRecord
+	// next is where each target's following record goes once its buffer is
+	// full.
+	next map[string]int
+}
+
+func newScrapeHistory(size int) *scrapeHistory {
+	if size > maxHistorySize {
+		size = maxHistorySize
+	}
+	return &scrapeHistory{size: size, targets: map[string][]scrapeRecord{}, next: map[string]int{}}
+}
+
+// record adds the outcome of a scrape of target, overwriting its oldest once
+// the target has size records.
+func (h *scrapeHistory) record(target string, r scrapeRecord) {
+	if h == nil || h.size <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := h.targets[target]
+	if len(records) < h.size {
+		h.targets[target] = append(records, r)
+		return
+	}
+	records[h.next[target]] = r
+	h.next[target] = (h.next[target] + 1) % h.size
+}
+
+// forget drops the records of target, once it is no longer configured.
+func (h *scrapeHistory) forget(target string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.targets, target)
+	delete(h.next, target)
+}
+
+// records returns the records of target, oldest first.
+func (h *scrapeHistory) records(target string) []scrapeRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := h.targets[target]
+	next := h.next[target]
+	return append(append([]scrapeRecord{}, records[next:]...), records[:next]...)
+}
+
+// ServeHTTP writes the records of the target given by the target parameter,
+// or of every target, as JSON keyed by target.
+func (h *scrapeHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var targets []string
+	if target := r.URL.Query().Get("target"); target != "" {
+		targets = []string{target}
+	} else {
+		h.mu.Lock()
+		for target := range h.targets {
+			targets = append(targets, target)
+		}
+		h.mu.Unlock()
+		sort.Strings(targets)
+	}
+	result := map[string][]scrapeRecord{}
+	for _, target := range targets {
+		result[target] = h.records(target)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// historyGatherer records the outcome of the scrape its gatherer runs.
+type historyGatherer struct {
+	prometheus.Gatherer
+	history *scrapeHistory
+	target  string
+	module  string
+	start   time.Time
+}
+
+// Gather implements prometheus.Gatherer.
+func (g historyGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	r := scrapeRecord{
+		Time:     g.start,
+		Module:   g.module,
+		Source:   "probe",
+		Duration: time.Since(g.start).Seconds(),
+		Series:   seriesCount(families),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	g.history.record(g.target, r)
+	return families, err
+}
+
+// pollRecord returns the outcome of a background poll that started at start
+// and collected metrics, the invalid ones being its errors.
+func pollRecord(module string, start time.Time, metrics []prometheus.Metric) scrapeRecord {
+	r := scrapeRecord{Time: start, Module: module, Source: "poll", Duration: time.Since(start).Seconds()}
+	var errs []string
+	for _, m := range metrics {
+		if err := m.Write(&dto.Metric{}); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		r.Series++
+	}
+	r.Error = strings.Join(errs, "; ")
+	return r
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeHistoryRing(t *testing.T) {
+	h := newScrapeHistory(3)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		h.record("sbc1", scrapeRecord{Time: start.Add(time.Duration(i) * time.Minute), Series: i})
+	}
+	records := h.records("sbc1")
+	if len(records) != 3 {
+		t.Fatalf("Expected the last 3 records, received %d", len(records))
+	}
+	for i, r := range records {
+		if r.Series != i+2 {
+			t.Errorf("Expected record %d to be scrape %d, received %d", i, i+2, r.Series)
+		}
+	}
+	if records := newScrapeHistory(0); len(records.targets) != 0 {
+		t.Error("Expected no records with a size of 0")
+	}
+	if h := newScrapeHistory(1e6); h.size != maxHistorySize {
+		t.Errorf("Expected the size to be capped at %d, received %d", maxHistorySize, h.size)
+	}
+}
+
+func TestScrapeHistoryProtected(t *testing.T) {
+	conf := &Config{}
+	a := newAdmin(newRuntimeTargets(conf, conf), "secret", log.NewNopLogger())
+	h := a.protect(newScrapeHistory(10))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/history", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without the admin token, received %d", w.Code)
+	}
+	r := httptest.NewRequest("GET", "/history", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the admin token, received %d", w.Code)
+	}
+}
+
+func TestScrapeHistoryServeHTTP(t *testing.T) {
+	h := newScrapeHistory(10)
+	h.record("sbc1", scrapeRecord{Source: "probe", Error: "connection refused"})
+	h.record("sbc2", scrapeRecord{Source: "poll", Series: 12})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/history?target=sbc1", nil))
+	var result map[string][]scrapeRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || len(result["sbc1"]) != 1 || result["sbc1"][0].Error != "connection refused" {
+		t.Errorf("Expected the record of sbc1 only, received %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/history", nil))
+	result = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Errorf("Expected the records of both targets, received %s", w.Body.String())
+	}
+}
+
+func TestHandlerRecordsHistory(t *testing.T) {
+	defer func(h *scrapeHistory) { scrapeHistories = h }(scrapeHistories)
+	scrapeHistories = newScrapeHistory(10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+	conf := &Config{Targets: map[string]*Target{target: {Protocol: "http"}}}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/sansay?target="+target, nil), conf, nil, log.NewNopLogger())
+	records := scrapeHistories.records(target)
+	if len(records) != 1 {
+		t.Fatalf("Expected a record of the scrape, received %d", len(records))
+	}
+	if records[0].Source != "probe" || !strings.Contains(records[0].Error, "503") {
+		t.Errorf("Expected a failed probe, received %+v", records[0])
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/sansay?target=127.0.0.1:1", nil), conf, nil, log.NewNopLogger())
+	if records := scrapeHistories.records("127.0.0.1:1"); len(records) != 0 {
+		t.Errorf("Expected no record of an unconfigured target, received %+v", records)
+	}
+
+	newRuntimeTargets(conf, conf).remove(target)
+	if records := scrapeHistories.records(target); len(records) != 0 {
+		t.Errorf("Expected the records of a removed target to be dropped, received %+v", records)
+	}
+}
+
+func TestPollRecord(t *testing.T) {
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(newDesc("sansay_cps", "Calls per second", nil), prometheus.GaugeValue, 5),
+		prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), errors.New("timeout")),
+	}
+	r := pollRecord("system", time.Now(), metrics)
+	if r.Source != "poll" || r.Module != "system" || r.Series != 1 || r.Error != "timeout" {
+		t.Errorf("Expected a poll with a series and an error, received %+v", r)
+	}
+}
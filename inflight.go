@@ -0,0 +1,93 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// inFlightLimiter bounds the concurrent requests to each target across the
+// paths, modules and probe requests scraping it, as the SBC web engine
+// degrades badly under parallel stats downloads.
+type inFlightLimiter struct {
+	mu      sync.Mutex
+	targets map[string]chan struct{}
+}
+
+func newInFlightLimiter() *inFlightLimiter {
+	return &inFlightLimiter{targets: map[string]chan struct{}{}}
+}
+
+// slots returns the semaphore of the target, allowing max concurrent
+// requests.  The size of the first call for a target is kept.
+func (l *inFlightLimiter) slots(target string, max int) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots, ok := l.targets[target]
+	if !ok {
+		slots = make(chan struct{}, max)
+		l.targets[target] = slots
+	}
+	return slots
+}
+
+// inUse returns the number of requests in flight across the targets.
+func (l *inFlightLimiter) inUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, slots := range l.targets {
+		n += len(slots)
+	}
+	return n
+}
+
+// inFlightRoundTripper holds one of the target's slots from sending a request
+// until its response body is closed.
+type inFlightRoundTripper struct {
+	slots chan struct{}
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *inFlightRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case rt.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		<-rt.slots
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-rt.slots }}
+	return resp, nil
+}
+
+// releasingBody releases its request's slot once, when it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close implements io.Closer.
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInFlightRoundTripper(t *testing.T) {
+	var mu sync.Mutex
+	var current, peak int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		current--
+		mu.Unlock()
+		w.Write([]byte("<xml/>"))
+	}))
+	defer server.Close()
+
+	limiter := newInFlightLimiter()
+	client := &http.Client{Transport: &inFlightRoundTripper{slots: limiter.slots("sbc1", 1), next: http.DefaultTransport}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("Expected at most 1 request in flight, received %d", peak)
+	}
+}
+
+func TestInFlightRoundTripperCancel(t *testing.T) {
+	limiter := newInFlightLimiter()
+	slots := limiter.slots("sbc1", 1)
+	slots <- struct{}{}
+	if limiter.slots("sbc1", 5) != slots {
+		t.Fatal("Expected the target's slots to be shared")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "http://sbc1/", nil)
+	rt := &inFlightRoundTripper{slots: slots, next: http.DefaultTransport}
+	if _, err := rt.RoundTrip(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("Expected waiting for a slot to give up at the deadline, received %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// internalsCollector exports the size of the state the exporter keeps across
+// scrapes, so its own health can be watched as the number of targets grows.
+type internalsCollector struct {
+	downloads *downloadCache
+	backoffs  *backoffTracker
+	inFlight  *inFlightLimiter
+	trunks    *trunkTracker
+	now       func() time.Time
+
+	cacheEntries *prometheus.Desc
+	backingOff   *prometheus.Desc
+	requests     *prometheus.Desc
+	trunkGroups  *prometheus.Desc
+}
+
+func newInternalsCollector(downloads *downloadCache, backoffs *backoffTracker, inFlight *inFlightLimiter, trunks *trunkTracker) *internalsCollector {
+	return &internalsCollector{
+		downloads: downloads,
+		backoffs:  backoffs,
+		inFlight:  inFlight,
+		trunks:    trunks,
+		now:       time.Now,
+		cacheEntries: prometheus.NewDesc("sansay_download_cache_entries",
+			"Downloads cached or in progress for sharing between modules.", nil, nil),
+		backingOff: prometheus.NewDesc("sansay_backoff_targets",
+			"Targets not scraped until the time they asked to be retried at.", nil, nil),
+		requests: prometheus.NewDesc("sansay_in_flight_requests",
+			"Requests to the targets in progress.", nil, nil),
+		trunkGroups: prometheus.NewDesc("sansay_known_trunk_groups",
+			"Trunk groups remembered across the targets for zero-filling.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *internalsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cacheEntries
+	ch <- c.backingOff
+	ch <- c.requests
+	ch <- c.trunkGroups
+}
+
+// Collect implements prometheus.Collector.
+func (c *internalsCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.cacheEntries, prometheus.GaugeValue, float64(c.downloads.len()))
+	ch <- prometheus.MustNewConstMetric(c.backingOff, prometheus.GaugeValue, float64(c.backoffs.count(c.now())))
+	ch <- prometheus.MustNewConstMetric(c.requests, prometheus.GaugeValue, float64(c.inFlight.inUse()))
+	ch <- prometheus.MustNewConstMetric(c.trunkGroups, prometheus.GaugeValue, float64(c.trunks.len()))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInternalsCollector(t *testing.T) {
+	now := time.Unix(1000, 0)
+	downloads := newDownloadCache(time.Minute)
+	downloads.get("sbc1", "", "/stats", func() interface{} { return nil })
+	backoffs := newBackoffTracker()
+	backoffs.backoff("sbc1", now.Add(time.Minute))
+	backoffs.backoff("sbc2", now.Add(-time.Minute))
+	inFlight := newInFlightLimiter()
+	inFlight.slots("sbc1", 2) <- struct{}{}
+	trunks := newTrunkTracker()
+	trunks.fill(make(chan prometheus.Metric, 10), "sbc1", []Trunk{{TrunkId: "1"}, {TrunkId: "2"}}, nil, nil, time.Hour, now)
+
+	c := newInternalsCollector(downloads, backoffs, inFlight, trunks)
+	c.now = func() time.Time { return now }
+	compareMetrics(t, c.Collect, `
+# TYPE sansay_backoff_targets gauge
+sansay_backoff_targets 1
+# TYPE sansay_download_cache_entries gauge
+sansay_download_cache_entries 1
+# TYPE sansay_in_flight_requests gauge
+sansay_in_flight_requests 1
+# TYPE sansay_known_trunk_groups gauge
+sansay_known_trunk_groups 2
+`, "sansay_backoff_targets", "sansay_download_cache_entries", "sansay_in_flight_requests", "sansay_known_trunk_groups")
+}
+
+func TestPollerInternals(t *testing.T) {
+	conf := &Config{Targets: map[string]*Target{"sbc1": {}, "sbc2": {}}}
+	p := newPoller(conf, time.Minute, 3, log.NewNopLogger())
+	p.scheduled["sbc1"] = true
+	p.busy = 1
+	compareMetrics(t, p.Collect, `
+# TYPE sansay_poll_results gauge
+sansay_poll_results 0
+# TYPE sansay_poll_targets gauge
+sansay_poll_targets 1
+# TYPE sansay_poll_workers gauge
+sansay_poll_workers 3
+# TYPE sansay_poll_workers_busy gauge
+sansay_poll_workers_busy 1
+`, "sansay_poll_results", "sansay_poll_targets", "sansay_poll_workers", "sansay_poll_workers_busy")
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// intervalPath is the download of the completed 15 minute interval stats.
+	intervalPath = "stats/interval"
+	// statsInterval is the length of the SBC's stats intervals.
+	statsInterval = 15 * time.Minute
+	// intervalGrace is how long after an interval boundary the SBC is given
+	// to write out the completed interval before it is downloaded.
+	intervalGrace = time.Minute
+)
+
+// intervalCounters are the interval table fields accumulated into counters,
+// keyed by the call status label, or "" for the call duration.
+var intervalCounters = map[string]string{
+	"call_attempt":     "attempt",
+	"call_answer":      "answer",
+	"call_fail":        "fail",
+	"call_durationSec": "",
+}
+
+// intervalTracker accumulates the completed-interval stats of each target
+// into counters.  Each interval is counted once per trunk, however often it
+// is downloaded, so counters don't double count across scrapes.
+type intervalTracker struct {
+	mu      sync.Mutex
+	targets map[string]*intervalTarget
+}
+
+type intervalTarget struct {
+	// fetched is the interval boundary the stats were last downloaded for.
+	fetched time.Time
+	trunks  map[string]*intervalTrunk
+}
+
+type intervalTrunk struct {
+	alias    string
+	lastEnd  time.Time
+	calls    map[string]float64
+	duration float64
+}
+
+func newIntervalTracker() *intervalTracker {
+	return &intervalTracker{targets: map[string]*intervalTarget{}}
+}
+
+func (t *intervalTracker) target(name string) *intervalTarget {
+	target, ok := t.targets[name]
+	if !ok {
+		target = &intervalTarget{trunks: map[string]*intervalTrunk{}}
+		t.targets[name] = target
+	}
+	return target
+}
+
+// due reports whether a new interval has completed since the target's
+// interval stats were last downloaded.
+func (t *intervalTracker) due(name string, now time.Time) bool {
+	boundary := now.Add(-intervalGrace).Truncate(statsInterval)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.target(name).fetched.Before(boundary)
+}
+
+// attempted records that the target's interval stats were downloaded at now,
+// whether or not the download had any, so they are only due again after the
+// next interval completes.
+func (t *intervalTracker) attempted(name string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.target(name).fetched = now.Add(-intervalGrace).Truncate(statsInterval)
+}
+
+// record adds the interval rows that have not been counted yet.
+func (t *intervalTracker) record(name string, table Table) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target := t.target(name)
+	for _, row := range table.Row {
+		fields := row.Fields()
+		end, ok := parseTimestamp(firstField(fields, "interval_end", "end_time", "timestamp"))
+		if !ok {
+			continue
+		}
+		id := firstField(fields, "trunkId", "trunk_id")
+		trunk, ok := target.trunks[id]
+		if !ok {
+			trunk = &intervalTrunk{calls: map[string]float64{}}
+			target.trunks[id] = trunk
+		}
+		if !end.After(trunk.lastEnd) {
+			continue
+		}
+		trunk.lastEnd = end
+		trunk.alias = firstField(fields, "alias", "name")
+		for field, status := range intervalCounters {
+			value, err := strconv.ParseFloat(fields[field], 64)
+			if err != nil {
+				continue
+			}
+			if status == "" {
+				trunk.duration += value
+			} else {
+				trunk.calls[status] += value
+			}
+		}
+	}
+}
+
+// collect exports the accumulated interval counters of the target.  With
+// timestamps, each trunk's series carry the end of its last interval counted,
+// so they are stored at the time the SBC measured them rather than the time
+// of the scrape.
+func (t *intervalTracker) collect(ch chan<- prometheus.Metric, name string, timestamps bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target, ok := t.targets[name]
+	if !ok {
+		return
+	}
+	for id, trunk := range target.trunks {
+		emit := func(m prometheus.Metric) {
+			if timestamps {
+				m = prometheus.NewMetricWithTimestamp(trunk.lastEnd, m)
+			}
+			ch <- m
+		}
+		for status, value := range trunk.calls {
+			emit(prometheus.MustNewConstMetric(
+				newDesc("sansay_trunk_interval_calls_total", "Calls in completed 15 minute intervals.", []string{"trunkgroup", "alias", "status"}),
+				prometheus.CounterValue,
+				value, id, trunk.alias, status))
+		}
+		emit(prometheus.MustNewConstMetric(
+			newDesc("sansay_trunk_interval_duration_seconds_total", "Call duration in completed 15 minute intervals.", []string{"trunkgroup", "alias"}),
+			prometheus.CounterValue,
+			trunk.duration, id, trunk.alias))
+		emit(prometheus.MustNewConstMetric(
+			newDesc("sansay_trunk_interval_end_timestamp_seconds", "End of the last completed interval counted.", []string{"trunkgroup", "alias"}),
+			prometheus.GaugeValue,
+			float64(trunk.lastEnd.Unix()), id, trunk.alias))
+	}
+}
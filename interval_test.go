@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestIntervalTracker(t *testing.T) {
+	var sansay Sansay
+	dump := `<mysqldump><database name="stats"><table name="interval_stat">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="interval_end">2020-01-01 00:15:00</field><field name="call_attempt">10</field><field name="call_answer">8</field><field name="call_fail">2</field><field name="call_durationSec">600</field></row>
+</table></database></mysqldump>`
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	table := sansay.Database.Table[0]
+	now := time.Date(2020, 1, 1, 0, 17, 0, 0, time.UTC)
+
+	tracker := newIntervalTracker()
+	if !tracker.due("sbc", now) {
+		t.Fatal("Expected interval stats to be due for a new target")
+	}
+	tracker.record("sbc", table)
+	tracker.attempted("sbc", now)
+	if tracker.due("sbc", now.Add(10*time.Minute)) {
+		t.Error("Expected interval stats not to be due before the next boundary")
+	}
+	if !tracker.due("sbc", now.Add(15*time.Minute)) {
+		t.Error("Expected interval stats to be due after the next boundary")
+	}
+	// Downloading the same interval again must not double count.
+	tracker.record("sbc", table)
+
+	expected := `
+# TYPE sansay_trunk_interval_calls_total counter
+sansay_trunk_interval_calls_total{alias="carrier",status="answer",trunkgroup="100"} 8
+sansay_trunk_interval_calls_total{alias="carrier",status="attempt",trunkgroup="100"} 10
+sansay_trunk_interval_calls_total{alias="carrier",status="fail",trunkgroup="100"} 2
+# TYPE sansay_trunk_interval_duration_seconds_total counter
+sansay_trunk_interval_duration_seconds_total{alias="carrier",trunkgroup="100"} 600
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.collect(ch, "sbc", false)
+	}, expected, "sansay_trunk_interval_calls_total", "sansay_trunk_interval_duration_seconds_total")
+}
+
+func TestIntervalTimestamps(t *testing.T) {
+	var sansay Sansay
+	dump := `<mysqldump><database name="stats"><table name="interval_stat">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="interval_end">2020-01-01 00:15:00</field><field name="call_attempt">10</field><field name="call_durationSec">600</field></row>
+</table></database></mysqldump>`
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	tracker := newIntervalTracker()
+	tracker.record("sbc", sansay.Database.Table[0])
+
+	// The samples are stored at the end of the interval.
+	expected := `
+# TYPE sansay_trunk_interval_calls_total counter
+sansay_trunk_interval_calls_total{alias="carrier",status="attempt",trunkgroup="100"} 10 1577837700000
+# TYPE sansay_trunk_interval_duration_seconds_total counter
+sansay_trunk_interval_duration_seconds_total{alias="carrier",trunkgroup="100"} 600 1577837700000
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.collect(ch, "sbc", true)
+	}, expected, "sansay_trunk_interval_calls_total", "sansay_trunk_interval_duration_seconds_total")
+}
+
+func TestIntervalStatsWithoutTable(t *testing.T) {
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, intervalPath) {
+			atomic.AddInt32(&downloads, 1)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<mysqldump><database name="stats"></database></mysqldump>`))
+	}))
+	defer server.Close()
+	c := collector{target: server.URL, targetPath: targetPath, paths: []string{"stats/system"}, logger: log.NewNopLogger(), client: &http.Client{}, intervals: newIntervalTracker()}
+
+	// A download without an interval table isn't repeated until the next
+	// interval completes either.
+	for i := 0; i < 2; i++ {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.Collect(ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+	}
+	if got := atomic.LoadInt32(&downloads); got != 1 {
+		t.Errorf("Expected the interval stats to be downloaded once, received %d", got)
+	}
+}
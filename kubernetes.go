@@ -0,0 +1,313 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The annotations of the Kubernetes Services discovered SBCs are registered
+// with.
+const (
+	kubernetesScrapeAnnotation   = "sansay.io/scrape"
+	kubernetesPortAnnotation     = "sansay.io/port"
+	kubernetesTemplateAnnotation = "sansay.io/template"
+)
+
+// kubernetesServiceAccount holds the credentials of the exporter's pod.
+const kubernetesServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesObjectMeta is the metadata of a Kubernetes object.
+type kubernetesObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type kubernetesServiceList struct {
+	Items []struct {
+		Metadata kubernetesObjectMeta `json:"metadata"`
+	} `json:"items"`
+}
+
+type kubernetesEndpointsList struct {
+	Items []struct {
+		Metadata kubernetesObjectMeta `json:"metadata"`
+		Subsets  []struct {
+			Addresses []struct {
+				IP string `json:"ip"`
+			} `json:"addresses"`
+		} `json:"subsets"`
+	} `json:"items"`
+}
+
+// kubernetesDiscovery registers the SBCs behind Kubernetes Services annotated
+// with sansay.io/scrape: "true", typically selector-less Services whose
+// Endpoints list SBC VMs outside the cluster, as targets.  Each ready address
+// becomes a target with the settings of the configured target named by the
+// sansay.io/template annotation, reached on the sansay.io/port annotation if
+// given.
+type kubernetesDiscovery struct {
+	// server is the URL of the Kubernetes API.
+	server    string
+	namespace string
+	client    *http.Client
+	// token returns the bearer token sent to the API, re-read on every
+	// request as projected service account tokens rotate.
+	token   func() (string, error)
+	targets *runtimeTargets
+	logger  log.Logger
+
+	mu sync.Mutex
+	// discovered holds the targets registered by discovery, as they were
+	// added.
+	discovered map[string]*Target
+
+	failures   prometheus.Counter
+	registered prometheus.GaugeFunc
+}
+
+// newInClusterDiscovery returns a discovery using the service account of the
+// exporter's pod.
+func newInClusterDiscovery(namespace string, targets *runtimeTargets, logger log.Logger) (*kubernetesDiscovery, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, $KUBERNETES_SERVICE_HOST and $KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(kubernetesServiceAccount + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates in the service account's ca.crt")
+	}
+	d := newKubernetesDiscovery("https://"+net.JoinHostPort(host, port), namespace, targets, logger)
+	d.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	d.token = func() (string, error) {
+		token, err := ioutil.ReadFile(kubernetesServiceAccount + "/token")
+		return strings.TrimSpace(string(token)), err
+	}
+	return d, nil
+}
+
+func newKubernetesDiscovery(server, namespace string, targets *runtimeTargets, logger log.Logger) *kubernetesDiscovery {
+	d := &kubernetesDiscovery{
+		server:     server,
+		namespace:  namespace,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		token:      func() (string, error) { return "", nil },
+		targets:    targets,
+		logger:     logger,
+		discovered: map[string]*Target{},
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sansay_discovery_kubernetes_failures_total",
+			Help: "Refreshes of the targets discovered from Kubernetes that failed.",
+		}),
+	}
+	d.registered = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "sansay_discovery_kubernetes_targets",
+		Help: "Targets discovered from Kubernetes.",
+	}, func() float64 {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return float64(len(d.discovered))
+	})
+	return d
+}
+
+// Describe implements prometheus.Collector.
+func (d *kubernetesDiscovery) Describe(ch chan<- *prometheus.Desc) {
+	d.failures.Describe(ch)
+	d.registered.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (d *kubernetesDiscovery) Collect(ch chan<- prometheus.Metric) {
+	d.failures.Collect(ch)
+	d.registered.Collect(ch)
+}
+
+// run refreshes the discovered targets every interval.
+func (d *kubernetesDiscovery) run(interval time.Duration) {
+	for {
+		if err := d.refresh(); err != nil {
+			d.failures.Inc()
+			level.Error(d.logger).Log("msg", "Error discovering targets from Kubernetes, keeping the previous ones", "err", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// refresh lists the annotated Services and their Endpoints, and adds,
+// updates and removes the discovered targets to match.  Targets configured
+// by other means are left alone.
+func (d *kubernetesDiscovery) refresh() error {
+	found, err := d.discover()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, t := range found {
+		if previous, ok := d.discovered[name]; ok && reflect.DeepEqual(previous, t) {
+			continue
+		}
+		if _, ok := d.discovered[name]; !ok && d.targets.conf.HasTarget(name) {
+			level.Debug(d.logger).Log("msg", "Ignoring discovered target that is already configured", "target", name)
+			continue
+		}
+		if err := d.targets.add(name, t); err != nil {
+			level.Error(d.logger).Log("msg", "Error adding discovered target", "target", name, "err", err)
+			continue
+		}
+		d.discovered[name] = t
+		level.Info(d.logger).Log("msg", "Added discovered target", "target", name)
+	}
+	for name := range d.discovered {
+		if _, ok := found[name]; !ok {
+			d.targets.remove(name)
+			delete(d.discovered, name)
+			level.Info(d.logger).Log("msg", "Removed discovered target", "target", name)
+		}
+	}
+	return nil
+}
+
+// discover returns the targets of the annotated Services.
+func (d *kubernetesDiscovery) discover() (map[string]*Target, error) {
+	prefix := "/api/v1"
+	if d.namespace != "" {
+		prefix += "/namespaces/" + d.namespace
+	}
+	services := kubernetesServiceList{}
+	if err := d.get(prefix+"/services", &services); err != nil {
+		return nil, err
+	}
+	endpoints := kubernetesEndpointsList{}
+	if err := d.get(prefix+"/endpoints", &endpoints); err != nil {
+		return nil, err
+	}
+
+	found := map[string]*Target{}
+	for _, service := range services.Items {
+		meta := service.Metadata
+		if meta.Annotations[kubernetesScrapeAnnotation] != "true" {
+			continue
+		}
+		logger := log.With(d.logger, "namespace", meta.Namespace, "service", meta.Name)
+		template := &Target{}
+		if name := meta.Annotations[kubernetesTemplateAnnotation]; name != "" {
+			if !d.targets.conf.HasTarget(name) {
+				level.Warn(logger).Log("msg", "Skipping Service with an unknown template target", "template", name)
+				continue
+			}
+			template = d.targets.conf.Target(name)
+		}
+		port := meta.Annotations[kubernetesPortAnnotation]
+		if port != "" {
+			if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				level.Warn(logger).Log("msg", "Skipping Service with an invalid port", "port", port)
+				continue
+			}
+		}
+		for _, ep := range endpoints.Items {
+			if ep.Metadata.Namespace != meta.Namespace || ep.Metadata.Name != meta.Name {
+				continue
+			}
+			for _, subset := range ep.Subsets {
+				for _, address := range subset.Addresses {
+					name := address.IP
+					if port != "" {
+						name = net.JoinHostPort(address.IP, port)
+					}
+					t, err := copyTarget(template)
+					if err != nil {
+						return nil, err
+					}
+					t.Metadata = kubernetesMetadata(meta)
+					found[name] = t
+				}
+			}
+		}
+	}
+	return found, nil
+}
+
+// get decodes the JSON response of the Kubernetes API to path into v.
+func (d *kubernetesDiscovery) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", d.server+path, nil)
+	if err != nil {
+		return err
+	}
+	token, err := d.token()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// kubernetesMetadata returns the metadata of a target discovered from a
+// Service: its namespace and name, and its labels and annotations as
+// label_<name> and annotation_<name> with characters invalid in label names
+// replaced by underscores.
+func kubernetesMetadata(meta kubernetesObjectMeta) map[string]string {
+	metadata := map[string]string{
+		"namespace": meta.Namespace,
+		"service":   meta.Name,
+	}
+	for name, value := range meta.Labels {
+		metadata["label_"+invalidNameChars.ReplaceAllString(name, "_")] = value
+	}
+	for name, value := range meta.Annotations {
+		metadata["annotation_"+invalidNameChars.ReplaceAllString(name, "_")] = value
+	}
+	return metadata
+}
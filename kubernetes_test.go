@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestKubernetesDiscovery(t *testing.T) {
+	addresses := `{"ip": "10.0.0.5"}, {"ip": "10.0.0.6"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Expected the service account token, received %q", got)
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/voice/services":
+			w.Write([]byte(`{"items": [
+				{"metadata": {"name": "sbc-dal", "namespace": "voice", "labels": {"app.kubernetes.io/part-of": "core"},
+				 "annotations": {"sansay.io/scrape": "true", "sansay.io/template": "defaults", "sansay.io/port": "8443"}}},
+				{"metadata": {"name": "web", "namespace": "voice"}},
+				{"metadata": {"name": "sbc-lon", "namespace": "voice", "annotations": {"sansay.io/scrape": "true", "sansay.io/template": "unknown"}}}
+			]}`))
+		case "/api/v1/namespaces/voice/endpoints":
+			fmt.Fprintf(w, `{"items": [
+				{"metadata": {"name": "sbc-dal", "namespace": "voice"}, "subsets": [{"addresses": [%s]}]},
+				{"metadata": {"name": "web", "namespace": "voice"}, "subsets": [{"addresses": [{"ip": "10.1.0.1"}]}]},
+				{"metadata": {"name": "sbc-lon", "namespace": "voice"}, "subsets": [{"addresses": [{"ip": "10.2.0.1"}]}]}
+			]}`, addresses)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	conf := &Config{Targets: map[string]*Target{
+		"defaults":      {Username: "monitor", Password: "secret"},
+		"10.0.0.6:8443": {Username: "static"},
+	}}
+	d := newKubernetesDiscovery(server.URL, "voice", newRuntimeTargets(conf, conf), log.NewNopLogger())
+	d.token = func() (string, error) { return "token", nil }
+	if err := d.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(conf.TargetNames(), ","); got != "10.0.0.5:8443,10.0.0.6:8443,defaults" {
+		t.Errorf("Expected the discovered targets, received %s", got)
+	}
+	discovered := conf.Target("10.0.0.5:8443")
+	if discovered.Username != "monitor" || discovered.Password != "secret" {
+		t.Errorf("Expected the template's credentials, received %q/%q", discovered.Username, discovered.Password)
+	}
+	if got := discovered.Metadata["label_app_kubernetes_io_part_of"]; got != "core" {
+		t.Errorf("Expected the Service's labels in the metadata, received %q", got)
+	}
+	if got := discovered.Metadata["service"]; got != "sbc-dal" {
+		t.Errorf("Expected the Service's name in the metadata, received %q", got)
+	}
+	if got := conf.Target("10.0.0.6:8443").Username; got != "static" {
+		t.Errorf("Expected the configured target to be left alone, received username %q", got)
+	}
+
+	addresses = `{"ip": "10.0.0.6"}`
+	if err := d.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(conf.TargetNames(), ","); got != "10.0.0.6:8443,defaults" {
+		t.Errorf("Expected the vanished target to be removed, received %s", got)
+	}
+}
+
+func TestKubernetesDiscoveryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	conf := &Config{}
+	d := newKubernetesDiscovery(server.URL, "", newRuntimeTargets(conf, conf), log.NewNopLogger())
+	if err := d.refresh(); err == nil {
+		t.Error("Expected an error when the API denies the request")
+	}
+}
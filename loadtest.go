@@ -0,0 +1,207 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// loadTest is how a load test scrapes the clones of the fixture SBC.
+type loadTest struct {
+	file     string
+	path     string
+	targets  int
+	workers  int
+	interval time.Duration
+	duration time.Duration
+}
+
+// loadTestResult is the exporter's behavior during a load test.
+type loadTestResult struct {
+	targets    int
+	scrapes    int
+	errors     int
+	series     int
+	durations  []time.Duration
+	lags       []time.Duration
+	goroutines int
+	heap       uint64
+	finalHeap  uint64
+}
+
+// runLoadTest serves the dump in the test's file from a fixture server, and
+// scrapes as many clones of it as the test has targets, each once per
+// interval spread across the interval, with at most workers scrapes at a
+// time like background polling.  The clones are distinct targets to the
+// exporter, resolved to the fixture server.
+func runLoadTest(t loadTest) (loadTestResult, error) {
+	body, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	if _, err := parseSansay(t.path, body); err != nil {
+		return loadTestResult{}, err
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, t.path) {
+			http.Error(w, "Not found", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(body)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	if t.targets < 1 {
+		t.targets = 1
+	}
+	if t.workers < 1 {
+		t.workers = 1
+	}
+
+	result := loadTestResult{targets: t.targets}
+	var mu sync.Mutex
+	slots := make(chan struct{}, t.workers)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < t.targets; i++ {
+		target := fmt.Sprintf("clone-%d.loadtest:%s", i, port)
+		offset := t.interval * time.Duration(i) / time.Duration(t.targets)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scheduled := start.Add(offset); scheduled.Sub(start) < t.duration; scheduled = scheduled.Add(t.interval) {
+				select {
+				case <-time.After(time.Until(scheduled)):
+				case <-stop:
+					return
+				}
+				slots <- struct{}{}
+				lag := time.Since(scheduled)
+				scrapeStart := time.Now()
+				series, failed := loadTestScrape(target, t.path)
+				duration := time.Since(scrapeStart)
+				<-slots
+				mu.Lock()
+				result.scrapes++
+				if failed {
+					result.errors++
+				}
+				result.series = series
+				result.durations = append(result.durations, duration)
+				result.lags = append(result.lags, lag)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var sampler sync.WaitGroup
+	sampler.Add(1)
+	go func() {
+		defer sampler.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+			runtime.ReadMemStats(&m)
+			mu.Lock()
+			if n := runtime.NumGoroutine(); n > result.goroutines {
+				result.goroutines = n
+			}
+			if m.HeapInuse > result.heap {
+				result.heap = m.HeapInuse
+			}
+			mu.Unlock()
+		}
+	}()
+
+	timer := time.AfterFunc(t.duration, func() { close(stop) })
+	defer timer.Stop()
+	wg.Wait()
+	sampler.Wait()
+
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	result.finalHeap = m.HeapInuse
+	return result, nil
+}
+
+// loadTestScrape scrapes path from the clone target as background polling
+// would, and returns the series it created and whether it failed.
+func loadTestScrape(target, path string) (int, bool) {
+	c, err := newCollector(target, &Target{Protocol: "http", Resolve: "127.0.0.1"}, nil, log.NewNopLogger())
+	if err != nil {
+		return 0, true
+	}
+	c.paths = []string{path}
+	c.timeout = defaultScrapeTimeout
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	series, failed := 0, false
+	for m := range ch {
+		if err := m.Write(&dto.Metric{}); err != nil {
+			failed = true
+			continue
+		}
+		series++
+	}
+	return series, failed
+}
+
+// percentile returns the pth percentile of durations, sorting them.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[int(float64(len(durations)-1)*p)]
+}
+
+// print writes the exporter's behavior during the load test.
+func (r loadTestResult) print(w io.Writer) {
+	fmt.Fprintf(w, "targets:         %d\n", r.targets)
+	fmt.Fprintf(w, "scrapes:         %d (%d failed)\n", r.scrapes, r.errors)
+	fmt.Fprintf(w, "series:          %d/scrape\n", r.series)
+	fmt.Fprintf(w, "scrape duration: p50 %s, p99 %s, max %s\n", percentile(r.durations, 0.5), percentile(r.durations, 0.99), percentile(r.durations, 1))
+	fmt.Fprintf(w, "scheduling lag:  p50 %s, p99 %s, max %s\n", percentile(r.lags, 0.5), percentile(r.lags, 0.99), percentile(r.lags, 1))
+	fmt.Fprintf(w, "goroutines:      %d peak\n", r.goroutines)
+	fmt.Fprintf(w, "heap in use:     %d bytes peak, %d bytes after\n", r.heap, r.finalHeap)
+}
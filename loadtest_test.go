@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunLoadTest(t *testing.T) {
+	result, err := runLoadTest(loadTest{
+		file:     "testdata/golden/rest/stats_realtime.xml",
+		path:     "stats/realtime",
+		targets:  3,
+		workers:  2,
+		interval: 50 * time.Millisecond,
+		duration: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.scrapes < 3 || result.errors != 0 {
+		t.Errorf("Expected every clone to be scraped without errors, received %d scrapes and %d errors", result.scrapes, result.errors)
+	}
+	if result.series == 0 {
+		t.Error("Expected the scrapes to create series")
+	}
+	var out bytes.Buffer
+	result.print(&out)
+	if !strings.Contains(out.String(), "scheduling lag:") {
+		t.Errorf("Expected the scheduling lag to be reported, received %s", out.String())
+	}
+}
+
+func TestRunLoadTestInvalidDump(t *testing.T) {
+	if _, err := runLoadTest(loadTest{file: "testdata/sansay.yml", path: "stats/realtime", duration: time.Millisecond}); err == nil {
+		t.Error("Expected an error for a file that isn't a dump")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	durations := []time.Duration{5, 1, 4, 2, 3}
+	if got := percentile(durations, 0.5); got != 3 {
+		t.Errorf("Expected a median of 3, received %d", got)
+	}
+	if got := percentile(durations, 1); got != 5 {
+		t.Errorf("Expected a maximum of 5, received %d", got)
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("Expected 0 without durations, received %d", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/promlog"
+)
+
+// newLogger returns the logger configured by the promlog flags, with
+// repeated failures deduplicated over interval unless it is 0.
+func newLogger(config *promlog.Config, interval time.Duration) log.Logger {
+	if interval <= 0 {
+		return promlog.New(config)
+	}
+	// promlog's logger binds the caller of its Log, which is the dedup logger
+	// on top of it, so it is built with a caller skipping the dedup logger.
+	defaultCaller := log.DefaultCaller
+	log.DefaultCaller = dedupCaller
+	logger := promlog.New(config)
+	log.DefaultCaller = defaultCaller
+	dedup := newDedupLogger(logger, interval)
+	go dedup.run()
+	return dedup
+}
+
+// dedupCaller returns the caller of a record logged through a dedupLogger:
+// the first frame outside go-kit's log packages and the dedup logger, or the
+// dedup logger's own for the summaries it logs when flushing.
+func dedupCaller() interface{} {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	var fallback string
+	for {
+		frame, more := frames.Next()
+		caller := filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+		switch {
+		case strings.HasPrefix(frame.Function, "github.com/go-kit/log"):
+		case strings.Contains(frame.Function, ".(*dedupLogger)."), strings.Contains(frame.Function, ".(*dedupEntry)."):
+			if fallback == "" {
+				fallback = caller
+			}
+		case !strings.HasPrefix(frame.Function, "runtime."):
+			return caller
+		}
+		if !more {
+			return fallback
+		}
+	}
+}
+
+// dedupEntry is a failure logged, and how often it was repeated since.
+type dedupEntry struct {
+	keyvals  []interface{}
+	since    time.Time
+	repeated int
+}
+
+// dedupLogger drops repeats of a logged failure, a record with an err key,
+// within the interval of its first occurrence, and logs how often it was
+// repeated once the interval is over.  An SBC that is down then fills the
+// log with one line per interval rather than one per scrape.
+type dedupLogger struct {
+	next     log.Logger
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[string]*dedupEntry
+}
+
+func newDedupLogger(next log.Logger, interval time.Duration) *dedupLogger {
+	return &dedupLogger{next: next, interval: interval, seen: map[string]*dedupEntry{}}
+}
+
+// Log implements log.Logger.
+func (l *dedupLogger) Log(keyvals ...interface{}) error {
+	if !hasErrKey(keyvals) {
+		return l.next.Log(keyvals...)
+	}
+	key := dedupKey(keyvals)
+	now := time.Now()
+	l.mu.Lock()
+	e, ok := l.seen[key]
+	if ok && now.Sub(e.since) < l.interval {
+		e.repeated++
+		l.mu.Unlock()
+		return nil
+	}
+	l.seen[key] = &dedupEntry{keyvals: append([]interface{}(nil), keyvals...), since: now}
+	l.mu.Unlock()
+	if ok && e.repeated > 0 {
+		e.summarize(l.next)
+	}
+	return l.next.Log(keyvals...)
+}
+
+// flush logs the repeats of the failures whose interval is over at now, and
+// forgets them.
+func (l *dedupLogger) flush(now time.Time) {
+	l.mu.Lock()
+	var over []*dedupEntry
+	for key, e := range l.seen {
+		if now.Sub(e.since) >= l.interval {
+			delete(l.seen, key)
+			if e.repeated > 0 {
+				over = append(over, e)
+			}
+		}
+	}
+	l.mu.Unlock()
+	for _, e := range over {
+		e.summarize(l.next)
+	}
+}
+
+// run flushes the repeated failures every interval.
+func (l *dedupLogger) run() {
+	for now := range time.Tick(l.interval) {
+		l.flush(now)
+	}
+}
+
+// summarize logs the failure with how often it was repeated.
+func (e *dedupEntry) summarize(logger log.Logger) {
+	keyvals := append(append([]interface{}(nil), e.keyvals...), "repeated", e.repeated, "since", e.since.UTC().Format(time.RFC3339))
+	logger.Log(keyvals...)
+}
+
+// hasErrKey reports whether the record has an err key.
+func hasErrKey(keyvals []interface{}) bool {
+	for i := 0; i < len(keyvals); i += 2 {
+		if keyvals[i] == "err" {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupKey identifies a record by its keys and values, leaving out timings
+// and sizes that differ between repeats of the same failure.
+func dedupKey(keyvals []interface{}) string {
+	var b strings.Builder
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if strings.HasSuffix(key, "_seconds") || key == "bytes" {
+			continue
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if i+1 < len(keyvals) {
+			fmt.Fprint(&b, keyvals[i+1])
+		}
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
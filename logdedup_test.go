@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestDedupLogger(t *testing.T) {
+	var logs bytes.Buffer
+	l := newDedupLogger(log.NewLogfmtLogger(&logs), time.Hour)
+	for i := 0; i < 5; i++ {
+		l.Log("target", "sbc1", "msg", "Error for HTTP request", "err", "connection refused", "duration_seconds", float64(i))
+	}
+	l.Log("target", "sbc2", "msg", "Error for HTTP request", "err", "connection refused")
+	l.Log("msg", "Received HTTP response", "status_code", 200)
+	l.Log("msg", "Received HTTP response", "status_code", 200)
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines before the interval is over, received %q", lines)
+	}
+
+	logs.Reset()
+	l.flush(time.Now().Add(time.Hour))
+	out := logs.String()
+	if !strings.Contains(out, "target=sbc1") || !strings.Contains(out, "repeated=4") {
+		t.Errorf("Expected a summary of the 4 repeats for sbc1, received %q", out)
+	}
+	if strings.Contains(out, "sbc2") {
+		t.Errorf("Expected no summary of a failure that wasn't repeated, received %q", out)
+	}
+
+	logs.Reset()
+	l.Log("target", "sbc1", "msg", "Error for HTTP request", "err", "connection refused")
+	if !strings.Contains(logs.String(), "connection refused") || strings.Contains(logs.String(), "repeated") {
+		t.Errorf("Expected a flushed failure to be logged again, received %q", logs.String())
+	}
+}
+
+func TestDedupLoggerIntervalOver(t *testing.T) {
+	var logs bytes.Buffer
+	l := newDedupLogger(log.NewLogfmtLogger(&logs), time.Hour)
+	l.Log("msg", "Error scraping target", "err", "timeout")
+	l.Log("msg", "Error scraping target", "err", "timeout")
+	l.seen[dedupKey([]interface{}{"msg", "Error scraping target", "err", "timeout"})].since = time.Now().Add(-2 * time.Hour)
+	logs.Reset()
+	l.Log("msg", "Error scraping target", "err", "timeout")
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "repeated=1") || strings.Contains(lines[1], "repeated") {
+		t.Errorf("Expected the summary followed by the failure, received %q", lines)
+	}
+}
+
+func TestNewLoggerCaller(t *testing.T) {
+	f, err := ioutil.TempFile("", "sansay_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	defer func(stderr *os.File) { os.Stderr = stderr }(os.Stderr)
+	os.Stderr = f
+
+	config := &promlog.Config{Level: &promlog.AllowedLevel{}, Format: &promlog.AllowedFormat{}}
+	config.Level.Set("info")
+	config.Format.Set("logfmt")
+	logger := newLogger(config, time.Hour)
+	_, _, line, _ := runtime.Caller(0)
+	level.Error(logger).Log("msg", "Error scraping target", "err", "timeout")
+	level.Error(logger).Log("msg", "Error scraping target", "err", "timeout")
+	level.Debug(logger).Log("msg", "Scraping target")
+	logger.(*dedupLogger).flush(time.Now().Add(time.Hour))
+
+	content, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected the failure and its summary, without the debug line, received %q", lines)
+	}
+	if want := fmt.Sprintf("caller=logdedup_test.go:%d ", line+1); !strings.Contains(lines[0], want) {
+		t.Errorf("Expected the caller of the log call, %s, received %q", want, lines[0])
+	}
+	if !strings.Contains(lines[1], "repeated=1") {
+		t.Errorf("Expected the summary of the repeat, received %q", lines[1])
+	}
+}
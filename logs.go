@@ -0,0 +1,105 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// defaultLogPath is the path of the SBC's log download API if the target
+// doesn't set log_path.
+const defaultLogPath = "download/logs"
+
+// logDownloadTimeout bounds the download of a log archive, which may take
+// much longer than a stats dump.
+const logDownloadTimeout = 10 * time.Minute
+
+// logHeaders are the headers of the SBC's response passed on to the client.
+var logHeaders = []string{"Content-Type", "Content-Length", "Content-Disposition", "Last-Modified"}
+
+// logs streams the log archive file of the named target from its log
+// download API, or the list of archives if file is empty, authenticating with
+// the target's credentials so the admin token is all the NOC needs.
+func (a *admin) logs(w http.ResponseWriter, name, file string) {
+	if !a.targets.conf.HasTarget(name) {
+		http.Error(w, fmt.Sprintf("unknown target %q", name), http.StatusNotFound)
+		return
+	}
+	if strings.Contains(file, "/") || file == "." || file == ".." {
+		http.Error(w, fmt.Sprintf("invalid log file %q", file), http.StatusBadRequest)
+		return
+	}
+	t := a.targets.conf.Target(name)
+	logger := log.With(a.logger, "target", name, "file", file)
+	c, err := newCollector(name, t, nil, logger)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := downloadLog(c, t.LogPath, file)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error downloading log", "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		level.Error(logger).Log("msg", "Error downloading log", "status_code", resp.StatusCode)
+		status := http.StatusBadGateway
+		if resp.StatusCode == http.StatusNotFound {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Invalid response from server: %d", resp.StatusCode), status)
+		return
+	}
+	for _, header := range logHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	level.Info(logger).Log("msg", "Downloading log")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		level.Error(logger).Log("msg", "Error streaming log", "err", err)
+	}
+}
+
+// downloadLog requests file from the log download API at path, the list of
+// log archives if file is empty.
+func downloadLog(c collector, path, file string) (*http.Response, error) {
+	if path == "" {
+		path = defaultLogPath
+	}
+	target := c.target + c.targetPath + strings.Trim(path, "/")
+	if file != "" {
+		target += "/" + url.PathEscape(file)
+	}
+	if _, err := url.Parse(target); err != nil {
+		return nil, err
+	}
+	if c.client != nil {
+		client := *c.client
+		client.Timeout = logDownloadTimeout
+		c.client = &client
+	}
+	return getWithCredentials(c, target, "")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestAdminLogs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "pass" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/SSConfig/webresources/download/logs":
+			w.Write([]byte("sansay.log.1.gz\n"))
+		case "/SSConfig/webresources/download/logs/sansay.log.1.gz":
+			w.Header().Set("Content-Disposition", `attachment; filename="sansay.log.1.gz"`)
+			w.Write([]byte("archive"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+
+	conf := &Config{Targets: map[string]*Target{target: {Protocol: "http", Username: "admin", Password: "pass"}}}
+	a := newAdmin(newRuntimeTargets(conf, conf), "secret", log.NewNopLogger())
+
+	if w := adminRequest(a, "GET", adminPrefix+"/"+target+"/logs", ""); w.Code != http.StatusOK || w.Body.String() != "sansay.log.1.gz\n" {
+		t.Errorf("Expected the list of logs, received %d: %s", w.Code, w.Body)
+	}
+	w := adminRequest(a, "GET", adminPrefix+"/"+target+"/logs/sansay.log.1.gz", "")
+	if w.Code != http.StatusOK || w.Body.String() != "archive" {
+		t.Errorf("Expected the log archive, received %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="sansay.log.1.gz"` {
+		t.Errorf("Expected the SBC's Content-Disposition, received %q", got)
+	}
+	if w := adminRequest(a, "GET", adminPrefix+"/"+target+"/logs/missing.gz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing log, received %d", w.Code)
+	}
+	if w := adminRequest(a, "GET", adminPrefix+"/"+target+"/logs/../stats", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a path outside the logs, received %d", w.Code)
+	}
+	if w := adminRequest(a, "GET", adminPrefix+"/unknown/logs", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown target, received %d", w.Code)
+	}
+
+	conf.Targets[target].Password = "wrong"
+	if w := adminRequest(a, "GET", adminPrefix+"/"+target+"/logs", ""); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 when the SBC rejects the credentials, received %d", w.Code)
+	}
+}
@@ -16,14 +16,17 @@ package main
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
+	"filippo.io/age"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/promlog"
@@ -37,8 +40,80 @@ const targetPath = "/SSConfig/webresources/"
 var Version = "dev"
 
 var (
-	listenAddress = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9116").String()
-	dryRun        = kingpin.Flag("dry-run", "Only verify configuration is valid and exit.").Default("false").Bool()
+	configFile        = kingpin.Flag("config.file", "Path to configuration file.").String()
+	ageKeyFile        = kingpin.Flag("config.age-key-file", "Path to the age identities decrypting an encrypted configuration file or its secrets.").Envar("SANSAY_AGE_KEY_FILE").String()
+	listenAddress     = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9116").String()
+	metricsAddress    = kingpin.Flag("web.metrics-listen-address", "Address to serve the exporter's own metrics on instead of --web.listen-address.").String()
+	adminTokenFile    = kingpin.Flag("web.admin-token-file", "Path to the bearer token of the admin API adding and removing targets at runtime, the API is disabled if not given.").String()
+	adminStateFile    = kingpin.Flag("admin.state-file", "Path to the file persisting the targets added and removed through the admin API.").String()
+	trunkStateFile    = kingpin.Flag("trunks.state-file", "Path to the file persisting the trunk groups seen on each target, so zero-filling knows them after a restart.").String()
+	enableExemplars   = kingpin.Flag("tracing.exemplars", "Attach the trace ID of traced scrape requests as exemplars to the exporter's own metrics, served in the OpenMetrics format.").Bool()
+	timeoutOffset     = kingpin.Flag("timeout-offset", "Offset to subtract from timeout in seconds.").Default("0.5").Float64()
+	maxInFlight       = kingpin.Flag("scrape.max-in-flight", "Maximum concurrent requests to a single SBC across paths, modules and scrapes, 0 for no limit.").Default("1").Int()
+	cacheTTL          = kingpin.Flag("scrape.cache-ttl", "Share each download of a target with the scrapes of other modules within this time, 0 to download for every scrape.").Default("0s").Duration()
+	strictMode        = kingpin.Flag("strict", "Fail scrapes of dumps with tables or fields the exporter doesn't know of, instead of exporting unknown system stats as-is.").Bool()
+	unknownTables     = kingpin.Flag("scrape.unknown-tables", "Export the numeric fields of tables the exporter doesn't know of as sansay_<table>_<field>.").Bool()
+	failOn            = kingpin.Flag("scrape.fail-on", "Scrape errors that fail the probe with HTTP 500: any, only total when every download failed, or never, serving the other series with HTTP 200.").Default("any").Enum("any", "total", "never")
+	pollInterval      = kingpin.Flag("background.interval", "Poll the configured targets in the background at this interval and serve the last results, 0 to scrape on request.").Default("0s").Duration()
+	pollWorkers       = kingpin.Flag("background.workers", "Maximum number of targets polled concurrently in the background.").Default("10").Int()
+	pollSpread        = kingpin.Flag("background.spread", "Share of the poll interval the background polls of the targets are spread across.").Default("1").Float64()
+	pollJitter        = kingpin.Flag("background.jitter", "Maximum random delay added to each background poll.").Default("0s").Duration()
+	pollMaxAge        = kingpin.Flag("background.max-age", "Stop serving the metrics of a background-polled target whose last poll is older than this, 0 to always serve them.").Default("0s").Duration()
+	shardIndex        = kingpin.Flag("shard.index", "Index of this replica when the configured targets are sharded across replicas.").Default("0").Int()
+	shardCount        = kingpin.Flag("shard.count", "Number of replicas the configured targets are sharded across.").Default("1").Int()
+	kubernetesSD      = kingpin.Flag("discovery.kubernetes", "Add the SBCs behind Kubernetes Services annotated with sansay.io/scrape: \"true\" as targets, using the pod's service account.").Bool()
+	kubernetesNS      = kingpin.Flag("discovery.kubernetes.namespace", "Namespace to discover Services in, all namespaces if not given.").String()
+	kubernetesRefresh = kingpin.Flag("discovery.kubernetes.refresh-interval", "Interval at which discovered targets are refreshed.").Default("30s").Duration()
+	syslogAddress     = kingpin.Flag("syslog.listen-address", "UDP address to receive the SBCs' event logs on by syslog, counting call rejections, registration failures and security events.").String()
+	syslogAllowed     = kingpin.Flag("syslog.allowed-sources", "Address the SBCs' syslog messages are accepted from, repeatable, the hosts of the configured targets if not given.").Strings()
+	logRequests       = kingpin.Flag("log.requests", "Log every probe request and download from an SBC, with the timings of its phases, at info level.").Bool()
+	slowThreshold     = kingpin.Flag("log.slow-threshold", "Log probe requests and downloads from an SBC taking longer than this at warn level, 0 to never.").Default("0s").Duration()
+	logDedupInterval  = kingpin.Flag("log.dedup-interval", "Log a repeated failure once per this interval, followed by how often it was repeated, 0 to log every failure.").Default("1m").Duration()
+	historySize       = kingpin.Flag("scrape.history-size", "Number of scrape outcomes kept per target for /history, 0 to keep none, at most 1000.").Default("100").Int()
+	dryRun            = kingpin.Flag("dry-run", "Only verify configuration is valid and exit.").Default("false").Bool()
+
+	serveCmd = kingpin.Command("serve", "Run the exporter.").Default()
+
+	benchCmd        = kingpin.Command("bench", "Report the cost of parsing a saved dump and creating its metrics.")
+	benchInput      = benchCmd.Flag("input", "Path to the saved dump.").Required().String()
+	benchPath       = benchCmd.Flag("path", "API path the dump was downloaded from.").Default("stats/realtime").String()
+	benchIterations = benchCmd.Flag("iterations", "Number of times to process the dump.").Default("100").Int()
+
+	loadTestCmd      = kingpin.Command("loadtest", "Scrape clones of a fixture SBC serving a saved dump, reporting the exporter's behavior at fleet scale.")
+	loadTestInput    = loadTestCmd.Flag("input", "Path to the saved dump the clones serve.").Required().String()
+	loadTestPath     = loadTestCmd.Flag("path", "API path the dump was downloaded from, and the clones are scraped for.").Default("stats/realtime").String()
+	loadTestTargets  = loadTestCmd.Flag("targets", "Number of clones scraped.").Default("100").Int()
+	loadTestWorkers  = loadTestCmd.Flag("workers", "Maximum number of clones scraped concurrently.").Default("10").Int()
+	loadTestInterval = loadTestCmd.Flag("interval", "Interval at which each clone is scraped.").Default("15s").Duration()
+	loadTestDuration = loadTestCmd.Flag("duration", "How long the load test runs.").Default("1m").Duration()
+
+	diffCmd      = kingpin.Command("diff", "Scrape a target twice and print the metrics that changed.")
+	diffTarget   = diffCmd.Flag("target", "Target to scrape.").Required().String()
+	diffInterval = diffCmd.Flag("interval", "Time between the scrapes.").Default("10s").Duration()
+
+	explainCmd    = kingpin.Command("explain", "Print the metric each field of a saved dump or a target's downloads is exported as.")
+	explainInput  = explainCmd.Flag("input", "Path to a saved dump.").String()
+	explainPath   = explainCmd.Flag("path", "API path the saved dump was downloaded from.").Default("stats/realtime").String()
+	explainTarget = explainCmd.Flag("target", "Target to download from instead of a saved dump.").String()
+
+	checkConfigCmd   = kingpin.Command("check-config", "Check configuration files, or with --diff print what changes between two.")
+	checkConfigDiff  = checkConfigCmd.Flag("diff", "Print the targets, modules and settings that change from the first file to the second.").Bool()
+	checkConfigFiles = checkConfigCmd.Arg("files", "Configuration files to check.").Required().Strings()
+
+	snapshotCmd     = kingpin.Command("snapshot", "Scrape the configured targets once and save their state to a file, e.g. for a vendor support ticket.")
+	snapshotOutput  = snapshotCmd.Flag("output", "File the snapshot is written to, - for standard output.").Default("-").String()
+	snapshotFormat  = snapshotCmd.Flag("format", "Format of the snapshot, openmetrics or json.").Default("openmetrics").Enum("openmetrics", "json")
+	snapshotTargets = snapshotCmd.Flag("target", "Target to include, every configured target if not given.").Strings()
+	snapshotWorkers = snapshotCmd.Flag("workers", "Maximum number of targets scraped concurrently.").Default("10").Int()
+
+	dashboardCmd   = kingpin.Command("dashboard", "Print a Grafana dashboard of the exporter's metrics.")
+	dashboardTitle = dashboardCmd.Flag("title", "Title of the dashboard.").Default("Sansay SBC").String()
+
+	rulesCmd                = kingpin.Command("rules", "Print starter Prometheus alerting rules for the exporter's metrics.")
+	rulesJob                = rulesCmd.Flag("job", "Prometheus job scraping the SBCs through the exporter.").Default("sansay").String()
+	rulesTrunkUtilization   = rulesCmd.Flag("trunk-utilization", "Share of a trunk group's session limit in use to alert on.").Default("0.9").Float64()
+	rulesLicenseUtilization = rulesCmd.Flag("license-utilization", "Share of licensed capacity in use to alert on.").Default("0.9").Float64()
+	rulesFor                = rulesCmd.Flag("for", "How long a condition must hold before alerting.").Default("5m").Duration()
 
 	// Metrics about the sansay exporter itself.
 	sansayDuration = prometheus.NewSummary(
@@ -47,55 +122,259 @@ var (
 			Help: "Duration of collections by the sansay exporter",
 		},
 	)
+	// sansayDurationHistogram records the same durations in buckets, which
+	// unlike the summary can carry exemplars.
+	sansayDurationHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "sansay_collection_duration_histogram_seconds",
+			Help: "Duration of collections by the sansay exporter, in buckets",
+		},
+	)
 	sansayRequestErrors = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "sansay_request_errors_total",
 			Help: "Errors in requests to the sansay exporter",
 		},
 	)
+	sansayXMLRepairs = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "sansay_xml_repairs_total",
+			Help: "Unescaped ampersands escaped to parse downloads that were invalid XML",
+		},
+	)
+)
+
+var (
+	// contentHashes tracks the response bodies of each target across scrapes.
+	contentHashes = newContentTracker()
+	// intervalStats accumulates the completed interval stats of each target.
+	intervalStats = newIntervalTracker()
+	// tcdRecords counts the terminated call detail records of each target.
+	tcdRecords = newTCDTracker()
+	// backoffs holds the targets that asked to be retried later.
+	backoffs = newBackoffTracker()
+	// acceptedCredentials remembers which credentials each target accepted.
+	acceptedCredentials = newCredentialTracker()
+	// knownTrunks remembers the trunk groups of each target for zero-filling.
+	knownTrunks = newTrunkTracker()
+	// inFlight bounds the concurrent requests to each target.
+	inFlight = newInFlightLimiter()
+	// downloadRates paces the downloads from each target with a rate limit.
+	downloadRates = newRateLimiters()
+	// schemes remembers which scheme each falling back target answered on.
+	schemes = newSchemeTracker()
+	// managementCerts remembers the management certificate of each target.
+	managementCerts = newCertTracker()
+	// dataAnomalies counts the impossible trunk group rows of each target.
+	dataAnomalies = newAnomalyCounter()
+	// trunkThresholds counts the utilization threshold crossings of each
+	// target's trunk groups.
+	trunkThresholds = newThresholdTracker()
+	// busyHourPeaks keeps the hourly peaks of each polled target.
+	busyHourPeaks = newBusyHourTracker()
+	// derivedCPS keeps the trunk groups' call attempt counters of each
+	// target.
+	derivedCPS = newCPSTracker()
+	// smoothedSeriesState keeps the smoothed gauges of each target.
+	smoothedSeriesState = newSmoothingState()
+	// downloads shares the downloads of each target between modules.
+	downloads *downloadCache
+	// scrapeHistories keeps the last scrape outcomes of each target.
+	scrapeHistories *scrapeHistory
 )
 
 func init() {
 	version.Version = Version
 	prometheus.MustRegister(sansayDuration)
+	prometheus.MustRegister(sansayDurationHistogram)
 	prometheus.MustRegister(sansayRequestErrors)
+	prometheus.MustRegister(sansayXMLRepairs)
 	prometheus.MustRegister(version.NewCollector("sansay_exporter"))
 }
 
-func handler(w http.ResponseWriter, r *http.Request, logger log.Logger) {
-	useSoap := false
+func handler(w http.ResponseWriter, r *http.Request, conf *Config, poller *poller, logger log.Logger) {
 	target := r.URL.Query().Get("target")
 	if target == "" {
 		http.Error(w, "'target' parameter must be specified", 400)
-		sansayRequestErrors.Inc()
+		requestError(r)
 		return
 	}
-	username := r.URL.Query().Get("username")
-	password := r.URL.Query().Get("password")
-	protocol := r.URL.Query().Get("protocol")
-	if protocol == "" {
-		protocol = "https"
-	}
-	api := r.URL.Query().Get("api")
-	if strings.ToLower(api) == "soap" {
-		useSoap = true
+
+	tenant, err := conf.RequestTenant(r)
+	if err != nil {
+		status := http.StatusForbidden
+		if err == errTenantUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sansay_exporter"`)
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), status)
+		requestError(r)
+		return
 	}
 
 	logger = log.With(logger, "target", target)
 	level.Debug(logger).Log("msg", "Starting scrape", "module")
 
 	start := time.Now()
+	module := r.URL.Query().Get("module")
+	paths, err := conf.Module(module)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		requestError(r)
+		return
+	}
 	registry := prometheus.NewRegistry()
-	collector := collector{target: fmt.Sprintf("%s://%s", protocol, target), targetPath: targetPath, useSoap: useSoap, username: username, password: password, logger: logger}
-	registry.MustRegister(collector)
+	// The target's metadata labels apply to its SBC metrics.
+	targetRegistry := prometheus.WrapRegistererWith(conf.TargetLabels(target), registry)
+	var outcome *scrapeOutcome
+	cached, polled := poller.result(target, module)
+	if polled {
+		// Background-polled targets are served from the last poll.
+		targetRegistry.MustRegister(cached)
+		if result, ok := cached.(*pollResult); ok {
+			outcome = result.outcome
+		}
+	} else {
+		collector, err := newCollector(target, conf.Target(target), r.URL.Query(), logger)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating client for target: %s", err), 400)
+			requestError(r)
+			return
+		}
+		collector.paths = paths
+		collector.downloads = downloads
+		collector.timeout = scrapeTimeout(r, *timeoutOffset)
+		outcome = &scrapeOutcome{}
+		collector.outcome = outcome
+		targetRegistry.MustRegister(collector)
+	}
 	registry.MustRegister(version.NewCollector("sansay_exporter"))
 
+	var gatherer prometheus.Gatherer = registry
+	if !polled && conf.HasTarget(target) {
+		gatherer = historyGatherer{Gatherer: gatherer, history: scrapeHistories, target: target, module: module, start: start}
+	}
+	if conf.Target(target).HAPeer != "" {
+		gatherer = newHAGatherer(gatherer, conf, target, module, paths, scrapeTimeout(r, *timeoutOffset), poller, logger)
+	}
+	if tenant != "" {
+		gatherer = newTenantGatherer(gatherer, tenant, conf.Target(target).TrunkCustomers)
+	}
+	if len(conf.MetricSmoothing) > 0 {
+		gatherer = smoothingGatherer{Gatherer: gatherer, smoothing: conf.MetricSmoothing, state: smoothedSeriesState, target: target}
+	}
+	if len(conf.MetricAliases) > 0 {
+		gatherer = aliasGatherer{Gatherer: gatherer, aliases: conf.MetricAliases}
+	}
+	if rules := conf.RelabelConfigs(target); len(rules) > 0 {
+		gatherer = relabelGatherer{Gatherer: gatherer, rules: rules}
+	}
+
+	if *failOn != "any" {
+		gatherer = failOnGatherer{Gatherer: gatherer, failOn: *failOn, outcome: outcome}
+	}
+
+	gatherer = summaryGatherer{Gatherer: gatherer, header: w.Header(), start: start}
+
 	// Delegate http serving to Prometheus client library, which will call collector.Collect.
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
+	h := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	recorder := &statusRecorder{ResponseWriter: w}
+	h.ServeHTTP(recorder, r)
 	duration := time.Since(start).Seconds()
-	sansayDuration.Observe(duration)
+	observeDuration(r, duration)
 	level.Debug(logger).Log("msg", "Finished scrape", "duration_seconds", duration)
+	logRequest(logger, time.Since(start), "request", "probe", "module", module, "remote_addr", r.RemoteAddr, "status_code", recorder.status, "bytes", recorder.bytes)
+}
+
+// newCollector builds the collector scraping target.  Non-empty URL
+// parameters override the target's configuration.
+func newCollector(target string, targetConf *Target, params url.Values, logger log.Logger) (collector, error) {
+	useSoap := false
+	username := paramOrDefault(params, "username", targetConf.Username)
+	password := paramOrDefault(params, "password", targetConf.Password)
+	protocol := paramOrDefault(params, "protocol", targetConf.Protocol)
+	if protocol == "" {
+		protocol = "https"
+	}
+	api := paramOrDefault(params, "api", targetConf.API)
+	if strings.ToLower(api) == "soap" {
+		useSoap = true
+	}
+
+	client, err := newHTTPClient(targetConf)
+	if err != nil {
+		return collector{}, err
+	}
+	client.Transport = &certRoundTripper{certs: managementCerts, next: client.Transport}
+	// A protocol given on the request is used on its own.
+	if targetConf.ProtocolFallback && params.Get("protocol") == "" {
+		client.Transport = &schemeFallbackRoundTripper{schemes: schemes, next: client.Transport}
+	}
+	limit := *maxInFlight
+	if targetConf.MaxInFlight > 0 {
+		limit = targetConf.MaxInFlight
+	}
+	if limit > 0 {
+		client.Transport = &inFlightRoundTripper{slots: inFlight.slots(target, limit), next: client.Transport}
+	}
+	if targetConf.RateLimit > 0 {
+		client.Transport = &throttleRoundTripper{limiter: downloadRates.limiter(target, targetConf.RateLimit), next: client.Transport}
+	}
+	collector := collector{target: fmt.Sprintf("%s://%s", protocol, target), targetPath: targetPath, useSoap: useSoap, username: username, password: password, logger: logger, client: client, content: contentHashes}
+	collector.budget = targetConf.Budget
+	collector.backoff = backoffs
+	collector.certs = managementCerts
+	// Credentials given on the request replace the configured ones.
+	if params.Get("username") == "" && params.Get("password") == "" {
+		collector.fallback = targetConf.FallbackCredentials
+	}
+	collector.credentials = acceptedCredentials
+	collector.anomalies = dataAnomalies
+	collector.utilization = targetConf.UtilizationThreshold
+	if len(targetConf.UtilizationThresholds) > 0 {
+		collector.thresholds = trunkThresholds
+		collector.thresholdLevels = targetConf.UtilizationThresholds
+	}
+	if targetConf.DerivedCPS {
+		collector.cps = derivedCPS
+	}
+	collector.topTrunks = targetConf.TopTrunks
+	collector.units = targetConf.Units
+	collector.strict = *strictMode
+	collector.unknownTables = *unknownTables
+	if len(targetConf.KnownFields) > 0 {
+		collector.knownFields = map[string]bool{}
+		for _, field := range targetConf.KnownFields {
+			collector.knownFields[field] = true
+		}
+	}
+	collector.topTrunksBy = targetConf.TopTrunksBy
+	collector.customers = targetConf.TrunkCustomers
+	collector.sipTLS = targetConf.SIPTLS
+	collector.sipTLSDial = targetDialContext(targetConf, &net.Dialer{})
+	collector.nativePath = targetConf.NativeMetrics
+	collector.nativePrefix = targetConf.NativeMetricsPrefix
+	if targetConf.IntervalStats {
+		collector.intervals = intervalStats
+		collector.intervalTimestamps = targetConf.IntervalTimestamps
+	}
+	if targetConf.TCD {
+		collector.tcd = tcdRecords
+	}
+	if len(targetConf.Trunks) > 0 || targetConf.TrunkRetention > 0 {
+		collector.trunks = knownTrunks
+		collector.provisioned = targetConf.Trunks
+		collector.trunkRetention = targetConf.TrunkRetention
+	}
+	return collector, nil
+}
+
+// paramOrDefault returns the named URL parameter, or def if it is not set.
+func paramOrDefault(params url.Values, name, def string) string {
+	if v := params.Get(name); v != "" {
+		return v
+	}
+	return def
 }
 
 func main() {
@@ -104,25 +383,269 @@ func main() {
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
-	logger := promlog.New(promlogConfig)
+	command := kingpin.Parse()
+	logger := newLogger(promlogConfig, *logDedupInterval)
+
+	switch command {
+	case benchCmd.FullCommand():
+		result, err := runBench(*benchInput, *benchPath, *benchIterations)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error benchmarking dump", "err", err)
+			os.Exit(1)
+		}
+		result.print(os.Stdout)
+		return
+	case checkConfigCmd.FullCommand():
+		var identities []age.Identity
+		if *ageKeyFile != "" {
+			var err error
+			if identities, err = loadIdentities(*ageKeyFile); err != nil {
+				level.Error(logger).Log("msg", "Error loading age key file", "err", err)
+				os.Exit(1)
+			}
+		}
+		if err := runCheckConfig(os.Stdout, *checkConfigFiles, *checkConfigDiff, identities...); err != nil {
+			level.Error(logger).Log("msg", "Error checking config", "err", err)
+			os.Exit(1)
+		}
+		return
+	case loadTestCmd.FullCommand():
+		result, err := runLoadTest(loadTest{
+			file:     *loadTestInput,
+			path:     *loadTestPath,
+			targets:  *loadTestTargets,
+			workers:  *loadTestWorkers,
+			interval: *loadTestInterval,
+			duration: *loadTestDuration,
+		})
+		if err != nil {
+			level.Error(logger).Log("msg", "Error running load test", "err", err)
+			os.Exit(1)
+		}
+		result.print(os.Stdout)
+		return
+	case dashboardCmd.FullCommand():
+		if err := writeDashboard(os.Stdout, *dashboardTitle); err != nil {
+			level.Error(logger).Log("msg", "Error writing dashboard", "err", err)
+			os.Exit(1)
+		}
+		return
+	case rulesCmd.FullCommand():
+		thresholds := ruleThresholds{Job: *rulesJob, TrunkUtilization: *rulesTrunkUtilization, LicenseUtilization: *rulesLicenseUtilization, For: *rulesFor}
+		if err := writeRules(os.Stdout, thresholds); err != nil {
+			level.Error(logger).Log("msg", "Error writing rules", "err", err)
+			os.Exit(1)
+		}
+		return
+	case explainCmd.FullCommand():
+		if *explainInput != "" {
+			explanations, err := explainDump(*explainInput, *explainPath)
+			if err != nil {
+				level.Error(logger).Log("msg", "Error explaining dump", "err", err)
+				os.Exit(1)
+			}
+			printExplanations(os.Stdout, explanations)
+			return
+		}
+	}
 
 	level.Info(logger).Log("msg", "Starting sansay_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", version.BuildContext())
 
+	conf := &Config{}
+	var identities []age.Identity
+	if *configFile != "" {
+		var err error
+		if *ageKeyFile != "" {
+			identities, err = loadIdentities(*ageKeyFile)
+			if err != nil {
+				level.Error(logger).Log("msg", "Error loading age key file", "err", err)
+				os.Exit(1)
+			}
+		}
+		conf, err = LoadFile(*configFile, identities...)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error loading config", "err", err)
+			os.Exit(1)
+		}
+		for name, t := range conf.Targets {
+			if legacy := legacyTLS(t.TLS); len(legacy) > 0 {
+				level.Warn(logger).Log("msg", "Target allows insecure TLS, only use this on a trusted management network", "target", name, "insecure", strings.Join(legacy, ","))
+			}
+		}
+	}
+
+	if command == diffCmd.FullCommand() {
+		logger := log.With(logger, "target", *diffTarget)
+		collector, err := newCollector(*diffTarget, conf.Target(*diffTarget), nil, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error creating client for target", "err", err)
+			os.Exit(1)
+		}
+		collector.timeout = defaultScrapeTimeout
+		if err := runDiff(os.Stdout, collector, *diffInterval); err != nil {
+			level.Error(logger).Log("msg", "Error scraping target", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if command == snapshotCmd.FullCommand() {
+		names := *snapshotTargets
+		if len(names) == 0 {
+			names = conf.TargetNames()
+		}
+		s := takeSnapshot(names, *snapshotWorkers, func(name string) (prometheus.Collector, error) {
+			collector, err := newCollector(name, conf.Target(name), nil, log.With(logger, "target", name))
+			if err != nil {
+				return nil, err
+			}
+			collector.timeout = defaultScrapeTimeout
+			return collector, nil
+		})
+		for _, t := range s.Targets {
+			for _, err := range t.Errors {
+				level.Warn(logger).Log("msg", "Error scraping target for snapshot", "target", t.Target, "err", err)
+			}
+		}
+		if err := saveSnapshot(os.Stdout, *snapshotOutput, *snapshotFormat, s); err != nil {
+			level.Error(logger).Log("msg", "Error saving snapshot", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if command == explainCmd.FullCommand() {
+		if *explainTarget == "" {
+			level.Error(logger).Log("msg", "Either --input or --target must be given")
+			os.Exit(1)
+		}
+		logger := log.With(logger, "target", *explainTarget)
+		collector, err := newCollector(*explainTarget, conf.Target(*explainTarget), nil, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error creating client for target", "err", err)
+			os.Exit(1)
+		}
+		collector.timeout = explainTimeout
+		explanations, err := collector.explainTarget(scrapePaths)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error downloading from target", "err", err)
+			os.Exit(1)
+		}
+		printExplanations(os.Stdout, explanations)
+		return
+	}
+
+	if *strictMode && *unknownTables {
+		level.Error(logger).Log("msg", "--strict and --scrape.unknown-tables are mutually exclusive")
+		os.Exit(1)
+	}
+	if *pollSpread <= 0 || *pollSpread > 1 {
+		level.Error(logger).Log("msg", "Invalid spread, --background.spread must be above 0 and at most 1", "spread", *pollSpread)
+		os.Exit(1)
+	}
+	if *shardCount < 1 || *shardIndex < 0 || *shardIndex >= *shardCount {
+		level.Error(logger).Log("msg", "Invalid shard, --shard.index must be between 0 and --shard.count - 1", "index", *shardIndex, "count", *shardCount)
+		os.Exit(1)
+	}
+	shard := conf
+	if *shardCount > 1 {
+		shard = conf.Shard(*shardIndex, *shardCount)
+		level.Info(logger).Log("msg", "Sharding configured targets", "index", *shardIndex, "count", *shardCount, "targets", len(shard.Targets))
+	}
+
 	// Exit if in dry-run mode.
 	if *dryRun {
 		level.Info(logger).Log("msg", "Configuration parsed successfully")
 		return
 	}
 
-	http.Handle("/metrics", promhttp.Handler()) // Normal metrics endpoint for sansay exporter itself.
+	downloads = newDownloadCache(*cacheTTL)
+	scrapeHistories = newScrapeHistory(*historySize)
+	prometheus.MustRegister(newInternalsCollector(downloads, backoffs, inFlight, knownTrunks))
+
+	if *trunkStateFile != "" {
+		if err := knownTrunks.load(*trunkStateFile); err != nil {
+			level.Warn(logger).Log("msg", "Error loading trunk inventory, starting without it", "file", *trunkStateFile, "err", err)
+		}
+		go knownTrunks.run(*trunkStateFile, trunkStateInterval, logger)
+	}
+
+	targets := newRuntimeTargets(conf, shard)
+	targets.shardIndex, targets.shardCount = *shardIndex, *shardCount
+	targets.identities = identities
+
+	var api *admin
+	if *adminTokenFile != "" {
+		token, err := loadToken(*adminTokenFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error loading admin token", "err", err)
+			os.Exit(1)
+		}
+		api = newAdmin(targets, token, logger)
+		conf.adminToken = token
+		api.stateFile = *adminStateFile
+		if err := api.restore(); err != nil {
+			level.Error(logger).Log("msg", "Error loading admin state", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var poller *poller
+	if *pollInterval > 0 {
+		poller = newPoller(shard, *pollInterval, *pollWorkers, logger)
+		poller.maxAge = *pollMaxAge
+		poller.spread = *pollSpread
+		poller.jitter = *pollJitter
+		prometheus.MustRegister(poller)
+		go poller.run()
+	}
+	targets.poller = poller
+
+	if *kubernetesSD {
+		discovery, err := newInClusterDiscovery(*kubernetesNS, targets, log.With(logger, "discovery", "kubernetes"))
+		if err != nil {
+			level.Error(logger).Log("msg", "Error setting up Kubernetes discovery", "err", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(discovery)
+		go discovery.run(*kubernetesRefresh)
+	}
+
+	if *syslogAddress != "" {
+		receiver := newSyslogReceiver(log.With(logger, "receiver", "syslog"), syslogSources(*syslogAllowed, conf))
+		addr, err := receiver.listen(*syslogAddress)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error listening for syslog messages", "err", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(receiver)
+		level.Info(logger).Log("msg", "Receiving syslog messages", "address", addr)
+	}
+
+	// The exporter's own metrics (and profiling) stay on the default mux, the
+	// probe endpoints move to their own mux when they are served separately.
+	probeMux := http.DefaultServeMux
+	if *metricsAddress != "" {
+		probeMux = http.NewServeMux()
+	}
+	// Normal metrics endpoint for sansay exporter itself.
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: *enableExemplars})))
 	// Endpoint to do sansay scrapes.
-	http.HandleFunc("/sansay", func(w http.ResponseWriter, r *http.Request) {
-		handler(w, r, logger)
+	probeMux.HandleFunc("/sansay", func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, conf, poller, logger)
 	})
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	// Admin API adding and removing targets at runtime, and the recent scrape
+	// outcomes of each target.
+	if api != nil {
+		probeMux.Handle("/history", api.protect(scrapeHistories))
+		probeMux.Handle(adminPrefix, api)
+		probeMux.Handle(adminPrefix+"/", api)
+	}
+
+	probeMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
             <head>
             <title>Sansay Exporter</title>
@@ -149,9 +672,17 @@ func main() {
             </html>`))
 	})
 
-	level.Info(logger).Log("msg", "Listening on address", "address", *listenAddress)
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+	servers := []*http.Server{{Addr: *listenAddress, Handler: probeMux}}
+	if *metricsAddress != "" {
+		servers = append(servers, &http.Server{Addr: *metricsAddress, Handler: http.DefaultServeMux})
+	}
+	if err := run(servers, logger); err != nil {
 		level.Error(logger).Log("msg", "Error starting HTTP server", "err", err)
 		os.Exit(1)
 	}
+	if *trunkStateFile != "" {
+		if err := knownTrunks.save(*trunkStateFile); err != nil {
+			level.Error(logger).Log("msg", "Error saving trunk inventory", "file", *trunkStateFile, "err", err)
+		}
+	}
 }
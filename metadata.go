@@ -0,0 +1,90 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// validateMetadataLabel checks a mapping of a target's discovery metadata
+// to a label of its metrics and fills in the defaults.  Mappings are
+// relabeling rules applied to the metadata: the "replace" action joins the
+// source_labels' values with the separator and, if regex matches, sets
+// target_label to the expanded replacement.  The "labelmap" action copies the
+// value of every metadata key matching regex to the label named by the
+// expanded replacement.
+func validateMetadataLabel(m *RelabelConfig) error {
+	switch m.Action {
+	case "", "replace", "labelmap":
+	default:
+		return fmt.Errorf("action: %q is not replace or labelmap", m.Action)
+	}
+	if err := m.validate(); err != nil {
+		return err
+	}
+	if m.Action == "replace" {
+		if len(m.SourceLabels) == 0 {
+			return fmt.Errorf("source_labels: must be given for replace")
+		}
+		if !model.LabelName(m.TargetLabel).IsValid() {
+			return fmt.Errorf("target_label: %q is not a valid label name", m.TargetLabel)
+		}
+	}
+	return nil
+}
+
+// metadataLabels returns the labels the mappings derive from metadata.
+// Labels with an empty or invalid name or an empty value are left out.
+func metadataLabels(mappings []*RelabelConfig, metadata map[string]string) prometheus.Labels {
+	labels := prometheus.Labels{}
+	for _, m := range mappings {
+		switch m.Action {
+		case "replace":
+			values := make([]string, 0, len(m.SourceLabels))
+			for _, source := range m.SourceLabels {
+				values = append(values, metadata[source])
+			}
+			value := strings.Join(values, m.Separator)
+			match := m.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			labels[m.TargetLabel] = string(m.regex.ExpandString(nil, m.Replacement, value, match))
+		case "labelmap":
+			for key, value := range metadata {
+				match := m.regex.FindStringSubmatchIndex(key)
+				if match == nil {
+					continue
+				}
+				labels[string(m.regex.ExpandString(nil, m.Replacement, key, match))] = value
+			}
+		}
+	}
+	for name, value := range labels {
+		if value == "" || !model.LabelName(name).IsValid() {
+			delete(labels, name)
+		}
+	}
+	return labels
+}
+
+// TargetLabels returns the labels added to every metric of the named target,
+// derived from its metadata.
+func (c *Config) TargetLabels(name string) prometheus.Labels {
+	return metadataLabels(c.MetadataLabels, c.Target(name).Metadata)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetadataLabels(t *testing.T) {
+	metadata := map[string]string{
+		"site":          "dal1",
+		"rack":          "r12",
+		"tag_customer":  "acme",
+		"tag_tier":      "gold",
+		"environment":   "",
+		"neighbour-key": "x",
+	}
+	tests := []struct {
+		name     string
+		mappings []*RelabelConfig
+		want     prometheus.Labels
+	}{
+		{
+			name:     "Test that a source label is copied to the target label",
+			mappings: []*RelabelConfig{{SourceLabels: []string{"site"}, TargetLabel: "site"}},
+			want:     prometheus.Labels{"site": "dal1"},
+		},
+		{
+			name: "Test that source labels are joined and rewritten",
+			mappings: []*RelabelConfig{{
+				SourceLabels: []string{"site", "rack"},
+				Separator:    "/",
+				Regex:        "(.*)/r(.*)",
+				Replacement:  "$1-$2",
+				TargetLabel:  "location",
+			}},
+			want: prometheus.Labels{"location": "dal1-12"},
+		},
+		{
+			name:     "Test that a regex that does not match sets no label",
+			mappings: []*RelabelConfig{{SourceLabels: []string{"site"}, Regex: "lon.*", TargetLabel: "site"}},
+			want:     prometheus.Labels{},
+		},
+		{
+			name:     "Test that empty values set no label",
+			mappings: []*RelabelConfig{{SourceLabels: []string{"environment"}, TargetLabel: "environment"}},
+			want:     prometheus.Labels{},
+		},
+		{
+			name:     "Test that labelmap copies matching keys",
+			mappings: []*RelabelConfig{{Action: "labelmap", Regex: "tag_(.+)"}},
+			want:     prometheus.Labels{"customer": "acme", "tier": "gold"},
+		},
+		{
+			name:     "Test that labelmap drops invalid label names",
+			mappings: []*RelabelConfig{{Action: "labelmap", Regex: "neighbour.*", Replacement: "$0"}},
+			want:     prometheus.Labels{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, m := range tt.mappings {
+				if err := validateMetadataLabel(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := metadataLabels(tt.mappings, metadata); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, received %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMetadataLabelValidate(t *testing.T) {
+	for _, m := range []*RelabelConfig{
+		{TargetLabel: "site"},
+		{SourceLabels: []string{"site"}, TargetLabel: "0site"},
+		{SourceLabels: []string{"site"}, TargetLabel: "site", Regex: "("},
+		{SourceLabels: []string{"site"}, TargetLabel: "site", Action: "drop"},
+	} {
+		if err := validateMetadataLabel(m); err == nil {
+			t.Errorf("Expected an error validating %+v", m)
+		}
+	}
+}
+
+func TestHandlerMetadataLabels(t *testing.T) {
+	conf := &Config{
+		Targets:        map[string]*Target{"sbc1": {Metadata: map[string]string{"site": "dal1"}}},
+		MetadataLabels: []*RelabelConfig{{SourceLabels: []string{"site"}, TargetLabel: "site"}},
+	}
+	if err := validateMetadataLabel(conf.MetadataLabels[0]); err != nil {
+		t.Fatal(err)
+	}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	p.results[pollKey{target: "sbc1"}] = &pollResult{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(newDesc("sansay_system_cpu_idle", "", nil), prometheus.GaugeValue, 90),
+	}}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/sansay?target=sbc1", nil), conf, p, log.NewNopLogger())
+	if body := w.Body.String(); !strings.Contains(body, `sansay_system_cpu_idle{site="dal1"} 90`) {
+		t.Errorf("Expected the metadata label on the target's metrics, received %s", body)
+	}
+}
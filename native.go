@@ -0,0 +1,128 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// nativeAccept asks for the Prometheus text format, the only one parsed.
+const nativeAccept = "text/plain;version=0.0.4"
+
+// collectNative merges the metrics newer builds serve natively in the
+// Prometheus text format at c.nativePath into the scrape, their names
+// prefixed with c.nativePrefix.  Like the exporter's own metrics they get the
+// target's metadata labels and relabeling.
+func (c collector) collectNative(ch chan<- prometheus.Metric) {
+	families, err := c.fetchNative()
+	if err != nil {
+		level.Info(c.logger).Log("msg", "Error scraping native metrics", "path", c.nativePath, "err", err)
+		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+		return
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	series := 0
+	for _, name := range names {
+		family := families[name]
+		for _, m := range family.Metric {
+			metric, err := nativeMetric(c.nativePrefix+name, family, m)
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "Skipping native metric", "name", name, "err", err)
+				continue
+			}
+			ch <- metric
+			series++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_native_series", "Series merged from the metrics the target serves in the Prometheus format.", nil),
+		prometheus.GaugeValue,
+		float64(series))
+}
+
+// fetchNative downloads and parses the target's native metrics.
+func (c collector) fetchNative() (map[string]*dto.MetricFamily, error) {
+	target := c.target + c.nativePath
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = "http://" + target
+	}
+	resp, err := getWithCredentials(c, target, nativeAccept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: HTTP %d", errAuthFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Invalid response from server: %d", resp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// nativeMetric returns the series m of family as a metric named name.
+func nativeMetric(name string, family *dto.MetricFamily, m *dto.Metric) (prometheus.Metric, error) {
+	labels := make([]string, 0, len(m.Label))
+	values := make([]string, 0, len(m.Label))
+	for _, l := range m.Label {
+		labels = append(labels, l.GetName())
+		values = append(values, l.GetValue())
+	}
+	desc := prometheus.NewDesc(name, family.GetHelp(), labels, nil)
+	var metric prometheus.Metric
+	var err error
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, m.GetCounter().GetValue(), values...)
+	case dto.MetricType_GAUGE:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, m.GetGauge().GetValue(), values...)
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		quantiles := map[float64]float64{}
+		for _, q := range s.Quantile {
+			quantiles[q.GetQuantile()] = q.GetValue()
+		}
+		metric, err = prometheus.NewConstSummary(desc, s.GetSampleCount(), s.GetSampleSum(), quantiles, values...)
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		buckets := map[float64]uint64{}
+		for _, b := range h.Bucket {
+			buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+		}
+		metric, err = prometheus.NewConstHistogram(desc, h.GetSampleCount(), h.GetSampleSum(), buckets, values...)
+	default:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, m.GetUntyped().GetValue(), values...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.TimestampMs != nil {
+		metric = prometheus.NewMetricWithTimestamp(time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond)), metric)
+	}
+	return metric, nil
+}
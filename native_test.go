@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+const nativeText = `# HELP sip_requests_total SIP requests received.
+# TYPE sip_requests_total counter
+sip_requests_total{method="INVITE"} 12
+sip_requests_total{method="BYE"} 10
+# TYPE media_ports gauge
+media_ports 42
+# TYPE invite_seconds histogram
+invite_seconds_bucket{le="0.1"} 3
+invite_seconds_bucket{le="1"} 5
+invite_seconds_bucket{le="+Inf"} 6
+invite_seconds_sum 4.5
+invite_seconds_count 6
+`
+
+func TestCollectNative(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); r.URL.Path != "/metrics" || user != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(nativeText))
+	}))
+	defer server.Close()
+
+	c := collector{target: server.URL, username: "user", password: "pass", logger: log.NewNopLogger(),
+		nativePath: "/metrics", nativePrefix: "sansay_native_"}
+	expected := `
+# TYPE sansay_native_invite_seconds histogram
+sansay_native_invite_seconds_bucket{le="0.1"} 3
+sansay_native_invite_seconds_bucket{le="1"} 5
+sansay_native_invite_seconds_bucket{le="+Inf"} 6
+sansay_native_invite_seconds_sum 4.5
+sansay_native_invite_seconds_count 6
+# TYPE sansay_native_media_ports gauge
+sansay_native_media_ports 42
+# TYPE sansay_native_series gauge
+sansay_native_series 4
+# TYPE sansay_native_sip_requests_total counter
+sansay_native_sip_requests_total{method="BYE"} 10
+sansay_native_sip_requests_total{method="INVITE"} 12
+`
+	compareMetrics(t, c.collectNative, expected,
+		"sansay_native_invite_seconds", "sansay_native_media_ports", "sansay_native_series", "sansay_native_sip_requests_total")
+}
+
+func TestCollectNativeUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c := collector{target: server.URL, logger: log.NewNopLogger(), nativePath: "/metrics"}
+	if _, err := c.fetchNative(); err == nil {
+		t.Error("Expected an error for rejected credentials, received none")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseStats counts what a stats dump held.
+type parseStats struct {
+	tables, rows, fields float64
+	// skipped are the fields not exported for being unknown: those of
+	// unknown tables, unless exported generically, those of the realtime
+	// trunk table, and in strict mode those of system_stat.
+	skipped float64
+	// partial is 1 if the dump was truncated and its complete tables
+	// salvaged.
+	partial float64
+}
+
+// parseStats returns the counts of the dump.
+func (c collector) parseStats(sansay Sansay) parseStats {
+	stats := parseStats{}
+	if sansay.Partial {
+		stats.partial = 1
+	}
+	for _, table := range sansay.Database.Table {
+		stats.tables++
+		stats.rows += float64(len(table.Row))
+		for _, row := range table.Row {
+			stats.fields += float64(len(row.Field))
+		}
+		skipped := !knownTables[table.Name] && !c.unknownTables ||
+			table.Name == "XBResourceRealTimeStatList" ||
+			table.Name == "system_stat" && c.strict
+		if !skipped {
+			continue
+		}
+		unknown := map[string]bool{}
+		for _, name := range c.unknownFields(table) {
+			unknown[name] = true
+		}
+		for _, row := range table.Row {
+			for _, field := range row.Field {
+				if unknown[field.Name] {
+					stats.skipped++
+				}
+			}
+		}
+	}
+	return stats
+}
+
+// collectParseStats exports the counts of the dump downloaded from its path,
+// so a firmware change or a truncated download that empties the dump is
+// noticed even though the scrape succeeds, and whether it was cut short.
+func (c collector) collectParseStats(ch chan<- prometheus.Metric, sansay Sansay) {
+	stats := c.parseStats(sansay)
+	for _, m := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"sansay_parse_tables", "Tables in the dump downloaded from the path.", stats.tables},
+		{"sansay_parse_rows", "Rows in the tables of the dump downloaded from the path.", stats.rows},
+		{"sansay_parse_fields", "Fields in the rows of the dump downloaded from the path.", stats.fields},
+		{"sansay_parse_fields_skipped", "Fields of the dump downloaded from the path not exported for being unknown.", stats.skipped},
+		{"sansay_parse_partial", "Whether the dump downloaded from the path was truncated and only its complete tables exported.", stats.partial},
+	} {
+		ch <- prometheus.MustNewConstMetric(newDesc(m.name, m.help, []string{"path"}), prometheus.GaugeValue, m.value, sansay.Path)
+	}
+}
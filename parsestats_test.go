@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestParseStats(t *testing.T) {
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(schemaDump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		c    collector
+		want parseStats
+	}{
+		{
+			name: "Test that unknown realtime fields and unknown tables are skipped",
+			want: parseStats{tables: 3, rows: 3, fields: 18, skipped: 3},
+		},
+		{
+			name: "Test that unknown system_stat fields are skipped in strict mode",
+			c:    collector{strict: true},
+			want: parseStats{tables: 3, rows: 3, fields: 18, skipped: 4},
+		},
+		{
+			name: "Test that generically exported tables are not skipped",
+			c:    collector{unknownTables: true},
+			want: parseStats{tables: 3, rows: 3, fields: 18, skipped: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.parseStats(sansay); got != tt.want {
+				t.Errorf("Expected %+v, received %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// peerReachabilityFields are the realtime trunk member fields that may hold
+// the result of the SIP OPTIONS pings the SBC sends the member's peer.
+var peerReachabilityFields = []string{"optionPollStatus", "optionPoll", "optionsPingStatus", "keepAliveStatus", "peerStatus", "reachable"}
+
+// reachableValue converts a textual peer status to 1 (reachable) or 0, and
+// reports whether the status was recognized.
+func reachableValue(value string) (float64, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "up", "ok", "yes", "true", "reachable", "alive", "available", "in service":
+		return 1, true
+	case "0", "down", "no", "false", "unreachable", "dead", "unavailable", "timeout", "timed out", "failed", "out of service":
+		return 0, true
+	}
+	return 0, false
+}
+
+// peerEventFields are the realtime trunk member counters of the automatic
+// failovers away from the member's peer and of the times the SBC
+// temporarily blacklisted it, otherwise only found in the SBC's logs.
+var peerEventFields = []statField{
+	{"sansay_peer_failovers_total", "Calls failed over from the peer of a trunk group member to the next.", prometheus.CounterValue, 1, []string{"numFailover", "failoverCount", "numFailOver", "failovers"}},
+	{"sansay_peer_blacklistings_total", "Times the peer of a trunk group member was temporarily blacklisted.", prometheus.CounterValue, 1, []string{"numBlacklist", "blacklistCount", "numBlackList", "blacklistings"}},
+}
+
+// addPeerMetrics exports whether the peer of a trunk group member row
+// answers the SBC's keepalives, and its failover and blacklisting counters,
+// so a downed carrier peer shows individually rather than only as fewer
+// sessions on its trunk group.  Peers in seen were already exported and are
+// skipped.
+func addPeerMetrics(ch chan<- prometheus.Metric, trunk Trunk, fields map[string]string, seen map[string]bool) {
+	if trunk.Fqdn == "" || trunk.Fqdn == "Group" {
+		return
+	}
+	key := trunk.TrunkId + "/" + trunk.Fqdn + "/" + trunk.Node
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+	labels := []string{"trunkgroup", "fqdn"}
+	labelValues := []string{trunk.TrunkId, trunk.Fqdn}
+	if trunk.Node != "" {
+		labels = append(labels, "node")
+		labelValues = append(labelValues, trunk.Node)
+	}
+	if value, ok := reachableValue(firstField(fields, peerReachabilityFields...)); ok {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_peer_reachable", "Whether the peer of a trunk group member answers the SBC's SIP OPTIONS pings.", labels),
+			prometheus.GaugeValue,
+			value, labelValues...)
+	}
+	addStatFields(ch, fields, peerEventFields, labels, labelValues)
+}
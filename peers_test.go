@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestPeerReachable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="fqdn">10.0.0.1</field><field name="optionPollStatus">Up</field></row>
+<row><field name="trunkId">100</field><field name="fqdn">10.0.0.2</field><field name="optionPollStatus">Timeout</field></row>
+<row><field name="trunkId">100</field><field name="fqdn">10.0.0.2</field><field name="optionPollStatus">Up</field></row>
+<row><field name="trunkId">200</field><field name="fqdn">peer.example.com</field><field name="keepAliveStatus">disabled</field></row>
+<row><field name="trunkId">300</field><field name="fqdn">10.0.0.3</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_peer_reachable gauge
+sansay_peer_reachable{fqdn="10.0.0.1",trunkgroup="100"} 1
+sansay_peer_reachable{fqdn="10.0.0.2",trunkgroup="100"} 0
+`
+	compareCollection(t, dump, expected, "sansay_peer_reachable")
+}
+
+func TestPeerEvents(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="fqdn">10.0.0.1</field><field name="numFailover">3</field><field name="numBlacklist">1</field></row>
+<row><field name="trunkId">100</field><field name="fqdn">10.0.0.2</field><field name="failoverCount">0</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_peer_blacklistings_total counter
+sansay_peer_blacklistings_total{fqdn="10.0.0.1",trunkgroup="100"} 1
+# TYPE sansay_peer_failovers_total counter
+sansay_peer_failovers_total{fqdn="10.0.0.1",trunkgroup="100"} 3
+sansay_peer_failovers_total{fqdn="10.0.0.2",trunkgroup="100"} 0
+`
+	compareCollection(t, dump, expected, "sansay_peer_blacklistings_total", "sansay_peer_failovers_total")
+}
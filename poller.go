@@ -0,0 +1,423 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poller polls the configured targets in the background with a bounded pool
+// of workers, and keeps the metrics of each target's last poll.  Every target
+// is polled for the full set of paths and for each configured module, at the
+// module's, the target's or the global interval.  Polls are spread across
+// their interval by a hash of the target and module, so a large fleet isn't
+// polled in a single burst.
+type poller struct {
+	conf     *Config
+	interval time.Duration
+	workers  int
+	logger   log.Logger
+	// maxAge is how old a target's last poll may be before its metrics are
+	// no longer served, 0 to always serve them.
+	maxAge time.Duration
+	// spread is the share of the interval the polls' offsets are spread
+	// across, and jitter the maximum random delay added to each poll.
+	spread float64
+	jitter time.Duration
+
+	queue chan pollJob
+
+	mu        sync.Mutex
+	results   map[pollKey]*pollResult
+	inFlight  map[pollKey]bool
+	scheduled map[string]bool
+	// busy is the number of workers polling.
+	busy int
+
+	queueDepth  *prometheus.Desc
+	workerCount *prometheus.Desc
+	workersBusy *prometheus.Desc
+	targets     *prometheus.Desc
+	resultCount *prometheus.Desc
+	lag         prometheus.Summary
+	skipped     prometheus.Counter
+}
+
+// pollKey identifies the polls of a target's module, "" for the full set of
+// paths.
+type pollKey struct {
+	target, module string
+}
+
+type pollJob struct {
+	key pollKey
+	due time.Time
+}
+
+// pollResult holds the metrics of a target's last poll.
+type pollResult struct {
+	metrics []prometheus.Metric
+	time    time.Time
+	outcome *scrapeOutcome
+}
+
+func newPoller(conf *Config, interval time.Duration, workers int, logger log.Logger) *poller {
+	if workers < 1 {
+		workers = 1
+	}
+	return &poller{
+		conf:      conf,
+		interval:  interval,
+		workers:   workers,
+		logger:    logger,
+		spread:    1,
+		queue:     make(chan pollJob, len(conf.Targets)*(len(conf.Modules)+1)),
+		results:   map[pollKey]*pollResult{},
+		inFlight:  map[pollKey]bool{},
+		scheduled: map[string]bool{},
+		queueDepth: prometheus.NewDesc("sansay_poll_queue_depth",
+			"Targets due for a background poll waiting for a worker.", nil, nil),
+		workerCount: prometheus.NewDesc("sansay_poll_workers",
+			"Workers running the background polls.", nil, nil),
+		workersBusy: prometheus.NewDesc("sansay_poll_workers_busy",
+			"Workers running a background poll.", nil, nil),
+		targets: prometheus.NewDesc("sansay_poll_targets",
+			"Targets scheduled for background polls.", nil, nil),
+		resultCount: prometheus.NewDesc("sansay_poll_results",
+			"Results of background polls held for serving.", nil, nil),
+		lag: prometheus.NewSummary(prometheus.SummaryOpts{
+			Name: "sansay_poll_lag_seconds",
+			Help: "Delay between a background poll being due and a worker starting it.",
+		}),
+		skipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sansay_poll_skipped_total",
+			Help: "Background polls skipped because the target's previous poll was still running.",
+		}),
+	}
+}
+
+// run starts the workers and the schedule of every configured target and
+// module.
+func (p *poller) run() {
+	for i := 0; i < p.workers; i++ {
+		go p.work()
+	}
+	for _, name := range p.conf.TargetNames() {
+		p.add(name)
+	}
+}
+
+// modules returns the modules every target is polled for, "" for the full
+// set of paths.
+func (p *poller) modules() []string {
+	modules := []string{""}
+	for module := range p.conf.Modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// add starts the schedule of a target, unless it is already scheduled.
+func (p *poller) add(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.scheduled[name] {
+		return
+	}
+	p.scheduled[name] = true
+	for _, module := range p.modules() {
+		go p.schedule(pollKey{target: name, module: module})
+	}
+}
+
+// remove drops the results of a target that is no longer configured.  Its
+// schedule ends at its next poll.
+func (p *poller) remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.results {
+		if key.target == name {
+			delete(p.results, key)
+		}
+	}
+}
+
+// poke queues an immediate poll of every module of the target, and reports
+// whether the target is polled in the background.
+func (p *poller) poke(name string) bool {
+	if p == nil || !p.conf.HasTarget(name) {
+		return false
+	}
+	for _, module := range p.modules() {
+		key := pollKey{target: name, module: module}
+		p.mu.Lock()
+		busy := p.inFlight[key]
+		p.inFlight[key] = true
+		p.mu.Unlock()
+		if !busy {
+			go func() { p.queue <- pollJob{key: key, due: time.Now()} }()
+		}
+	}
+	return true
+}
+
+// refresh polls every module of the target right away and waits for the
+// polls, returning their outcomes and the modules that were already being
+// polled, which are not polled again.  It reports whether the target is
+// polled in the background.
+func (p *poller) refresh(name string) ([]scrapeRecord, []string, bool) {
+	if p == nil || !p.conf.HasTarget(name) {
+		return nil, nil, false
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		records []scrapeRecord
+		busy    []string
+	)
+	for _, module := range p.modules() {
+		key := pollKey{target: name, module: module}
+		p.mu.Lock()
+		inFlight := p.inFlight[key]
+		p.inFlight[key] = true
+		p.mu.Unlock()
+		if inFlight {
+			busy = append(busy, module)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record := p.poll(key)
+			p.mu.Lock()
+			delete(p.inFlight, key)
+			p.mu.Unlock()
+			mu.Lock()
+			records = append(records, record)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(records, func(i, j int) bool { return records[i].Module < records[j].Module })
+	return records, busy, true
+}
+
+// pollInterval returns how often the target's module is polled.
+func (p *poller) pollInterval(key pollKey) time.Duration {
+	if m, ok := p.conf.Modules[key.module]; ok && m.PollInterval > 0 {
+		return m.PollInterval
+	}
+	if t := p.conf.Target(key.target); t.PollInterval > 0 {
+		return t.PollInterval
+	}
+	return p.interval
+}
+
+// offset returns where in the interval the named poll happens.
+func (p *poller) offset(name string, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	window := uint64(float64(interval) * p.spread)
+	if window == 0 {
+		return 0
+	}
+	return time.Duration(h.Sum64() % window)
+}
+
+// delay returns the random delay added to a poll, at most the jitter and
+// less than the interval.
+func (p *poller) delay(interval time.Duration) time.Duration {
+	jitter := p.jitter
+	if jitter > interval {
+		jitter = interval
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// schedule queues a poll of the target's module once per interval.
+func (p *poller) schedule(key pollKey) {
+	interval := p.pollInterval(key)
+	name := key.target
+	if key.module != "" {
+		name += "/" + key.module
+	}
+	now := time.Now()
+	next := now.Truncate(interval).Add(p.offset(name, interval))
+	if next.Before(now) {
+		next = next.Add(interval)
+	}
+	for {
+		due := next.Add(p.delay(interval))
+		time.Sleep(time.Until(due))
+		if !p.conf.HasTarget(key.target) {
+			// The target was removed at runtime.
+			p.mu.Lock()
+			delete(p.scheduled, key.target)
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Lock()
+		busy := p.inFlight[key]
+		p.inFlight[key] = true
+		p.mu.Unlock()
+		if busy {
+			p.skipped.Inc()
+		} else {
+			p.queue <- pollJob{key: key, due: due}
+		}
+		next = next.Add(interval)
+		if now := time.Now(); next.Before(now) {
+			// Don't try to catch up on polls missed while the queue was full.
+			next = now.Truncate(interval).Add(p.offset(name, interval))
+			if next.Before(now) {
+				next = next.Add(interval)
+			}
+		}
+	}
+}
+
+func (p *poller) work() {
+	for job := range p.queue {
+		p.lag.Observe(time.Since(job.due).Seconds())
+		p.mu.Lock()
+		p.busy++
+		p.mu.Unlock()
+		p.poll(job.key)
+		p.mu.Lock()
+		p.busy--
+		delete(p.inFlight, job.key)
+		p.mu.Unlock()
+	}
+}
+
+// poll scrapes the target's module, stores the resulting metrics and
+// returns the outcome.
+func (p *poller) poll(key pollKey) scrapeRecord {
+	logger := log.With(p.logger, "target", key.target, "module", key.module)
+	c, err := newCollector(key.target, p.conf.Target(key.target), nil, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error creating collector for background poll", "err", err)
+		return scrapeRecord{Time: time.Now(), Module: key.module, Source: "poll", Error: err.Error()}
+	}
+	if key.module != "" {
+		if c.paths, err = p.conf.Module(key.module); err != nil {
+			level.Error(logger).Log("msg", "Error selecting module for background poll", "err", err)
+			return scrapeRecord{Time: time.Now(), Module: key.module, Source: "poll", Error: err.Error()}
+		}
+	}
+	c.downloads = downloads
+	if p.conf.Target(key.target).BusyHours {
+		c.busyHours = busyHourPeaks
+	}
+	c.timeout = defaultScrapeTimeout
+	if interval := p.pollInterval(key); interval < c.timeout {
+		c.timeout = interval
+	}
+
+	c.outcome = &scrapeOutcome{}
+
+	start := time.Now()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	result := &pollResult{time: time.Now(), outcome: c.outcome}
+	for m := range ch {
+		result.metrics = append(result.metrics, m)
+	}
+	record := pollRecord(key.module, start, result.metrics)
+	scrapeHistories.record(key.target, record)
+
+	p.mu.Lock()
+	p.results[key] = result
+	p.mu.Unlock()
+	return record
+}
+
+// result returns a collector replaying the last background poll of the
+// target's module, or false if the target is not polled in the background.
+func (p *poller) result(name, module string) (prometheus.Collector, bool) {
+	if p == nil {
+		return nil, false
+	}
+	if !p.conf.HasTarget(name) {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result, ok := p.results[pollKey{target: name, module: module}]
+	if !ok {
+		// Not polled yet, serve an empty result rather than scraping.
+		result = &pollResult{}
+	}
+	if p.maxAge > 0 && !result.time.IsZero() && time.Since(result.time) > p.maxAge {
+		// Stop serving outdated values so the target's series go stale.
+		result = &pollResult{time: result.time}
+	}
+	return result, true
+}
+
+// Describe implements prometheus.Collector.
+func (r *pollResult) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (r *pollResult) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range r.metrics {
+		ch <- m
+	}
+	if !r.time.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_poll_age_seconds", "Time since the target's last background poll.", nil),
+			prometheus.GaugeValue,
+			time.Since(r.time).Seconds())
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (p *poller) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.queueDepth
+	ch <- p.workerCount
+	ch <- p.workersBusy
+	ch <- p.targets
+	ch <- p.resultCount
+	p.lag.Describe(ch)
+	p.skipped.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p *poller) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(p.queueDepth, prometheus.GaugeValue, float64(len(p.queue)))
+	ch <- prometheus.MustNewConstMetric(p.workerCount, prometheus.GaugeValue, float64(p.workers))
+	p.mu.Lock()
+	busy, targets, results := p.busy, len(p.scheduled), len(p.results)
+	p.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(p.workersBusy, prometheus.GaugeValue, float64(busy))
+	ch <- prometheus.MustNewConstMetric(p.targets, prometheus.GaugeValue, float64(targets))
+	ch <- prometheus.MustNewConstMetric(p.resultCount, prometheus.GaugeValue, float64(results))
+	p.lag.Collect(ch)
+	p.skipped.Collect(ch)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPollerOffset(t *testing.T) {
+	p := newPoller(&Config{}, time.Minute, 1, log.NewNopLogger())
+	for _, name := range []string{"sbc1", "sbc2", "sbc3"} {
+		offset := p.offset(name, time.Minute)
+		if offset < 0 || offset >= time.Minute {
+			t.Errorf("Expected offset of %s within the interval, received %s", name, offset)
+		}
+		if offset != p.offset(name, time.Minute) {
+			t.Errorf("Expected a stable offset for %s", name)
+		}
+	}
+}
+
+func TestPollerPoll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<mysqldump><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table></database></mysqldump>`))
+	}))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+
+	conf := &Config{Targets: map[string]*Target{target: {Protocol: "http"}}}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	if _, ok := p.result("unknown", ""); ok {
+		t.Error("Expected no background result for an unconfigured target")
+	}
+	p.poll(pollKey{target: target})
+
+	cached, ok := p.result(target, "")
+	if !ok {
+		t.Fatal("Expected a background result for a configured target")
+	}
+	if len(cached.(*pollResult).metrics) == 0 {
+		t.Error("Expected the poll to store metrics")
+	}
+}
+
+func TestPollerMaxAge(t *testing.T) {
+	conf := &Config{Targets: map[string]*Target{"sbc1": {}}}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	p.maxAge = 5 * time.Minute
+	p.results[pollKey{target: "sbc1"}] = &pollResult{metrics: make([]prometheus.Metric, 3), time: time.Now().Add(-10 * time.Minute)}
+
+	cached, ok := p.result("sbc1", "")
+	if !ok {
+		t.Fatal("Expected a background result for a configured target")
+	}
+	if n := len(cached.(*pollResult).metrics); n != 0 {
+		t.Errorf("Expected no metrics from an expired poll, received %d", n)
+	}
+	if cached.(*pollResult).time.IsZero() {
+		t.Error("Expected the expired poll's time to be kept for its age")
+	}
+}
+
+func TestPollerInterval(t *testing.T) {
+	conf := &Config{
+		Targets: map[string]*Target{"sbc1": {}, "sbc2": {PollInterval: 30 * time.Second}},
+		Modules: map[string]*Module{"realtime": {Paths: []string{"stats/realtime"}, PollInterval: 15 * time.Second}, "full": {Paths: scrapePaths}},
+	}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	tests := []struct {
+		key  pollKey
+		want time.Duration
+	}{
+		{pollKey{target: "sbc1"}, time.Minute},
+		{pollKey{target: "sbc2"}, 30 * time.Second},
+		{pollKey{target: "sbc2", module: "full"}, 30 * time.Second},
+		{pollKey{target: "sbc2", module: "realtime"}, 15 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.pollInterval(tt.key); got != tt.want {
+			t.Errorf("Expected %v to be polled every %s, received %s", tt.key, tt.want, got)
+		}
+	}
+}
+
+func TestPollerSpread(t *testing.T) {
+	p := newPoller(&Config{}, time.Minute, 1, log.NewNopLogger())
+	p.spread = 0.25
+	p.jitter = 5 * time.Second
+	for _, name := range []string{"sbc1", "sbc2", "sbc3", "sbc4"} {
+		if offset := p.offset(name, time.Minute); offset < 0 || offset >= 15*time.Second {
+			t.Errorf("Expected offset of %s within the first quarter of the interval, received %s", name, offset)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if delay := p.delay(time.Minute); delay < 0 || delay >= 5*time.Second {
+			t.Fatalf("Expected a delay below the jitter, received %s", delay)
+		}
+	}
+	p.jitter = 0
+	if delay := p.delay(time.Minute); delay != 0 {
+		t.Errorf("Expected no delay without jitter, received %s", delay)
+	}
+}
+
+func TestPollerPoke(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<mysqldump><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table></database></mysqldump>`))
+	}))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+
+	conf := &Config{Targets: map[string]*Target{target: {Protocol: "http"}}}
+	p := newPoller(conf, time.Hour, 1, log.NewNopLogger())
+	go p.work()
+	if p.poke("unknown") {
+		t.Error("Expected no poke of an unconfigured target")
+	}
+	if !p.poke(target) {
+		t.Fatal("Expected a poke of a configured target")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cached, _ := p.result(target, "")
+		if len(cached.(*pollResult).metrics) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the poke to poll the target")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conf.RemoveTarget(target)
+	p.remove(target)
+	if _, ok := p.result(target, ""); ok {
+		t.Error("Expected no background result for a removed target")
+	}
+}
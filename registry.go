@@ -0,0 +1,93 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v2"
+)
+
+// runtimeTargets adds and removes targets while the exporter runs, for the
+// admin API and discovery, keeping the configuration, this replica's shard of
+// it and the background poller in step.
+type runtimeTargets struct {
+	conf *Config
+	// shard holds the targets polled in the background by this replica.
+	shard      *Config
+	shardIndex int
+	shardCount int
+	poller     *poller
+	identities []age.Identity
+}
+
+func newRuntimeTargets(conf, shard *Config) *runtimeTargets {
+	return &runtimeTargets{conf: conf, shard: shard, shardCount: 1}
+}
+
+// add adds or replaces the target with its secrets resolved, leaving t as
+// given so secret references rather than their values are persisted, and
+// polls it straight away if it is polled in the background.
+func (r *runtimeTargets) add(name string, t *Target) error {
+	resolved, err := copyTarget(t)
+	if err != nil {
+		return fmt.Errorf("target %q: %s", name, err)
+	}
+	if err := resolved.decryptSecrets(r.identities); err != nil {
+		return fmt.Errorf("target %q: %s", name, err)
+	}
+	if err := resolved.mapSecrets(cloudSecrets.fetch); err != nil {
+		return fmt.Errorf("target %q: %s", name, err)
+	}
+	if err := r.conf.AddTarget(name, resolved); err != nil {
+		return err
+	}
+	if r.shard != r.conf && targetShard(name, r.shardCount) == r.shardIndex {
+		if err := r.shard.AddTarget(name, resolved); err != nil {
+			return err
+		}
+	}
+	if r.poller != nil && r.shard.HasTarget(name) {
+		r.poller.add(name)
+		r.poller.poke(name)
+	}
+	return nil
+}
+
+// remove removes the named target, and reports whether it was configured.
+func (r *runtimeTargets) remove(name string) bool {
+	if !r.conf.RemoveTarget(name) {
+		return false
+	}
+	r.shard.RemoveTarget(name)
+	scrapeHistories.forget(name)
+	if r.poller != nil {
+		r.poller.remove(name)
+	}
+	return true
+}
+
+// copyTarget returns a deep copy of t.
+func copyTarget(t *Target) (*Target, error) {
+	content, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	c := &Target{}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
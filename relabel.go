@@ -0,0 +1,217 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// RelabelConfig rewrites the series the exporter serves, like a Prometheus
+// metric_relabel_config, for users who can't change the Prometheus
+// configuration.  The metric name is the __name__ label.  metadata_labels
+// are RelabelConfigs too, applied to a target's metadata.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// validate checks the rule and fills in the defaults.
+func (c *RelabelConfig) validate() error {
+	if c.Action == "" {
+		c.Action = "replace"
+	}
+	if c.Separator == "" {
+		c.Separator = ";"
+	}
+	if c.Regex == "" {
+		c.Regex = "(.*)"
+	}
+	if c.Replacement == "" {
+		c.Replacement = "$1"
+	}
+	var err error
+	if c.regex, err = regexp.Compile("^(?:" + c.Regex + ")$"); err != nil {
+		return fmt.Errorf("regex: %s", err)
+	}
+	switch c.Action {
+	case "replace":
+		if c.TargetLabel == "" {
+			return fmt.Errorf("target_label: must be given for replace")
+		}
+	case "keep", "drop":
+		if len(c.SourceLabels) == 0 {
+			return fmt.Errorf("source_labels: must be given for %s", c.Action)
+		}
+	case "labelmap", "labeldrop", "labelkeep":
+	default:
+		return fmt.Errorf("action: %q is not replace, keep, drop, labelmap, labeldrop or labelkeep", c.Action)
+	}
+	return nil
+}
+
+// relabel applies the rules to the labels of a series, including __name__,
+// and returns the result, or nil if the series is dropped.
+func relabel(rules []*RelabelConfig, labels map[string]string) map[string]string {
+	for _, c := range rules {
+		values := make([]string, 0, len(c.SourceLabels))
+		for _, source := range c.SourceLabels {
+			values = append(values, labels[source])
+		}
+		value := strings.Join(values, c.Separator)
+		switch c.Action {
+		case "replace":
+			match := c.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			target := string(c.regex.ExpandString(nil, c.TargetLabel, value, match))
+			if !model.LabelName(target).IsValid() && target != model.MetricNameLabel {
+				continue
+			}
+			replacement := string(c.regex.ExpandString(nil, c.Replacement, value, match))
+			if replacement == "" {
+				delete(labels, target)
+			} else {
+				labels[target] = replacement
+			}
+		case "keep":
+			if !c.regex.MatchString(value) {
+				return nil
+			}
+		case "drop":
+			if c.regex.MatchString(value) {
+				return nil
+			}
+		case "labelmap":
+			mapped := map[string]string{}
+			for name, v := range labels {
+				if match := c.regex.FindStringSubmatchIndex(name); match != nil {
+					mapped[string(c.regex.ExpandString(nil, c.Replacement, name, match))] = v
+				}
+			}
+			for name, v := range mapped {
+				labels[name] = v
+			}
+		case "labeldrop", "labelkeep":
+			for name := range labels {
+				if name == model.MetricNameLabel {
+					continue
+				}
+				if c.regex.MatchString(name) == (c.Action == "labeldrop") {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	if !model.IsValidMetricName(model.LabelValue(labels[model.MetricNameLabel])) {
+		return nil
+	}
+	return labels
+}
+
+// relabelGatherer applies relabeling rules to the series of a gatherer.
+// Series the rules make collide with an earlier one, or move into a metric of
+// another type, are dropped with an error, as a registry does.
+type relabelGatherer struct {
+	prometheus.Gatherer
+	rules []*RelabelConfig
+}
+
+// Gather implements prometheus.Gatherer.
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	var errs prometheus.MultiError
+	if multi, ok := err.(prometheus.MultiError); ok {
+		errs = multi
+	} else {
+		errs.Append(err)
+	}
+	byName := map[string]*dto.MetricFamily{}
+	seen := map[string]bool{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			labels := map[string]string{model.MetricNameLabel: family.GetName()}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels = relabel(g.rules, labels); labels == nil {
+				continue
+			}
+			name := labels[model.MetricNameLabel]
+			delete(labels, model.MetricNameLabel)
+			pairs := labelPairs(labels)
+
+			out, ok := byName[name]
+			if !ok {
+				out = &dto.MetricFamily{Name: &name, Help: family.Help, Type: family.Type}
+				byName[name] = out
+			}
+			series := seriesName(name, pairs)
+			if out.GetType() != family.GetType() {
+				errs.Append(fmt.Errorf("metric %s relabeled from %s is a %s, but %s is a %s", series, family.GetName(), family.GetType(), name, out.GetType()))
+				continue
+			}
+			if seen[series] {
+				errs.Append(fmt.Errorf("metric %s relabeled from %s was collected before with the same name and label values", series, family.GetName()))
+				continue
+			}
+			seen[series] = true
+			m.Label = pairs
+			out.Metric = append(out.Metric, m)
+		}
+	}
+	result := make([]*dto.MetricFamily, 0, len(byName))
+	for _, family := range byName {
+		if len(family.Metric) > 0 {
+			result = append(result, family)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, errs.MaybeUnwrap()
+}
+
+// labelPairs returns the labels as label pairs sorted by name.
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]*dto.LabelPair, 0, len(names))
+	for _, name := range names {
+		name, value := name, labels[name]
+		pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return pairs
+}
+
+// RelabelConfigs returns the relabeling rules applied to the named target's
+// series, those of the file followed by the target's own.
+func (c *Config) RelabelConfigs(name string) []*RelabelConfig {
+	rules := append([]*RelabelConfig{}, c.MetricRelabelConfigs...)
+	return append(rules, c.Target(name).MetricRelabelConfigs...)
+}
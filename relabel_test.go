@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRelabel(t *testing.T) {
+	series := func() map[string]string {
+		return map[string]string{"__name__": "sansay_trunk_numorig", "trunkgroup": "100", "alias": "carrier-a"}
+	}
+	tests := []struct {
+		name  string
+		rules []*RelabelConfig
+		want  map[string]string
+	}{
+		{
+			name:  "Test that replace rewrites a label value",
+			rules: []*RelabelConfig{{SourceLabels: []string{"alias"}, Regex: "carrier-(.*)", TargetLabel: "carrier"}},
+			want:  map[string]string{"__name__": "sansay_trunk_numorig", "trunkgroup": "100", "alias": "carrier-a", "carrier": "a"},
+		},
+		{
+			name:  "Test that replace renames the metric",
+			rules: []*RelabelConfig{{SourceLabels: []string{"__name__"}, Regex: "sansay_(.*)", TargetLabel: "__name__", Replacement: "sbc_$1"}},
+			want:  map[string]string{"__name__": "sbc_trunk_numorig", "trunkgroup": "100", "alias": "carrier-a"},
+		},
+		{
+			name:  "Test that an empty replacement removes the label",
+			rules: []*RelabelConfig{{SourceLabels: []string{"alias"}, TargetLabel: "alias", Regex: ".*", Replacement: "$0x"}, {SourceLabels: []string{"missing"}, TargetLabel: "alias"}},
+			want:  map[string]string{"__name__": "sansay_trunk_numorig", "trunkgroup": "100"},
+		},
+		{
+			name:  "Test that drop drops matching series",
+			rules: []*RelabelConfig{{SourceLabels: []string{"trunkgroup"}, Regex: "1.*", Action: "drop"}},
+		},
+		{
+			name:  "Test that keep drops series that do not match",
+			rules: []*RelabelConfig{{SourceLabels: []string{"trunkgroup"}, Regex: "2.*", Action: "keep"}},
+		},
+		{
+			name:  "Test that labelmap copies labels",
+			rules: []*RelabelConfig{{Regex: "trunk(.*)", Replacement: "trunk_$1", Action: "labelmap"}},
+			want:  map[string]string{"__name__": "sansay_trunk_numorig", "trunkgroup": "100", "trunk_group": "100", "alias": "carrier-a"},
+		},
+		{
+			name:  "Test that labeldrop removes labels but not the name",
+			rules: []*RelabelConfig{{Regex: "alias|__name__", Action: "labeldrop"}},
+			want:  map[string]string{"__name__": "sansay_trunk_numorig", "trunkgroup": "100"},
+		},
+		{
+			name:  "Test that labelkeep keeps only matching labels",
+			rules: []*RelabelConfig{{Regex: "trunkgroup", Action: "labelkeep"}},
+			want:  map[string]string{"__name__": "sansay_trunk_numorig", "trunkgroup": "100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range tt.rules {
+				if err := c.validate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := relabel(tt.rules, series()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, received %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRelabelConfigValidate(t *testing.T) {
+	for _, c := range []*RelabelConfig{
+		{SourceLabels: []string{"alias"}},
+		{Action: "drop"},
+		{SourceLabels: []string{"alias"}, Action: "hashmod"},
+		{SourceLabels: []string{"alias"}, TargetLabel: "alias", Regex: "("},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("Expected an error validating %+v", c)
+		}
+	}
+}
+
+func TestHandlerRelabel(t *testing.T) {
+	conf := &Config{
+		Targets: map[string]*Target{"sbc1": {MetricRelabelConfigs: []*RelabelConfig{
+			{SourceLabels: []string{"__name__"}, Regex: "sbc_system_cpu_busy", Action: "drop"},
+		}}},
+		MetricRelabelConfigs: []*RelabelConfig{
+			{SourceLabels: []string{"__name__"}, Regex: "sansay_(.*)", TargetLabel: "__name__", Replacement: "sbc_$1"},
+		},
+	}
+	for _, c := range append(conf.MetricRelabelConfigs, conf.Targets["sbc1"].MetricRelabelConfigs...) {
+		if err := c.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := newPoller(conf, time.Minute, 1, log.NewNopLogger())
+	p.results[pollKey{target: "sbc1"}] = &pollResult{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(newDesc("sansay_system_cpu_idle", "CPU idle", nil), prometheus.GaugeValue, 90),
+		prometheus.MustNewConstMetric(newDesc("sansay_system_cpu_busy", "CPU busy", nil), prometheus.GaugeValue, 10),
+	}}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/sansay?target=sbc1", nil), conf, p, log.NewNopLogger())
+	body := w.Body.String()
+	if !strings.Contains(body, "\nsbc_system_cpu_idle 90\n") {
+		t.Errorf("Expected the renamed metric, received %s", body)
+	}
+	if strings.Contains(body, "cpu_busy") {
+		t.Errorf("Expected the dropped metric to be left out, received %s", body)
+	}
+}
+
+func TestRelabelGathererCollision(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_cpu_idle", "CPU idle", nil), prometheus.GaugeValue, 90)
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_cpu_busy", "CPU busy", nil), prometheus.GaugeValue, 10)
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_cpu_total", "CPU time", nil), prometheus.CounterValue, 5)
+	}))
+	rules := []*RelabelConfig{
+		{SourceLabels: []string{"__name__"}, Regex: "sansay_cpu_.*", TargetLabel: "__name__", Replacement: "sansay_cpu"},
+	}
+	for _, c := range rules {
+		if err := c.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	families, err := relabelGatherer{Gatherer: registry, rules: rules}.Gather()
+	if err == nil {
+		t.Fatal("Expected an error for the colliding series")
+	}
+	multi, ok := err.(prometheus.MultiError)
+	if !ok || len(multi) != 2 {
+		t.Fatalf("Expected a duplicate series and a type conflict, received %v", err)
+	}
+	if !strings.Contains(multi[0].Error(), "sansay_cpu relabeled from sansay_cpu_idle was collected before") {
+		t.Errorf("Expected a duplicate series, received %v", multi[0])
+	}
+	if !strings.Contains(multi[1].Error(), "sansay_cpu relabeled from sansay_cpu_total is a COUNTER, but sansay_cpu is a GAUGE") {
+		t.Errorf("Expected a type conflict, received %v", multi[1])
+	}
+	if len(families) != 1 || len(families[0].Metric) != 1 || families[0].Metric[0].GetGauge().GetValue() != 10 {
+		t.Errorf("Expected only the first series under the new name, received %v", families)
+	}
+}
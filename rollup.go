@@ -0,0 +1,140 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rollupMetrics are the realtime trunk fields a trunk group's Group row
+// should report as the sum of its member rows.
+var rollupMetrics = []string{"NumOrig", "NumTerm", "Cps"}
+
+// trunkRollup holds a trunk group's Group row and the sums of its members.
+type trunkRollup struct {
+	group   *Trunk
+	members int
+	sums    map[string]float64
+}
+
+// trunkRollups compares the Group rows of the realtime trunk table with the
+// sum of their member rows, to catch firmware where the aggregate lags
+// behind its members.
+type trunkRollups map[string]*trunkRollup
+
+// rollup returns the rollup of the trunk's group, on the trunk's node.
+func (r trunkRollups) rollup(trunk Trunk) *trunkRollup {
+	key := trunk.TrunkId + "/" + trunk.Node
+	rollup, ok := r[key]
+	if !ok {
+		rollup = &trunkRollup{sums: map[string]float64{}}
+		r[key] = rollup
+	}
+	return rollup
+}
+
+// add records a row of the realtime trunk table.
+func (r trunkRollups) add(trunk Trunk) {
+	rollup := r.rollup(trunk)
+	if trunk.Fqdn == "Group" {
+		rollup.group = &trunk
+		return
+	}
+	rollup.members++
+	for _, metric := range rollupMetrics {
+		value, err := getField(&trunk, metric)
+		if err != nil {
+			continue
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			rollup.sums[metric] += v
+		}
+	}
+}
+
+// collect exports, for each trunk group with both a Group row and member
+// rows, how far the sum of the members is from the Group row.
+func (r trunkRollups) collect(ch chan<- prometheus.Metric) {
+	for _, rollup := range r {
+		if rollup.group == nil || rollup.members == 0 {
+			continue
+		}
+		labels, labelValues := trunkLabels(*rollup.group)
+		labels = append(labels, "field")
+		for _, metric := range rollupMetrics {
+			value, err := getField(rollup.group, metric)
+			if err != nil {
+				continue
+			}
+			group, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_trunk_member_discrepancy", "Sum of a trunk group's member rows minus its Group row.", labels),
+				prometheus.GaugeValue,
+				rollup.sums[metric]-group, append(labelValues, strings.ToLower(metric))...)
+		}
+	}
+}
+
+// defaultUtilizationThreshold is the share of its session limit in use above
+// which a trunk group counts as highly utilized.
+const defaultUtilizationThreshold = 0.8
+
+// trunkSummary totals the Group rows of the realtime trunk table, so simple
+// dashboards don't need to aggregate thousands of trunk series.
+type trunkSummary struct {
+	groups      int
+	sessions    float64
+	cps         float64
+	busy        int
+	utilization float64
+}
+
+// add records a trunk group's Group row.
+func (s *trunkSummary) add(group Trunk) {
+	s.groups++
+	orig, _ := strconv.ParseFloat(group.NumOrig, 64)
+	term, _ := strconv.ParseFloat(group.NumTerm, 64)
+	cps, _ := strconv.ParseFloat(group.Cps, 64)
+	s.sessions += orig + term
+	s.cps += cps
+	threshold := s.utilization
+	if threshold <= 0 {
+		threshold = defaultUtilizationThreshold
+	}
+	if limit, err := strconv.ParseFloat(group.TotalLimit, 64); err == nil && limit > 0 && (orig+term)/limit > threshold {
+		s.busy++
+	}
+}
+
+// collect exports the totals.
+func (s *trunkSummary) collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_trunk_groups", "Trunk groups in the realtime stats.", nil),
+		prometheus.GaugeValue, float64(s.groups))
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_sessions_active", "Originating and terminating sessions of all trunk groups.", nil),
+		prometheus.GaugeValue, s.sessions)
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_cps", "Calls per second of all trunk groups.", nil),
+		prometheus.GaugeValue, s.cps)
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_trunk_groups_over_utilization", "Trunk groups using more than the utilization threshold of their session limit.", nil),
+		prometheus.GaugeValue, float64(s.busy))
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestTrunkMemberDiscrepancy(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">10.0.0.1</field><field name="numOrig">6</field><field name="numTerm">1</field><field name="cps">1</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="numOrig">8</field><field name="numTerm">3</field><field name="cps">2</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">10.0.0.2</field><field name="numOrig">4</field><field name="numTerm">2</field><field name="cps">1</field></row>
+<row><field name="trunkId">200</field><field name="alias">customer</field><field name="fqdn">Group</field><field name="numOrig">5</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	expected := `
+# TYPE sansay_trunk_member_discrepancy gauge
+sansay_trunk_member_discrepancy{alias="carrier",field="cps",trunkgroup="100"} 0
+sansay_trunk_member_discrepancy{alias="carrier",field="numorig",trunkgroup="100"} 2
+sansay_trunk_member_discrepancy{alias="carrier",field="numterm",trunkgroup="100"} 0
+`
+	compareCollection(t, dump, expected, "sansay_trunk_member_discrepancy")
+}
+
+func TestTrunkSummary(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="numOrig">50</field><field name="numTerm">35</field><field name="cps">4</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">10.0.0.1</field><field name="numOrig">50</field><field name="numTerm">35</field><field name="cps">4</field></row>
+<row><field name="trunkId">200</field><field name="alias">customer</field><field name="fqdn">Group</field><field name="numOrig">5</field><field name="numTerm">0</field><field name="cps">1.5</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">300</field><field name="alias">unlimited</field><field name="fqdn">Group</field><field name="numOrig">10</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	expected := `
+# TYPE sansay_cps gauge
+sansay_cps 5.5
+# TYPE sansay_sessions_active gauge
+sansay_sessions_active 100
+# TYPE sansay_trunk_groups gauge
+sansay_trunk_groups 3
+# TYPE sansay_trunk_groups_over_utilization gauge
+sansay_trunk_groups_over_utilization 1
+`
+	compareCollection(t, dump, expected, "sansay_cps", "sansay_sessions_active", "sansay_trunk_groups", "sansay_trunk_groups_over_utilization")
+}
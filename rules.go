@@ -0,0 +1,136 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ruleThresholds parameterize the generated alerting rules.
+type ruleThresholds struct {
+	// Job is the Prometheus job scraping the SBCs through the exporter.
+	Job string
+	// TrunkUtilization is the share of a trunk group's session limit in use
+	// that is alerted on.
+	TrunkUtilization float64
+	// LicenseUtilization is the share of licensed capacity in use that is
+	// alerted on.
+	LicenseUtilization float64
+	// For is how long a condition must hold before its alert fires.
+	For time.Duration
+}
+
+// ruleFile is a Prometheus rules file.
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// newRuleFile builds the starter alerting rules for the exporter's metrics.
+func newRuleFile(t ruleThresholds) ruleFile {
+	duration := formatDuration(t.For)
+	rules := []rule{
+		{
+			// A failed download fails the whole scrape.
+			Alert:  "SansayScrapeFailed",
+			Expr:   fmt.Sprintf(`up{job=%q} == 0`, t.Job),
+			For:    duration,
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "SBC {{ $labels.instance }} can't be scraped",
+				"description": "The exporter failed to download the stats of {{ $labels.instance }}.",
+			},
+		},
+		{
+			Alert:  "SansayTrunkUtilizationHigh",
+			Expr:   fmt.Sprintf(`sum by (instance, trunkgroup, alias) (sansay_trunk_numorig{job=%[1]q} + sansay_trunk_numterm{job=%[1]q}) / sum by (instance, trunkgroup, alias) (sansay_trunk_totallimit{job=%[1]q} > 0) > %[2]g`, t.Job, t.TrunkUtilization),
+			For:    duration,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Trunk group {{ $labels.alias }} on {{ $labels.instance }} is near its session limit",
+				"description": "{{ $value | humanizePercentage }} of the session limit of trunk group {{ $labels.trunkgroup }} is in use.",
+			},
+		},
+		{
+			Alert:  "SansayHAStateChanged",
+			Expr:   fmt.Sprintf(`sansay_ha_state_info{job=%[1]q} unless sansay_ha_state_info{job=%[1]q} offset 10m`, t.Job),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "SBC {{ $labels.instance }} changed HA state",
+				"description": "{{ $labels.instance }} has been {{ $labels.state }} for less than 10 minutes.",
+			},
+		},
+		{
+			Alert:  "SansayTranscodingLicenseNearLimit",
+			Expr:   fmt.Sprintf(`sansay_transcoding_sessions{job=%[1]q} / (sansay_transcoding_sessions_limit{job=%[1]q} > 0) > %[2]g`, t.Job, t.LicenseUtilization),
+			For:    duration,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "SBC {{ $labels.instance }} is near its licensed transcoding capacity",
+				"description": "{{ $value | humanizePercentage }} of the licensed transcoding sessions are in use.",
+			},
+		},
+		{
+			Alert:  "SansayMediaServerNearLimit",
+			Expr:   fmt.Sprintf(`sansay_mediaserver_sessions{job=%[1]q} / (sansay_mediaserver_sessions_limit{job=%[1]q} > 0) > %[2]g`, t.Job, t.LicenseUtilization),
+			For:    duration,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Media server {{ $labels.server }} on {{ $labels.instance }} is near its session limit",
+				"description": "{{ $value | humanizePercentage }} of the media server's sessions are in use.",
+			},
+		},
+	}
+	return ruleFile{Groups: []ruleGroup{{Name: "sansay", Rules: rules}}}
+}
+
+// formatDuration formats d as a Prometheus duration.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+// writeRules writes the alerting rules as a Prometheus rules file.
+func writeRules(w io.Writer, t ruleThresholds) error {
+	out, err := yaml.Marshal(newRuleFile(t))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
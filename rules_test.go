@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestWriteRules(t *testing.T) {
+	var out bytes.Buffer
+	thresholds := ruleThresholds{Job: "sbc", TrunkUtilization: 0.8, LicenseUtilization: 0.95, For: 10 * time.Minute}
+	if err := writeRules(&out, thresholds); err != nil {
+		t.Fatal(err)
+	}
+	var rules ruleFile
+	if err := yaml.UnmarshalStrict(out.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Groups) != 1 || len(rules.Groups[0].Rules) == 0 {
+		t.Fatalf("Expected one group of rules, received %+v", rules)
+	}
+
+	known := knownMetrics(t)
+	alerts := map[string]rule{}
+	for _, r := range rules.Groups[0].Rules {
+		alerts[r.Alert] = r
+		checkMetricRefs(t, known, r.Expr)
+		if !strings.Contains(r.Expr, `job="sbc"`) {
+			t.Errorf("Expected %s to select the job, received %s", r.Alert, r.Expr)
+		}
+	}
+	if r := alerts["SansayTrunkUtilizationHigh"]; !strings.HasSuffix(r.Expr, "> 0.8") || r.For != "10m" {
+		t.Errorf("Expected the trunk utilization threshold, received %+v", r)
+	}
+	if r := alerts["SansayTranscodingLicenseNearLimit"]; !strings.HasSuffix(r.Expr, "> 0.95") {
+		t.Errorf("Expected the license threshold, received %+v", r)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		0:                "",
+		90 * time.Second: "90s",
+		5 * time.Minute:  "5m",
+		2 * time.Hour:    "2h",
+	} {
+		if got := formatDuration(d); got != expected {
+			t.Errorf("Expected %q for %s, received %q", expected, d, got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// knownTables are the tables of the stats dumps the exporter processes.
+var knownTables = map[string]bool{}
+
+func init() {
+	for _, name := range []string{
+		"system_stat", "XBResourceRealTimeStatList", "ingress_stat", "gw_egress_stat",
+		"alarm", "alarm_stat", "active_alarm",
+		"response_code_stat", "sip_response_stat", "XBResourceResponseCodeStatList",
+		"media_quality_stat", "qos_stat", "XBResourceMediaQualityStatList",
+		"transcoding_stat", "dsp_stat", "XBTranscodingStatList",
+		"rtp_port_stat", "media_port_stat", "port_stat",
+		"blacklist", "dynamic_blacklist", "dyn_blacklist",
+		"emergency_stat", "e911_stat",
+		"radius_stat", "acct_server_stat", "billing_server_stat",
+		"dns_stat", "dns_resolver_stat",
+		"interval_stat", "XBResourceIntervalStatList",
+		"tcd", "tcd_record",
+	} {
+		knownTables[name] = true
+	}
+}
+
+// knownSystemFields are the system_stat fields exported as-is that the
+// exporter knows of, besides those with dedicated handling.
+var knownSystemFields = map[string]bool{
+	"cpu_idle":            true,
+	"mem_used_pct":        true,
+	"num_active_sessions": true,
+	"ha_pre_state":        true,
+}
+
+// isKnownSystemField reports whether the named system_stat field is known.
+func isKnownSystemField(name string) bool {
+	if knownSystemFields[name] || isNodeField(name) {
+		return true
+	}
+	if _, ok := systemFieldHandlers[name]; ok {
+		return true
+	}
+	for _, f := range statsTimestampFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownTrunkField reports whether the named realtime trunk table field is
+// known.
+func isKnownTrunkField(name string) bool {
+	if name == "" || isNodeField(name) {
+		return true
+	}
+	for _, fields := range [][]string{trunkTypeFields, peerReachabilityFields, trunkParentFields} {
+		for _, f := range fields {
+			if f == name {
+				return true
+			}
+		}
+	}
+	for _, defs := range [][]statField{trunkRejections, peerEventFields, trunkAttempts} {
+		for _, def := range defs {
+			for _, f := range def.fields {
+				if f == name {
+					return true
+				}
+			}
+		}
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	_, ok := reflect.TypeOf(Trunk{}).FieldByName(string(runes))
+	return ok
+}
+
+// unknownFields returns the sorted names of the fields of a table the
+// exporter doesn't know of, or every field of an unknown table.  Only the
+// tables whose fields are exported generically or by name are checked.
+func (c collector) unknownFields(table Table) []string {
+	var known func(string) bool
+	switch {
+	case !knownTables[table.Name]:
+		known = func(string) bool { return false }
+	case table.Name == "system_stat":
+		known = isKnownSystemField
+	case table.Name == "XBResourceRealTimeStatList":
+		known = isKnownTrunkField
+	default:
+		return nil
+	}
+	seen := map[string]bool{}
+	var unknown []string
+	for _, row := range table.Row {
+		for _, field := range row.Field {
+			if seen[field.Name] || known(field.Name) || c.knownFields[field.Name] {
+				continue
+			}
+			seen[field.Name] = true
+			unknown = append(unknown, field.Name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// checkSchema exports the number of unknown fields of a table, and in
+// strict mode fails the scrape if there are any.
+func (c collector) checkSchema(ch chan<- prometheus.Metric, table Table) {
+	unknown := c.unknownFields(table)
+	if len(unknown) == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_unknown_fields", "Fields of a table, or of an unknown table, the exporter doesn't know of.", []string{"table"}),
+		prometheus.GaugeValue, float64(len(unknown)), table.Name)
+	if c.strict {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil),
+			fmt.Errorf("unknown fields in table %s: %s", table.Name, strings.Join(unknown, ", ")))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const schemaDump = `<mysqldump><database name="stats">
+<table name="system_stat">
+<row><field name="cpu_idle">90</field><field name="fan_rpm">3000</field><field name="ntp_status">1</field></row>
+</table>
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">a</field><field name="fqdn">Group</field><field name="numOrig">1</field><field name="numTerm">1</field><field name="cps">1</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">10</field><field name="cpsLimit">5</field><field name="numCACReject">0</field><field name="numFoo">2</field></row>
+</table>
+<table name="new_feature_stat">
+<row><field name="a">1</field><field name="b">2</field></row>
+</table>
+</database></mysqldump>`
+
+func TestUnknownFields(t *testing.T) {
+	expected := `
+# TYPE sansay_fan_rpm gauge
+sansay_fan_rpm 3000
+# TYPE sansay_unknown_fields gauge
+sansay_unknown_fields{table="XBResourceRealTimeStatList"} 1
+sansay_unknown_fields{table="new_feature_stat"} 2
+sansay_unknown_fields{table="system_stat"} 1
+`
+	compareCollection(t, schemaDump, expected, "sansay_fan_rpm", "sansay_unknown_fields")
+}
+
+func TestStrictMode(t *testing.T) {
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(schemaDump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger(), strict: true, knownFields: map[string]bool{"numFoo": true}}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) { c.processCollection(ch, sansay) }))
+	families, err := registry.Gather()
+	if err == nil {
+		t.Fatal("Expected strict mode to fail the scrape")
+	}
+	for _, table := range []string{"system_stat: fan_rpm", "new_feature_stat: a, b"} {
+		if !strings.Contains(err.Error(), table) {
+			t.Errorf("Expected the unknown fields of %s in the error, received %s", table, err)
+		}
+	}
+	if strings.Contains(err.Error(), "numFoo") {
+		t.Errorf("Expected the configured known field to be accepted, received %s", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "sansay_fan_rpm" {
+			t.Error("Expected the unknown system_stat field not to be exported")
+		}
+	}
+}
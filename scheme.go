@@ -0,0 +1,107 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// schemeTracker remembers the scheme each target last answered on, for
+// targets that fall back between HTTPS and HTTP.
+type schemeTracker struct {
+	mu      sync.Mutex
+	schemes map[string]string
+}
+
+func newSchemeTracker() *schemeTracker {
+	return &schemeTracker{schemes: map[string]string{}}
+}
+
+// scheme returns the scheme the host last answered on, or def.
+func (t *schemeTracker) scheme(host, def string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if scheme, ok := t.schemes[host]; ok {
+		return scheme
+	}
+	return def
+}
+
+// answered records the scheme the host answered on.
+func (t *schemeTracker) answered(host, scheme string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.schemes[host] = scheme
+}
+
+// otherScheme returns the scheme to fall back to from scheme.
+func otherScheme(scheme string) string {
+	if scheme == "https" {
+		return "http"
+	}
+	return "https"
+}
+
+// schemeFallbackRoundTripper sends requests on the scheme the target last
+// answered on, and retries them on the other scheme when the connection
+// fails, easing migrations where only part of a fleet has management TLS
+// enabled.  Timeouts are not retried, as they would use up the rest of the
+// scrape.
+type schemeFallbackRoundTripper struct {
+	schemes *schemeTracker
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *schemeFallbackRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	scheme := rt.schemes.scheme(host, req.URL.Scheme)
+	resp, err := rt.next.RoundTrip(withScheme(req, scheme))
+	if err == nil {
+		rt.schemes.answered(host, scheme)
+		return resp, nil
+	}
+	if isTimeout(err) || req.Context().Err() != nil {
+		return nil, err
+	}
+	retry := withScheme(req, otherScheme(scheme))
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	resp, retryErr := rt.next.RoundTrip(retry)
+	if retryErr != nil {
+		// Report the error of the scheme the target is meant to answer on.
+		return nil, err
+	}
+	rt.schemes.answered(host, retry.URL.Scheme)
+	return resp, nil
+}
+
+// withScheme returns a copy of req sent to the given scheme.
+func withScheme(req *http.Request, scheme string) *http.Request {
+	if req.URL.Scheme == scheme {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = scheme
+	return req
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSchemeFallbackRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<xml/>"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	schemes := newSchemeTracker()
+	client := &http.Client{Transport: &schemeFallbackRoundTripper{schemes: schemes, next: http.DefaultTransport}}
+	resp, err := client.Get("https://" + host + "/")
+	if err != nil {
+		t.Fatalf("Expected the request to fall back to HTTP, received %v", err)
+	}
+	resp.Body.Close()
+	if got := schemes.scheme(host, "https"); got != "http" {
+		t.Errorf("Expected the target's scheme to be remembered as http, received %q", got)
+	}
+}
+
+func TestSchemeFallbackRoundTripperNoRetry(t *testing.T) {
+	schemes := newSchemeTracker()
+	client := &http.Client{Transport: &schemeFallbackRoundTripper{schemes: schemes, next: http.DefaultTransport}}
+	if _, err := client.Get("https://127.0.0.1:1/"); err == nil {
+		t.Fatal("Expected an error when neither scheme answers")
+	}
+	if got := schemes.scheme("127.0.0.1:1", "https"); got != "https" {
+		t.Errorf("Expected no scheme to be remembered, received %q", got)
+	}
+}
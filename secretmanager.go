@@ -0,0 +1,390 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Secrets kept in a cloud secret manager are referenced by these prefixes,
+// followed by the secret's ARN or name and optionally "#key" to pick a key
+// of a JSON secret.
+const (
+	awsSecretPrefix = "aws-secretsmanager:"
+	gcpSecretPrefix = "gcp-secretmanager:"
+)
+
+// secretManagers fetches the configured secrets kept in AWS Secrets Manager
+// and GCP Secret Manager.
+type secretManagers struct {
+	client *http.Client
+	now    func() time.Time
+	// awsEndpoint returns the Secrets Manager endpoint of the region.
+	awsEndpoint func(region string) string
+	awsMetadata string
+	gcpEndpoint string
+	gcpMetadata string
+}
+
+// cloudSecrets fetches the secrets referenced by configuration files.
+var cloudSecrets = newSecretManagers()
+
+func newSecretManagers() *secretManagers {
+	return &secretManagers{
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+		awsEndpoint: func(region string) string {
+			return fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+		},
+		awsMetadata: "http://169.254.169.254",
+		gcpEndpoint: "https://secretmanager.googleapis.com",
+		gcpMetadata: "http://metadata.google.internal",
+	}
+}
+
+// fetch returns the referenced secret, or value if it is not a reference.
+func (s *secretManagers) fetch(value string) (string, error) {
+	var secret string
+	var err error
+	switch {
+	case strings.HasPrefix(value, awsSecretPrefix):
+		id, key := splitSecretKey(strings.TrimPrefix(value, awsSecretPrefix))
+		if secret, err = s.fetchAWS(id); err != nil {
+			return "", fmt.Errorf("AWS Secrets Manager %s: %s", id, err)
+		}
+		return secretKey(secret, key)
+	case strings.HasPrefix(value, gcpSecretPrefix):
+		name, key := splitSecretKey(strings.TrimPrefix(value, gcpSecretPrefix))
+		if secret, err = s.fetchGCP(name); err != nil {
+			return "", fmt.Errorf("GCP Secret Manager %s: %s", name, err)
+		}
+		return secretKey(secret, key)
+	}
+	return value, nil
+}
+
+// splitSecretKey splits a secret reference into the secret and the JSON key.
+func splitSecretKey(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// secretKey returns the key of a JSON secret, or the whole secret if key is
+// empty.
+func secretKey(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("key %q of a secret that is not a JSON object", key)
+	}
+	value, ok := values[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no string key %q", key)
+	}
+	return value, nil
+}
+
+// do sends the request and decodes the JSON response into v.
+func (s *secretManagers) do(req *http.Request, v interface{}) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// awsCredentials are the credentials requests to AWS are signed with.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// fetchAWS returns the string value of an AWS Secrets Manager secret.  The
+// region is taken from the ARN, or from $AWS_REGION for secret names.
+func (s *secretManagers) fetchAWS(id string) (string, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		return "", errors.New("no region in the secret ARN or $AWS_REGION")
+	}
+	creds, err := s.awsCredentials()
+	if err != nil {
+		return "", fmt.Errorf("credentials: %s", err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequest("POST", s.awsEndpoint(region), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWS(req, body, creds, region, "secretsmanager", s.now())
+	var result struct {
+		SecretString string
+	}
+	if err := s.do(req, &result); err != nil {
+		return "", err
+	}
+	return result.SecretString, nil
+}
+
+// awsCredentials returns the credentials from the environment, or those of
+// the EC2 instance's role.
+func (s *secretManagers) awsCredentials() (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), Token: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	req, err := http.NewRequest("PUT", s.awsMetadata+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := s.metadata(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	get := func(path string) (string, error) {
+		req, err := http.NewRequest("GET", s.awsMetadata+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		return s.metadata(req)
+	}
+	role, err := get("")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	doc, err := get(strings.TrimSpace(strings.Split(role, "\n")[0]))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var creds awsCredentials
+	err = json.Unmarshal([]byte(doc), &creds)
+	return creds, err
+}
+
+// metadata returns the body of a request to an instance metadata server.
+func (s *secretManagers) metadata(req *http.Request) (string, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server: HTTP %d", resp.StatusCode)
+	}
+	return string(body), nil
+}
+
+// signAWS signs the request with AWS Signature Version 4.
+func signAWS(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{req.Method, path, query, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payload[:])}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hashed[:])}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// fetchGCP returns the payload of a GCP Secret Manager secret version, the
+// latest one if the name has no version.
+func (s *secretManagers) fetchGCP(name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	token, err := s.gcpToken()
+	if err != nil {
+		return "", fmt.Errorf("credentials: %s", err)
+	}
+	req, err := http.NewRequest("GET", s.gcpEndpoint+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := s.do(req, &result); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	return string(data), err
+}
+
+// gcpToken returns an OAuth access token for the service account key in
+// $GOOGLE_APPLICATION_CREDENTIALS, or for the instance's service account.
+func (s *secretManagers) gcpToken() (string, error) {
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if filename := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); filename != "" {
+		assertion, tokenURI, err := s.gcpAssertion(filename)
+		if err != nil {
+			return "", err
+		}
+		form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+		req, err := http.NewRequest("POST", tokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		err = s.do(req, &result)
+		return result.AccessToken, err
+	}
+	req, err := http.NewRequest("GET", s.gcpMetadata+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	err = s.do(req, &result)
+	return result.AccessToken, err
+}
+
+// gcpAssertion returns a JWT signed with a service account key file, to be
+// exchanged for an access token at the returned URI.
+func (s *secretManagers) gcpAssertion(filename string) (string, string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", "", err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(content, &key); err != nil {
+		return "", "", err
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", "", errors.New("service account key has no PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", "", err
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", "", errors.New("service account key is not an RSA key")
+	}
+
+	now := s.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/cloud-platform",
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), key.TokenURI, nil
+}
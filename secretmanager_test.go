@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSignAWS(t *testing.T) {
+	// The example request of the AWS Signature Version 4 documentation.
+	req, _ := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWS(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Unexpected signature, want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFetchAWSSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || r.Header.Get("Authorization") == "" {
+			http.Error(w, "unsigned", 400)
+			return
+		}
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"username":"user","password":"` + req.SecretId + `"}`})
+	}))
+	defer server.Close()
+	for name, value := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	s := newSecretManagers()
+	var region string
+	s.awsEndpoint = func(r string) string {
+		region = r
+		return server.URL
+	}
+	got, err := s.fetch("aws-secretsmanager:arn:aws:secretsmanager:eu-west-1:123456789012:secret:sbc#password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "arn:aws:secretsmanager:eu-west-1:123456789012:secret:sbc" {
+		t.Errorf("Expected the secret's password key, received %q", got)
+	}
+	if region != "eu-west-1" {
+		t.Errorf("Expected the ARN's region, received %q", region)
+	}
+}
+
+func TestFetchGCPSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing header", 403)
+				return
+			}
+			w.Write([]byte(`{"access_token":"token"}`))
+		case "/v1/projects/p/secrets/sbc/versions/latest:access":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				http.Error(w, "unauthenticated", 401)
+				return
+			}
+			w.Write([]byte(`{"payload":{"data":"c2VjcmV0"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	s := newSecretManagers()
+	s.gcpEndpoint = server.URL
+	s.gcpMetadata = server.URL
+	got, err := s.fetch("gcp-secretmanager:projects/p/secrets/sbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "secret" {
+		t.Errorf("Expected the secret's payload, received %q", got)
+	}
+	if got, _ := s.fetch("plain"); got != "plain" {
+		t.Errorf("Expected values without a prefix to be kept, received %q", got)
+	}
+}
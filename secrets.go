@@ -0,0 +1,104 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageHeader starts binary age files.
+const ageHeader = "age-encryption.org/v1"
+
+var errNoIdentities = errors.New("encrypted with age, but no age key file given")
+
+// loadIdentities reads the age identities of a key file, as written by
+// age-keygen.
+func loadIdentities(filename string) ([]age.Identity, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return age.ParseIdentities(f)
+}
+
+// isEncrypted reports whether content is encrypted with age, armored or not.
+func isEncrypted(content []byte) bool {
+	content = bytes.TrimSpace(content)
+	return bytes.HasPrefix(content, []byte(ageHeader)) || bytes.HasPrefix(content, []byte(armor.Header))
+}
+
+// decrypt decrypts age encrypted content with the identities.
+func decrypt(content []byte, identities []age.Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, errNoIdentities
+	}
+	var src io.Reader = bytes.NewReader(content)
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(content)))
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// decryptSecret returns value, decrypted if it is an armored age file.
+func decryptSecret(value string, identities []age.Identity) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), armor.Header) {
+		return value, nil
+	}
+	plain, err := decrypt([]byte(value), identities)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(plain), "\n"), nil
+}
+
+// mapSecrets replaces the target's passwords and header values with the
+// result of f.
+func (t *Target) mapSecrets(f func(string) (string, error)) error {
+	var err error
+	if t.Password, err = f(t.Password); err != nil {
+		return fmt.Errorf("password: %s", err)
+	}
+	for i := range t.FallbackCredentials {
+		if t.FallbackCredentials[i].Password, err = f(t.FallbackCredentials[i].Password); err != nil {
+			return fmt.Errorf("fallback_credentials: %s", err)
+		}
+	}
+	for name, value := range t.Headers {
+		if t.Headers[name], err = f(value); err != nil {
+			return fmt.Errorf("headers: %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// decryptSecrets decrypts the target's secrets that are armored age files.
+func (t *Target) decryptSecrets(identities []age.Identity) error {
+	return t.mapSecrets(func(value string) (string, error) {
+		return decryptSecret(value, identities)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// encrypt returns plain encrypted to the recipient, armored.
+func encrypt(t *testing.T, plain string, recipient age.Recipient) string {
+	t.Helper()
+	var buf bytes.Buffer
+	a := armor.NewWriter(&buf)
+	w, err := age.Encrypt(a, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, plain)
+	w.Close()
+	a.Close()
+	return buf.String()
+}
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	filename := filepath.Join(dir, "sansay.yml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadFileEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := writeConfig(t, dir, encrypt(t, "targets:\n  sbc1:\n    password: secret\n", identity.Recipient()))
+	if _, err := LoadFile(filename); err != errNoIdentities {
+		t.Errorf("Expected an error without identities, received %v", err)
+	}
+	cfg, err := LoadFile(filename, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Target("sbc1").Password; got != "secret" {
+		t.Errorf("Expected the decrypted password, received %q", got)
+	}
+}
+
+func TestLoadFileEncryptedSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indent := func(s string) string {
+		return string(bytes.ReplaceAll([]byte(s), []byte("\n"), []byte("\n      ")))
+	}
+	filename := writeConfig(t, dir, "targets:\n  sbc1:\n    username: user\n    password: |\n      "+indent(encrypt(t, "secret\n", identity.Recipient()))+"\n")
+	cfg, err := LoadFile(filename, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Target("sbc1").Password; got != "secret" {
+		t.Errorf("Expected the decrypted password, received %q", got)
+	}
+	if got := cfg.Target("sbc1").Username; got != "user" {
+		t.Errorf("Expected the plain username, received %q", got)
+	}
+}
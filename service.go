@@ -0,0 +1,84 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// shutdownTimeout is how long scrapes in progress may take to finish when
+// the exporter is stopped.
+const shutdownTimeout = 10 * time.Second
+
+// serve serves the servers until one fails or stop is closed, then shuts
+// them down gracefully.  ready is called once every address is listened on.
+func serve(servers []*http.Server, ready func(), stop <-chan struct{}, logger log.Logger) error {
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, server := range servers {
+		l, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		level.Info(logger).Log("msg", "Listening on address", "address", server.Addr)
+		listeners = append(listeners, l)
+	}
+	errs := make(chan error, len(servers))
+	for i, server := range servers {
+		go func(server *http.Server, l net.Listener) {
+			errs <- server.Serve(l)
+		}(server, listeners[i])
+	}
+	ready()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+	}
+	level.Info(logger).Log("msg", "Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			level.Warn(logger).Log("msg", "Error shutting down HTTP server", "address", server.Addr, "err", err)
+		}
+	}
+	return nil
+}
+
+// sdNotify sends state to the systemd service manager, if the exporter was
+// started by one as a Type=notify service.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
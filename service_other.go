@@ -0,0 +1,46 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// run serves until SIGINT or SIGTERM, telling systemd when the exporter is
+// ready and when it stops.
+func run(servers []*http.Server, logger log.Logger) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		sdNotify("STOPPING=1")
+		close(stop)
+	}()
+	ready := func() {
+		if err := sdNotify("READY=1"); err != nil {
+			level.Warn(logger).Log("msg", "Error notifying systemd", "err", err)
+		}
+	}
+	return serve(servers, ready, stop, logger)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestSDNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET"))
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "READY=1" {
+		t.Errorf("Expected READY=1, received %q", buf[:n])
+	}
+}
+
+func TestServe(t *testing.T) {
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	ready := make(chan struct{})
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- serve([]*http.Server{server}, func() { close(ready) }, stop, log.NewNopLogger())
+	}()
+	<-ready
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, received %v", err)
+	}
+}
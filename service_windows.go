@@ -0,0 +1,92 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the name the exporter is registered with the Windows
+// service manager as.
+const serviceName = "sansay_exporter"
+
+// run serves until interrupted, or until the Windows service manager stops
+// the service when running as one.
+func run(servers []*http.Server, logger log.Logger) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if isService {
+		return svc.Run(serviceName, &service{servers: servers, logger: logger})
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	return serve(servers, func() {}, stop, logger)
+}
+
+// service runs the exporter as a Windows service.
+type service struct {
+	servers []*http.Server
+	logger  log.Logger
+}
+
+// Execute implements svc.Handler.
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	ready := func() {
+		status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	}
+	go func() {
+		done <- serve(s.servers, ready, stop, s.logger)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				level.Error(s.logger).Log("msg", "Error serving HTTP", "err", err)
+				return false, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stop)
+				err := <-done
+				if err != nil {
+					level.Error(s.logger).Log("msg", "Error serving HTTP", "err", err)
+					return false, 1
+				}
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultSIPTLSPort is the port of SIP over TLS addresses given without one.
+const defaultSIPTLSPort = "5061"
+
+// defaultSIPTLSTimeout bounds the TLS handshakes with the SIP-TLS addresses
+// of scrapes without a timeout.
+const defaultSIPTLSTimeout = 5 * time.Second
+
+// sipTLSAddress returns address with the default SIP-TLS port if it has none.
+func sipTLSAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, defaultSIPTLSPort)
+}
+
+// collectSIPTLS completes a TLS handshake with each of the target's SIP-TLS
+// addresses and exports the expiry of the certificate presented, so an
+// expiring signaling certificate alerts ahead of the trunks failing.  The
+// certificate is read whether or not it is trusted.
+func (c collector) collectSIPTLS(ch chan<- prometheus.Metric) {
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = defaultSIPTLSTimeout
+	}
+	dial := c.sipTLSDial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	var wg sync.WaitGroup
+	for _, address := range c.sipTLS {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			address = sipTLSAddress(address)
+			up := 1.0
+			notAfter, err := sipTLSExpiry(dial, address, timeout)
+			if err != nil {
+				level.Info(c.logger).Log("msg", "Error probing SIP-TLS certificate", "address", address, "err", err)
+				up = 0
+			}
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_sip_tls_up", "Whether a TLS handshake with the SIP-TLS address succeeded.", []string{"address"}),
+				prometheus.GaugeValue,
+				up, address)
+			if err == nil {
+				ch <- prometheus.MustNewConstMetric(
+					newDesc("sansay_sip_tls_cert_expiry_timestamp_seconds", "Time the certificate presented on the SIP-TLS address expires.", []string{"address"}),
+					prometheus.GaugeValue,
+					float64(notAfter.Unix()), address)
+			}
+		}(address)
+	}
+	wg.Wait()
+}
+
+// sipTLSExpiry returns when the leaf certificate presented on address, dialed
+// with dial, expires.
+func sipTLSExpiry(dial dialFunc, address string, timeout time.Duration) (time.Time, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	raw, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return time.Time{}, err
+	}
+	conn := tls.Client(raw, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := conn.Handshake(); err != nil {
+		return time.Time{}, err
+	}
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return time.Time{}, errors.New("no certificate presented")
+	}
+	return certificates[0].NotAfter, nil
+}
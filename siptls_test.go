@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestSIPTLSAddress(t *testing.T) {
+	for address, want := range map[string]string{
+		"sbc1.example.com":      "sbc1.example.com:5061",
+		"sbc1.example.com:5063": "sbc1.example.com:5063",
+		"2001:db8::1":           "[2001:db8::1]:5061",
+	} {
+		if got := sipTLSAddress(address); got != want {
+			t.Errorf("Expected %s for %s, received %s", want, address, got)
+		}
+	}
+}
+
+func TestCollectSIPTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "https://")
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedAddress := strings.TrimPrefix(closed.URL, "http://")
+	closed.Close()
+
+	c := collector{logger: log.NewNopLogger(), sipTLS: []string{address}}
+	expected := fmt.Sprintf(`
+# TYPE sansay_sip_tls_cert_expiry_timestamp_seconds gauge
+sansay_sip_tls_cert_expiry_timestamp_seconds{address=%q} %g
+# TYPE sansay_sip_tls_up gauge
+sansay_sip_tls_up{address=%q} 1
+`, address, float64(server.Certificate().NotAfter.Unix()), address)
+	compareMetrics(t, c.collectSIPTLS, expected, "sansay_sip_tls_cert_expiry_timestamp_seconds", "sansay_sip_tls_up")
+
+	_, port, _ := net.SplitHostPort(address)
+	c.sipTLS = []string{"sbc1.invalid:" + port}
+	c.sipTLSDial = targetDialContext(&Target{Resolve: "127.0.0.1"}, &net.Dialer{})
+	expected = fmt.Sprintf(`
+# TYPE sansay_sip_tls_up gauge
+sansay_sip_tls_up{address="sbc1.invalid:%s"} 1
+`, port)
+	compareMetrics(t, c.collectSIPTLS, expected, "sansay_sip_tls_up")
+
+	c.sipTLSDial = nil
+	c.sipTLS = []string{closedAddress}
+	expected = fmt.Sprintf(`
+# TYPE sansay_sip_tls_up gauge
+sansay_sip_tls_up{address=%q} 0
+`, closedAddress)
+	compareMetrics(t, c.collectSIPTLS, expected, "sansay_sip_tls_cert_expiry_timestamp_seconds", "sansay_sip_tls_up")
+}
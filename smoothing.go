@@ -0,0 +1,230 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// smoothingExpiry is how long the smoothed value of a series no longer
+// gathered is kept.
+const smoothingExpiry = time.Hour
+
+// defaultSpikeHold is how long an outlier must persist to be accepted if
+// spike_hold is not set.
+const defaultSpikeHold = time.Minute
+
+// MetricSmoothing serves a noisy gauge smoothed too, as the same series with
+// the _smoothed suffix.
+type MetricSmoothing struct {
+	// Name is the gauge's name.
+	Name string `yaml:"name"`
+	// HalfLife is the time after which a change of the gauge is half
+	// reflected in the exponentially weighted moving average.  The average
+	// is weighted by time rather than by sample, so it doesn't depend on how
+	// often the exporter is scraped.  Without it, only spikes are
+	// suppressed.
+	HalfLife time.Duration `yaml:"half_life,omitempty"`
+	// SpikeFactor suppresses the values more than SpikeFactor times, or less
+	// than 1/SpikeFactor times, the smoothed value, until they persist for
+	// SpikeHold.
+	SpikeFactor float64       `yaml:"spike_factor,omitempty"`
+	SpikeHold   time.Duration `yaml:"spike_hold,omitempty"`
+}
+
+// validate checks the smoothing and fills in the defaults.
+func (s *MetricSmoothing) validate() error {
+	if !model.IsValidMetricName(model.LabelValue(s.Name)) {
+		return fmt.Errorf("name: %q is not a valid metric name", s.Name)
+	}
+	if s.HalfLife < 0 {
+		return fmt.Errorf("half_life: must not be negative")
+	}
+	if s.SpikeFactor != 0 && s.SpikeFactor <= 1 {
+		return fmt.Errorf("spike_factor: %g must be greater than 1", s.SpikeFactor)
+	}
+	if s.HalfLife == 0 && s.SpikeFactor == 0 {
+		return fmt.Errorf("either half_life or spike_factor must be set")
+	}
+	if s.SpikeHold < 0 {
+		return fmt.Errorf("spike_hold: must not be negative")
+	}
+	if s.SpikeFactor != 0 && s.SpikeHold == 0 {
+		s.SpikeHold = defaultSpikeHold
+	}
+	return nil
+}
+
+// outlier reports whether value is a spike away from smoothed.
+func (s *MetricSmoothing) outlier(value, smoothed float64) bool {
+	if s.SpikeFactor == 0 {
+		return false
+	}
+	v, m := math.Abs(value), math.Abs(smoothed)
+	return v > m*s.SpikeFactor || v < m/s.SpikeFactor
+}
+
+// smoothedSeries is the state of a smoothed series.
+type smoothedSeries struct {
+	value    float64
+	observed time.Time
+	// outlierSince is when the current run of outliers started, if in one.
+	outlierSince time.Time
+}
+
+// observe smooths value, gathered at now, into the series.
+func (s *smoothedSeries) observe(value float64, now time.Time, smoothing *MetricSmoothing) {
+	if s.observed.IsZero() {
+		s.value, s.observed = value, now
+		return
+	}
+	elapsed := now.Sub(s.observed)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	s.observed = now
+	if smoothing.outlier(value, s.value) {
+		if s.outlierSince.IsZero() {
+			s.outlierSince = now
+		}
+		if now.Sub(s.outlierSince) < smoothing.SpikeHold {
+			return
+		}
+	}
+	s.outlierSince = time.Time{}
+	if smoothing.HalfLife == 0 {
+		s.value = value
+		return
+	}
+	weight := 1 - math.Exp2(-elapsed.Seconds()/smoothing.HalfLife.Seconds())
+	s.value += weight * (value - s.value)
+}
+
+// smoothingState keeps the smoothed series of each target.
+type smoothingState struct {
+	mu      sync.Mutex
+	targets map[string]map[string]*smoothedSeries
+	// swept is when the series past smoothingExpiry were last deleted.
+	swept time.Time
+}
+
+func newSmoothingState() *smoothingState {
+	return &smoothingState{targets: map[string]map[string]*smoothedSeries{}}
+}
+
+// sweep deletes the series not gathered within smoothingExpiry of now, and
+// the targets left without any, as targets may no longer be scraped.
+// s.mu must be held.
+func (s *smoothingState) sweep(now time.Time) {
+	for target, series := range s.targets {
+		for key, state := range series {
+			if now.Sub(state.observed) > smoothingExpiry {
+				delete(series, key)
+			}
+		}
+		if len(series) == 0 {
+			delete(s.targets, target)
+		}
+	}
+	s.swept = now
+}
+
+// smoothingGatherer adds the smoothed series of the gauges configured to be
+// smoothed.
+type smoothingGatherer struct {
+	prometheus.Gatherer
+	smoothing []*MetricSmoothing
+	state     *smoothingState
+	target    string
+}
+
+// Gather implements prometheus.Gatherer.
+func (g smoothingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	now := time.Now()
+	byName := map[string]*MetricSmoothing{}
+	for _, s := range g.smoothing {
+		byName[s.Name] = s
+	}
+	g.state.mu.Lock()
+	defer g.state.mu.Unlock()
+	series, ok := g.state.targets[g.target]
+	if !ok {
+		series = map[string]*smoothedSeries{}
+		g.state.targets[g.target] = series
+	}
+	result := families
+	for _, family := range families {
+		s, ok := byName[family.GetName()]
+		if !ok {
+			continue
+		}
+		if family.GetType() != dto.MetricType_GAUGE && family.GetType() != dto.MetricType_UNTYPED {
+			continue
+		}
+		result = append(result, smoothFamily(family, s, series, now))
+	}
+	if now.Sub(g.state.swept) >= smoothingExpiry {
+		g.state.sweep(now)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, err
+}
+
+// smoothFamily returns the smoothed copy of family, smoothing its values into
+// series.
+func smoothFamily(family *dto.MetricFamily, s *MetricSmoothing, series map[string]*smoothedSeries, now time.Time) *dto.MetricFamily {
+	name := family.GetName() + "_smoothed"
+	help := fmt.Sprintf("Smoothed %s.", family.GetName())
+	smoothed := &dto.MetricFamily{Name: &name, Help: &help, Type: dto.MetricType_GAUGE.Enum()}
+	for _, m := range family.Metric {
+		var value float64
+		switch {
+		case m.Gauge != nil:
+			value = m.Gauge.GetValue()
+		case m.Untyped != nil:
+			value = m.Untyped.GetValue()
+		default:
+			continue
+		}
+		key := seriesKey(family.GetName(), m.Label)
+		state, ok := series[key]
+		if !ok {
+			state = &smoothedSeries{}
+			series[key] = state
+		}
+		state.observe(value, now, s)
+		v := state.value
+		smoothed.Metric = append(smoothed.Metric, &dto.Metric{Label: m.Label, Gauge: &dto.Gauge{Value: &v}})
+	}
+	return smoothed
+}
+
+// seriesKey identifies the series of the metric with the labels.
+func seriesKey(name string, labels []*dto.LabelPair) string {
+	parts := []string{name}
+	for _, l := range labels {
+		parts = append(parts, l.GetName()+"="+l.GetValue())
+	}
+	return strings.Join(parts, "\xff")
+}
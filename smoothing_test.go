@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestSmoothedSeries(t *testing.T) {
+	start := time.Unix(1000, 0)
+	ewma := &MetricSmoothing{Name: "sansay_cps", HalfLife: time.Minute}
+	s := &smoothedSeries{}
+	for i, tt := range []struct {
+		at    time.Duration
+		value float64
+		want  float64
+	}{
+		{0, 10, 10},
+		// A change is half reflected after the half-life.
+		{time.Minute, 30, 20},
+		// However often it is observed.
+		{90 * time.Second, 30, 20 + 10*(1-math.Exp2(-0.5))},
+		{2 * time.Minute, 30, 25},
+	} {
+		s.observe(tt.value, start.Add(tt.at), ewma)
+		if math.Abs(s.value-tt.want) > 1e-9 {
+			t.Errorf("%d: Expected %g, received %g", i, tt.want, s.value)
+		}
+	}
+
+	spikes := &MetricSmoothing{Name: "sansay_cps", SpikeFactor: 3}
+	if err := spikes.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s = &smoothedSeries{}
+	for i, tt := range []struct {
+		at    time.Duration
+		value float64
+		want  float64
+	}{
+		{0, 10, 10},
+		{15 * time.Second, 12, 12},
+		// A spike is suppressed.
+		{30 * time.Second, 500, 12},
+		{45 * time.Second, 11, 11},
+		// A level shift is accepted once it persists for the hold.
+		{60 * time.Second, 100, 11},
+		{90 * time.Second, 100, 11},
+		{120 * time.Second, 100, 100},
+	} {
+		s.observe(tt.value, start.Add(tt.at), spikes)
+		if s.value != tt.want {
+			t.Errorf("%d: Expected %g, received %g", i, tt.want, s.value)
+		}
+	}
+}
+
+func TestSmoothingGatherer(t *testing.T) {
+	smoothing := []*MetricSmoothing{{Name: "sansay_cps", HalfLife: time.Minute}, {Name: "sansay_calls_total", HalfLife: time.Minute}}
+	cps := 5.0
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_cps", "Calls per second", []string{"node"}), prometheus.GaugeValue, cps, "1")
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_calls_total", "Calls", nil), prometheus.CounterValue, 100)
+	}))
+	state := newSmoothingState()
+	g := smoothingGatherer{Gatherer: registry, smoothing: smoothing, state: state, target: "sbc1"}
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	for _, family := range families {
+		expfmt.MetricFamilyToText(&got, family)
+	}
+	// Counters are not smoothed.
+	expected := `
+# TYPE sansay_calls_total counter
+sansay_calls_total 100
+# TYPE sansay_cps gauge
+sansay_cps{node="1"} 5
+# TYPE sansay_cps_smoothed gauge
+sansay_cps_smoothed{node="1"} 5
+`
+	if stripHelp(got.String()) != stripHelp(expected) {
+		t.Errorf("Unexpected metrics, want:\n%s\ngot:\n%s", expected, got.String())
+	}
+
+	// Series are smoothed per target.
+	cps = 50
+	g.target = "sbc2"
+	families, err = g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "sansay_cps_smoothed" && family.Metric[0].GetGauge().GetValue() != 50 {
+			t.Errorf("Expected the first value of another target, received %s", family)
+		}
+	}
+	if len(state.targets) != 2 {
+		t.Errorf("Expected the state of 2 targets, received %d", len(state.targets))
+	}
+}
+
+func TestSmoothingStateSweep(t *testing.T) {
+	now := time.Unix(10000, 0)
+	state := newSmoothingState()
+	state.targets["sbc1"] = map[string]*smoothedSeries{
+		"current": {value: 1, observed: now},
+		"expired": {value: 1, observed: now.Add(-2 * smoothingExpiry)},
+	}
+	state.targets["sbc2"] = map[string]*smoothedSeries{
+		"expired": {value: 1, observed: now.Add(-2 * smoothingExpiry)},
+	}
+	state.sweep(now)
+	if _, ok := state.targets["sbc1"]["expired"]; ok {
+		t.Error("Expected the expired series to be deleted")
+	}
+	if _, ok := state.targets["sbc1"]["current"]; !ok {
+		t.Error("Expected the current series to be kept")
+	}
+	if _, ok := state.targets["sbc2"]; ok {
+		t.Error("Expected the target without current series to be deleted")
+	}
+}
+
+func TestMetricSmoothingValidate(t *testing.T) {
+	for _, tt := range []struct {
+		smoothing MetricSmoothing
+		wantErr   bool
+	}{
+		{MetricSmoothing{Name: "sansay_cps", HalfLife: time.Minute}, false},
+		{MetricSmoothing{Name: "sansay_cps", SpikeFactor: 2, SpikeHold: time.Minute}, false},
+		{MetricSmoothing{Name: "sansay_cps"}, true},
+		{MetricSmoothing{Name: "sansay-cps", HalfLife: time.Minute}, true},
+		{MetricSmoothing{Name: "sansay_cps", HalfLife: -time.Minute}, true},
+		{MetricSmoothing{Name: "sansay_cps", SpikeFactor: 0.5}, true},
+	} {
+		if err := tt.smoothing.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Expected error %v for %+v, received %v", tt.wantErr, tt.smoothing, err)
+		}
+	}
+	s := MetricSmoothing{Name: "sansay_cps", SpikeFactor: 2}
+	s.validate()
+	if s.SpikeHold != defaultSpikeHold {
+		t.Errorf("Expected the default spike hold, received %s", s.SpikeHold)
+	}
+}
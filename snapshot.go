@@ -0,0 +1,180 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// snapshot is the state of targets scraped at once, for offline analysis or
+// attaching to a vendor support ticket.
+type snapshot struct {
+	Time    time.Time        `json:"time"`
+	Targets []snapshotTarget `json:"targets"`
+}
+
+// snapshotTarget is the state of a target, its series labelled with the
+// target.
+type snapshotTarget struct {
+	Target   string           `json:"target"`
+	Errors   []string         `json:"errors,omitempty"`
+	Series   []snapshotSeries `json:"series"`
+	families []*dto.MetricFamily
+}
+
+// snapshotSeries is a series of a snapshot.  Summaries and histograms are
+// only in the OpenMetrics format.
+type snapshotSeries struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// takeSnapshot scrapes the named targets, at most workers at once, with the
+// collectors newCollector returns.
+func takeSnapshot(names []string, workers int, newCollector func(name string) (prometheus.Collector, error)) snapshot {
+	if workers < 1 {
+		workers = 1
+	}
+	s := snapshot{Time: time.Now(), Targets: make([]snapshotTarget, len(names))}
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			s.Targets[i] = snapshotOf(name, newCollector)
+		}(i, name)
+	}
+	wg.Wait()
+	return s
+}
+
+// snapshotOf scrapes the named target.
+func snapshotOf(name string, newCollector func(name string) (prometheus.Collector, error)) snapshotTarget {
+	t := snapshotTarget{Target: name, Series: []snapshotSeries{}}
+	c, err := newCollector(name)
+	if err != nil {
+		t.Errors = append(t.Errors, err.Error())
+		return t
+	}
+	registry := prometheus.NewRegistry()
+	prometheus.WrapRegistererWith(prometheus.Labels{"target": name}, registry).MustRegister(c)
+	families, err := registry.Gather()
+	if multi, ok := err.(prometheus.MultiError); ok {
+		for _, err := range multi {
+			t.Errors = append(t.Errors, err.Error())
+		}
+	} else if err != nil {
+		t.Errors = append(t.Errors, err.Error())
+	}
+	t.families = families
+	for _, family := range families {
+		for _, m := range family.Metric {
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			default:
+				continue
+			}
+			series := snapshotSeries{Name: family.GetName(), Type: strings.ToLower(family.GetType().String())}
+			for _, l := range m.Label {
+				if series.Labels == nil {
+					series.Labels = map[string]string{}
+				}
+				series.Labels[l.GetName()] = l.GetValue()
+			}
+			series.Value = value
+			t.Series = append(t.Series, series)
+		}
+	}
+	return t
+}
+
+// write writes the snapshot in format, json or openmetrics.  The errors
+// scraping the targets are only in the JSON format.
+func (s snapshot) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "openmetrics":
+		return s.writeOpenMetrics(w)
+	}
+	return fmt.Errorf("unknown snapshot format %q", format)
+}
+
+func (s snapshot) writeOpenMetrics(w io.Writer) error {
+	families := map[string]*dto.MetricFamily{}
+	for _, t := range s.Targets {
+		for _, family := range t.families {
+			merged, ok := families[family.GetName()]
+			if !ok {
+				merged = &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type}
+				families[family.GetName()] = merged
+			}
+			merged.Metric = append(merged.Metric, family.Metric...)
+		}
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToOpenMetrics(&buf, families[name]); err != nil {
+			return err
+		}
+	}
+	if _, err := expfmt.FinalizeOpenMetrics(&buf); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// saveSnapshot writes the snapshot in format to filename, or to w if
+// filename is "-".  The file is readable by the exporter's user only, as
+// the SBCs' state may be sensitive.
+func saveSnapshot(w io.Writer, filename, format string, s snapshot) error {
+	if filename == "-" {
+		return s.write(w, format)
+	}
+	var buf bytes.Buffer
+	if err := s.write(&buf, format); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, buf.Bytes(), 0600)
+}
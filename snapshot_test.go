@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func testSnapshot() snapshot {
+	return takeSnapshot([]string{"sbc1", "sbc2", "sbc3"}, 2, func(name string) (prometheus.Collector, error) {
+		if name == "sbc3" {
+			return nil, errors.New("unknown target")
+		}
+		return metricsFunc(func(ch chan<- prometheus.Metric) {
+			ch <- prometheus.MustNewConstMetric(newDesc("sansay_cpu_idle", "", nil), prometheus.GaugeValue, 90)
+			if name == "sbc2" {
+				ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), errors.New("timeout"))
+			}
+		}), nil
+	})
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := testSnapshot().write(&out, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var s snapshot
+	if err := json.Unmarshal(out.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Targets) != 3 {
+		t.Fatalf("Expected 3 targets, received %s", out.String())
+	}
+	want := snapshotSeries{Name: "sansay_cpu_idle", Type: "gauge", Labels: map[string]string{"target": "sbc1"}, Value: 90}
+	if got := s.Targets[0].Series; len(got) != 1 || got[0].Name != want.Name || got[0].Labels["target"] != "sbc1" || got[0].Value != want.Value || got[0].Type != want.Type {
+		t.Errorf("Expected %+v, received %+v", want, got)
+	}
+	if errs := s.Targets[1].Errors; len(errs) != 1 || !strings.Contains(errs[0], "timeout") {
+		t.Errorf("Expected the error scraping sbc2, received %v", errs)
+	}
+	if errs := s.Targets[2].Errors; len(errs) != 1 || errs[0] != "unknown target" {
+		t.Errorf("Expected the error creating the collector of sbc3, received %v", errs)
+	}
+}
+
+func TestSnapshotOpenMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "snapshot.txt")
+	if err := saveSnapshot(nil, filename, "openmetrics", testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP sansay_cpu_idle 
+# TYPE sansay_cpu_idle gauge
+sansay_cpu_idle{target="sbc1"} 90.0
+sansay_cpu_idle{target="sbc2"} 90.0
+# EOF
+`
+	if string(content) != want {
+		t.Errorf("Expected:\n%s\nreceived:\n%s", want, content)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxSyslogMessage is the largest syslog datagram read, longer ones are
+// truncated.
+const maxSyslogMessage = 8192
+
+// syslogEvent classifies the event log messages matching pattern, whose
+// first group is the reason the event is counted under.  Reasons known
+// doesn't accept are counted as "other", known is nil where the pattern
+// only matches a fixed set of reasons.
+type syslogEvent struct {
+	category string
+	pattern  *regexp.Regexp
+	known    func(reason string) bool
+}
+
+// syslogEvents are the Sansay event log messages counted, the first match
+// wins.
+var syslogEvents = []syslogEvent{
+	{"registration_failure", regexp.MustCompile(`(?i)\bregist\w*\b.*?\b(fail|reject|denied|timeout|unauthori[sz]ed)`), nil},
+	{"call_reject", regexp.MustCompile(`(?i)\breject\w*\b.*?\b(?:cause|reason|code)\s*[=:]\s*"?([a-z0-9_.-]+)`), knownRejectReason},
+	{"security", regexp.MustCompile(`(?i)\b(blacklist|flood|attack|scan|intrusion|brute.?force|authentication fail|invalid password)`), nil},
+}
+
+// sipStatusCode matches the SIP final response codes a call may be rejected
+// with.
+var sipStatusCode = regexp.MustCompile(`^[3-6]\d\d$`)
+
+// callRejectReasons are the causes besides SIP status codes that calls
+// rejected for are counted under.
+var callRejectReasons = map[string]bool{
+	"blacklist":     true,
+	"busy":          true,
+	"capacity":      true,
+	"codec":         true,
+	"congestion":    true,
+	"cps_limit":     true,
+	"forbidden":     true,
+	"no_answer":     true,
+	"no_route":      true,
+	"not_found":     true,
+	"session_limit": true,
+	"timeout":       true,
+	"unauthorized":  true,
+	"unavailable":   true,
+}
+
+// knownRejectReason reports whether calls rejected for reason are counted
+// under it, rather than as "other".
+func knownRejectReason(reason string) bool {
+	return sipStatusCode.MatchString(reason) || callRejectReasons[reason]
+}
+
+// syslogBacklog matches the event log messages reporting the number of
+// accounting records the SBC has queued.
+var syslogBacklog = regexp.MustCompile(`(?i)\b(?:accounting|acct|radius|cdr)\b.*?\b(?:queue|backlog|pending)\w*\b\D*?(\d+)`)
+
+// syslogPriority matches the priority that starts a syslog message.
+var syslogPriority = regexp.MustCompile(`^<\d{1,3}>`)
+
+// syslogReceiver counts the events of the event logs SBCs send it by syslog
+// over UDP, giving metrics of call rejections, registration failures and
+// security events without access to CDRs.  Only the messages from the
+// sources allowed are counted by source, so anyone able to reach the port
+// can't create series at will.
+type syslogReceiver struct {
+	logger   log.Logger
+	allowed  func(source string) bool
+	rejected prometheus.Counter
+	messages *prometheus.CounterVec
+	events   *prometheus.CounterVec
+	backlog  *prometheus.GaugeVec
+}
+
+func newSyslogReceiver(logger log.Logger, allowed func(source string) bool) *syslogReceiver {
+	return &syslogReceiver{
+		logger:  logger,
+		allowed: allowed,
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sansay_syslog_rejected_messages_total",
+			Help: "Syslog messages received from addresses not allowed to send them.",
+		}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sansay_syslog_messages_total",
+			Help: "Syslog messages received, by the address they were sent from.",
+		}, []string{"source"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sansay_syslog_events_total",
+			Help: "Events in the syslog messages received, by the address they were sent from, category and reason.",
+		}, []string{"source", "category", "reason"}),
+		backlog: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sansay_syslog_accounting_backlog_records",
+			Help: "Accounting records queued on the SBC as last reported in its event log, by the address it was sent from.",
+		}, []string{"source"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *syslogReceiver) Describe(ch chan<- *prometheus.Desc) {
+	r.rejected.Describe(ch)
+	r.messages.Describe(ch)
+	r.events.Describe(ch)
+	r.backlog.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *syslogReceiver) Collect(ch chan<- prometheus.Metric) {
+	r.rejected.Collect(ch)
+	r.messages.Collect(ch)
+	r.events.Collect(ch)
+	r.backlog.Collect(ch)
+}
+
+// listen receives syslog messages on the UDP address in the background, and
+// returns the address listened on.
+func (r *syslogReceiver) listen(address string) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	go r.serve(conn)
+	return conn.LocalAddr(), nil
+}
+
+// serve handles the messages received on conn until it is closed.
+func (r *syslogReceiver) serve(conn net.PacketConn) {
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			level.Error(r.logger).Log("msg", "Error receiving syslog message, stopping the syslog receiver", "err", err)
+			return
+		}
+		source := addr.String()
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
+		}
+		r.handle(source, string(buf[:n]))
+	}
+}
+
+// handle counts the message sent from source, and its event if it is one,
+// and records the accounting backlog it reports.
+func (r *syslogReceiver) handle(source, message string) {
+	if !r.allowed(source) {
+		level.Debug(r.logger).Log("msg", "Rejected syslog message from a source not allowed", "source", source)
+		r.rejected.Inc()
+		return
+	}
+	r.messages.WithLabelValues(source).Inc()
+	message = syslogPriority.ReplaceAllString(message, "")
+	if match := syslogBacklog.FindStringSubmatch(message); match != nil {
+		if backlog, err := strconv.ParseFloat(match[1], 64); err == nil {
+			r.backlog.WithLabelValues(source).Set(backlog)
+		}
+	}
+	category, reason, ok := classifySyslog(message)
+	if !ok {
+		return
+	}
+	level.Debug(r.logger).Log("msg", "Received syslog event", "source", source, "category", category, "reason", reason)
+	r.events.WithLabelValues(source, category, reason).Inc()
+}
+
+// classifySyslog returns the category and reason of the event in message, if
+// it is one of syslogEvents.
+func classifySyslog(message string) (string, string, bool) {
+	for _, event := range syslogEvents {
+		match := event.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		reason := strings.ToLower(match[1])
+		reason = invalidNameChars.ReplaceAllString(reason, "_")
+		if event.known != nil && !event.known(reason) {
+			reason = "other"
+		}
+		return event.category, reason, true
+	}
+	return "", "", false
+}
+
+// syslogSources returns whether a source may send syslog messages: one of
+// addresses, or if none are given the host of one of the targets in conf.
+func syslogSources(addresses []string, conf *Config) func(source string) bool {
+	if len(addresses) > 0 {
+		allowed := make(map[string]bool, len(addresses))
+		for _, address := range addresses {
+			allowed[address] = true
+		}
+		return func(source string) bool {
+			return allowed[source]
+		}
+	}
+	return func(source string) bool {
+		for _, name := range conf.TargetNames() {
+			if targetHost(name) == source {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// targetHost returns the host of the named target, which may be a URL or a
+// host with an optional port.
+func targetHost(name string) string {
+	if !strings.Contains(name, "://") {
+		name = "http://" + name
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
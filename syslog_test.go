@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestClassifySyslog(t *testing.T) {
+	tests := []struct {
+		message  string
+		category string
+		reason   string
+	}{
+		{`Jun  1 08:00:00 sbc1 sansay: INVITE from 10.0.0.1 rejected, cause=486`, "call_reject", "486"},
+		{`Jun  1 08:00:00 sbc1 sansay: Call rejected reason: "No-Route"`, "call_reject", "no_route"},
+		{`Jun  1 08:00:00 sbc1 sansay: Call rejected reason: "x7f3a9c"`, "call_reject", "other"},
+		{`Jun  1 08:00:00 sbc1 sansay: REGISTER from 10.0.0.2 rejected, cause=403`, "registration_failure", "reject"},
+		{`Jun  1 08:00:00 sbc1 sansay: Registration timeout for 1001@10.0.0.2`, "registration_failure", "timeout"},
+		{`Jun  1 08:00:00 sbc1 sansay: 10.0.0.3 added to dynamic blacklist`, "security", "blacklist"},
+		{`Jun  1 08:00:00 sbc1 sansay: SIP flood detected from 10.0.0.4`, "security", "flood"},
+	}
+	for _, tt := range tests {
+		category, reason, ok := classifySyslog(tt.message)
+		if !ok || category != tt.category || reason != tt.reason {
+			t.Errorf("Expected %q to be %s/%s, received %s/%s (%t)", tt.message, tt.category, tt.reason, category, reason, ok)
+		}
+	}
+	if _, _, ok := classifySyslog("Jun  1 08:00:00 sbc1 sansay: Database sync completed"); ok {
+		t.Error("Expected an ordinary message not to be an event")
+	}
+}
+
+func TestSyslogReceiver(t *testing.T) {
+	r := newSyslogReceiver(log.NewNopLogger(), syslogSources([]string{"127.0.0.1"}, &Config{}))
+	addr, err := r.listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, message := range []string{
+		"<134>Jun  1 08:00:00 sbc1 sansay: INVITE rejected, cause=503",
+		"<134>Jun  1 08:00:00 sbc1 sansay: INVITE rejected, cause=503",
+		"<134>Jun  1 08:00:00 sbc1 sansay: Database sync completed",
+	} {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := `
+# TYPE sansay_syslog_events_total counter
+sansay_syslog_events_total{category="call_reject",reason="503",source="127.0.0.1"} 2
+# TYPE sansay_syslog_messages_total counter
+sansay_syslog_messages_total{source="127.0.0.1"} 3
+`
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m := &dto.Metric{}
+		if r.messages.WithLabelValues("127.0.0.1").Write(m); m.GetCounter().GetValue() == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	compareMetrics(t, r.Collect, expected, "sansay_syslog_events_total", "sansay_syslog_messages_total")
+}
+
+func TestSyslogAccountingBacklog(t *testing.T) {
+	r := newSyslogReceiver(log.NewNopLogger(), syslogSources([]string{"10.0.0.1", "10.0.0.2"}, &Config{}))
+	r.handle("10.0.0.1", "<134>Jun  1 08:00:00 sbc1 sansay: RADIUS accounting queue depth 1200 records")
+	r.handle("10.0.0.1", "<134>Jun  1 08:01:00 sbc1 sansay: RADIUS accounting queue depth 1500 records")
+	r.handle("10.0.0.2", "<134>Jun  1 08:01:00 sbc2 sansay: CDR backlog: 0")
+	expected := `
+# TYPE sansay_syslog_accounting_backlog_records gauge
+sansay_syslog_accounting_backlog_records{source="10.0.0.1"} 1500
+sansay_syslog_accounting_backlog_records{source="10.0.0.2"} 0
+`
+	compareMetrics(t, r.Collect, expected, "sansay_syslog_accounting_backlog_records")
+}
+
+func TestSyslogSources(t *testing.T) {
+	conf := &Config{Targets: map[string]*Target{
+		"10.0.0.1":               {},
+		"https://10.0.0.2:8443/": {},
+		"sbc3.example.com:8080":  {},
+	}}
+	r := newSyslogReceiver(log.NewNopLogger(), syslogSources(nil, conf))
+	for _, source := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		r.handle(source, "<134>Jun  1 08:00:00 sbc1 sansay: INVITE rejected, cause=503")
+	}
+	expected := `
+# TYPE sansay_syslog_messages_total counter
+sansay_syslog_messages_total{source="10.0.0.1"} 1
+sansay_syslog_messages_total{source="10.0.0.2"} 1
+# TYPE sansay_syslog_rejected_messages_total counter
+sansay_syslog_rejected_messages_total 2
+`
+	compareMetrics(t, r.Collect, expected, "sansay_syslog_messages_total", "sansay_syslog_rejected_messages_total")
+
+	allowed := syslogSources([]string{"10.0.0.3"}, conf)
+	if allowed("10.0.0.1") || !allowed("10.0.0.3") {
+		t.Error("Expected only the sources given to be allowed over the configured targets")
+	}
+}
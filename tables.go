@@ -0,0 +1,724 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timestampLayouts are the date formats the SBC uses in its stats tables.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006/01/02 15:04:05",
+	"Mon Jan _2 15:04:05 2006",
+	"Mon Jan _2 15:04:05 MST 2006",
+}
+
+// parseTimestamp parses a timestamp field, which is either seconds since the
+// epoch or one of timestampLayouts in the SBC's local (here assumed UTC) time.
+func parseTimestamp(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if secs <= 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0), true
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// firstField returns the first non-empty value of the named fields.
+func firstField(fields map[string]string, names ...string) string {
+	for _, name := range names {
+		if value := fields[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// nodeFields identify the cluster member a row belongs to on multi-node
+// deployments, in order of preference.
+var nodeFields = []string{"node_id", "nodeId", "node", "slot", "slot_id"}
+
+// nodeLabel returns the cluster member a row belongs to, or "" for rows of a
+// single-node SBC.
+func nodeLabel(fields map[string]string) string {
+	return firstField(fields, nodeFields...)
+}
+
+// isNodeField reports whether the named field identifies a cluster member.
+func isNodeField(name string) bool {
+	for _, f := range nodeFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// trunkTypeFields hold a realtime trunk group row's direction on firmware
+// that exposes it, in order of preference.
+var trunkTypeFields = []string{"direction", "trunkType", "trunk_type"}
+
+// trunkType normalizes a trunk group's direction to "origination",
+// "termination" or "bidirectional".  Unrecognized directions are returned
+// lowercased.
+func trunkType(direction string) string {
+	value := strings.ToLower(strings.TrimSpace(direction))
+	switch {
+	case value == "":
+		return ""
+	case strings.Contains(value, "bi") || strings.Contains(value, "both"):
+		return "bidirectional"
+	case strings.Contains(value, "term") || strings.Contains(value, "egress") || strings.Contains(value, "out"):
+		return "termination"
+	case strings.Contains(value, "orig") || strings.Contains(value, "ingress") || strings.HasPrefix(value, "in"):
+		return "origination"
+	}
+	return value
+}
+
+// trunkAdminState normalizes the service state of a provisioned trunk group to
+// "enabled" or "disabled", or "unknown" if it isn't given.
+func trunkAdminState(state string) string {
+	value := strings.ToLower(strings.TrimSpace(state))
+	switch {
+	case value == "":
+		return "unknown"
+	case strings.Contains(value, "out") || strings.Contains(value, "inactive") || strings.Contains(value, "disable") || value == "oos" || value == "down":
+		return "disabled"
+	case strings.Contains(value, "service") || strings.Contains(value, "active") || strings.Contains(value, "enable") || value == "up":
+		return "enabled"
+	}
+	return strings.Join(strings.Fields(value), "_")
+}
+
+// systemFieldHandlers export the system_stat fields that are not plain
+// numbers.  All other numeric system_stat fields are exported as-is.
+var systemFieldHandlers = map[string]func(ch chan<- prometheus.Metric, value string, labels, labelValues []string){
+	"db_sync_status":     exportDBSynced,
+	"db_sync_state":      exportDBSynced,
+	"db_last_sync_time":  exportDBLastSync,
+	"last_db_sync_time":  exportDBLastSync,
+	"config_version":     exportConfigVersion,
+	"cfg_version":        exportConfigVersion,
+	"config_last_change": exportConfigLastChange,
+	"last_config_change": exportConfigLastChange,
+	"config_change_time": exportConfigLastChange,
+	"cfg_last_update":    exportConfigLastChange,
+	"ntp_status":         exportNTPSynced,
+	"ntp_sync":           exportNTPSynced,
+	"ntp_state":          exportNTPSynced,
+	"ntp_offset":         exportNTPOffset,
+	"ntp_offset_ms":      exportNTPOffset,
+	"clock_offset":       exportNTPOffset,
+	"ha_current_state":   exportHAState,
+	"overload_state":     exportOverloadActive,
+	"overload_status":    exportOverloadActive,
+	"call_gap_state":     exportOverloadActive,
+	"call_gap_active":    exportOverloadActive,
+	"callgap_status":     exportOverloadActive,
+}
+
+// emergencyFields are the emergency (E911) call routing counters, reported
+// either in system_stat or in a dedicated emergency stats table.
+var emergencyFields = []statField{
+	{"sansay_emergency_calls_total", "Emergency calls routed by the SBC.", prometheus.CounterValue, 1, []string{"emergency_calls", "num_emergency_calls", "total_emergency_calls", "e911_calls"}},
+	{"sansay_emergency_calls_failed_total", "Emergency calls that failed.", prometheus.CounterValue, 1, []string{"failed_emergency_calls", "emergency_calls_failed", "e911_failed"}},
+	{"sansay_emergency_calls_active", "Emergency calls in progress.", prometheus.GaugeValue, 1, []string{"active_emergency_calls", "num_emergency_active", "emergency_active", "e911_active"}},
+}
+
+// dnsFields are the SBC's DNS resolver statistics, reported either in
+// system_stat or in a dedicated DNS stats table.
+var dnsFields = []statField{
+	{"sansay_dns_queries_total", "DNS queries made by the SBC.", prometheus.CounterValue, 1, []string{"dns_queries", "dns_query_count", "num_dns_query"}},
+	{"sansay_dns_failures_total", "DNS queries that failed or timed out.", prometheus.CounterValue, 1, []string{"dns_failures", "dns_failed", "dns_timeouts", "num_dns_fail"}},
+	{"sansay_dns_cache_hits_total", "DNS lookups answered from the SBC's cache.", prometheus.CounterValue, 1, []string{"dns_cache_hits", "dns_cache_hit"}},
+	{"sansay_dns_cache_entries", "Entries in the SBC's DNS cache.", prometheus.GaugeValue, 1, []string{"dns_cache_entries", "dns_cache_size"}},
+	{"sansay_dns_response_time_seconds", "Average DNS response time, reported in milliseconds.", prometheus.GaugeValue, 0.001, []string{"dns_avg_response_ms", "dns_response_ms", "dns_latency_ms"}},
+}
+
+// accountingBacklogFields are the SBC-wide count of accounting records
+// waiting to be sent, reported in system_stat.  A growing backlog means the
+// accounting servers aren't taking records, which costs billing once the SBC
+// starts dropping them.
+var accountingBacklogFields = []statField{
+	{"sansay_accounting_backlog_records", "Accounting records queued on the SBC and not yet sent to any server.", prometheus.GaugeValue, 1, []string{"acct_backlog", "acct_queue_depth", "pending_acct_records", "radius_queue_depth", "cdr_backlog"}},
+}
+
+// overloadFields are the SBC's overload control figures reported in
+// system_stat: how deep it is in overload and the share of new calls it gaps.
+var overloadFields = []statField{
+	{"sansay_overload_level", "Overload control level of the SBC, 0 when not in overload.", prometheus.GaugeValue, 1, []string{"overload_level", "ovl_level", "congestion_level"}},
+	{"sansay_overload_gapped_ratio", "Share of new calls rejected by call gapping, reported in percent.", prometheus.GaugeValue, 0.01, []string{"call_gap_percent", "callgap_percent", "gap_percentage", "overload_gap_percent"}},
+	{"sansay_overload_gapped_calls_total", "Calls rejected by call gapping during overload.", prometheus.CounterValue, 1, []string{"call_gap_rejects", "calls_gapped", "num_call_gapped", "overload_rejects"}},
+}
+
+func init() {
+	for _, defs := range [][]statField{emergencyFields, dnsFields, accountingBacklogFields, overloadFields} {
+		for _, def := range defs {
+			for _, name := range def.fields {
+				systemFieldHandlers[name] = statFieldHandler(def)
+			}
+		}
+	}
+}
+
+// statFieldHandler returns a system_stat field handler exporting def.
+func statFieldHandler(def statField) func(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	return func(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc(def.metric, def.help, labels),
+			def.valueType,
+			v*def.scale, labelValues...)
+	}
+}
+
+// processStatTable exports the given fields of a dedicated stats table whose
+// rows are either the whole SBC or one per cluster node.
+func (c collector) processStatTable(ch chan<- prometheus.Metric, table Table, defs []statField) {
+	for _, row := range table.Row {
+		fields := row.Fields()
+		var labels, labelValues []string
+		if node := nodeLabel(fields); node != "" {
+			labels, labelValues = []string{"node"}, []string{node}
+		}
+		addStatFields(ch, fields, defs, labels, labelValues)
+	}
+}
+
+// syncedValue converts a textual sync state to 1 (in sync) or 0.
+func syncedValue(value string) float64 {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "ok", "yes", "true", "up", "sync", "synced", "synchronized", "synchronised", "in sync", "in-sync", "insync":
+		return 1
+	}
+	return 0
+}
+
+// overloadValue converts a textual overload control state to 1 (call
+// gapping active) or 0, and reports whether the state was recognized.
+func overloadValue(value string) (float64, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "on", "yes", "true", "active", "enabled", "overload", "overloaded", "gapping":
+		return 1, true
+	case "0", "off", "no", "false", "inactive", "disabled", "normal", "none", "clear", "cleared":
+		return 0, true
+	}
+	return 0, false
+}
+
+// exportOverloadActive exports whether the SBC's overload control is gapping
+// calls, so traffic drops during overload events are explained.
+func exportOverloadActive(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	active, ok := overloadValue(value)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_overload_active", "Whether the SBC's overload control is gapping new calls.", labels),
+		prometheus.GaugeValue,
+		active, labelValues...)
+}
+
+// exportDBSynced exports whether the HA peer's database is in sync.
+func exportDBSynced(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	synced := syncedValue(value)
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_db_synced", "Whether the master/slave database replication is in sync.", labels),
+		prometheus.GaugeValue,
+		synced, labelValues...)
+}
+
+// exportDBLastSync exports the time of the last database synchronisation.
+func exportDBLastSync(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	t, ok := parseTimestamp(value)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_db_last_sync_timestamp_seconds", "Time of the last master/slave database sync.", labels),
+		prometheus.GaugeValue,
+		float64(t.Unix()), labelValues...)
+}
+
+// exportNTPSynced exports whether the SBC's clock is synchronised by NTP.
+func exportNTPSynced(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_ntp_synced", "Whether the SBC's clock is synchronised with NTP.", labels),
+		prometheus.GaugeValue,
+		syncedValue(value), labelValues...)
+}
+
+// exportNTPOffset exports the NTP clock offset, which the SBC reports in
+// milliseconds like ntpq does.
+func exportNTPOffset(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	offset, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_ntp_offset_seconds", "Offset of the SBC's clock from its NTP peer.", labels),
+		prometheus.GaugeValue,
+		offset/1000, labelValues...)
+}
+
+// exportConfigVersion exports the running configuration version as a label,
+// so HA pairs with diverging versions can be detected.
+func exportConfigVersion(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_config_info", "Configuration version running on the SBC.", append([]string{"version"}, labels...)),
+		prometheus.GaugeValue,
+		1, append([]string{value}, labelValues...)...)
+}
+
+// exportConfigLastChange exports the time the running configuration was last
+// changed, so call quality regressions can be correlated with config pushes.
+func exportConfigLastChange(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	t, ok := parseTimestamp(value)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_config_last_change_timestamp_seconds", "Time the configuration running on the SBC was last changed.", labels),
+		prometheus.GaugeValue,
+		float64(t.Unix()), labelValues...)
+}
+
+// exportHAState exports the SBC's high availability state, such as active or
+// standby, as an info metric.
+func exportHAState(ch chan<- prometheus.Metric, value string, labels, labelValues []string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_ha_state_info", "High availability state of the SBC.", append([]string{"state"}, labels...)),
+		prometheus.GaugeValue,
+		1, append([]string{value}, labelValues...)...)
+}
+
+// statsTimestampFields are the system_stat fields that may hold the time the
+// SBC generated the stats dump.
+var statsTimestampFields = []string{"timestamp", "stat_time", "gen_time", "update_time", "last_update"}
+
+// processStatsTimestamp exports the time the SBC generated the dump and its
+// age at scrape time, so SBCs serving stale cached stats files stand out.
+func (c collector) processStatsTimestamp(ch chan<- prometheus.Metric, sansay Sansay) {
+	value := sansay.Timestamp
+	if value == "" {
+		value = sansay.Database.Timestamp
+	}
+	for _, table := range sansay.Database.Table {
+		if value != "" {
+			break
+		}
+		if table.Name == "system_stat" && len(table.Row) > 0 {
+			value = firstField(table.Row[0].Fields(), statsTimestampFields...)
+		}
+	}
+	t, ok := parseTimestamp(value)
+	if !ok {
+		return
+	}
+	labels := []string{"path"}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_stats_timestamp_seconds", "Time the SBC generated the stats dump.", labels),
+		prometheus.GaugeValue,
+		float64(t.Unix()), sansay.Path)
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_stats_age_seconds", "Age of the stats dump at scrape time.", labels),
+		prometheus.GaugeValue,
+		time.Since(t).Seconds(), sansay.Path)
+}
+
+// processAlarmTables counts the active alarms of a dump's alarm tables by
+// severity and category and exports the time the newest alarm was raised.
+// Firmware splitting the alarms across tables is counted across all of them.
+func (c collector) processAlarmTables(ch chan<- prometheus.Metric, tables []Table) {
+	type alarmKey struct{ severity, category string }
+	active := map[alarmKey]int{}
+	var newest time.Time
+	for _, table := range tables {
+		for _, row := range table.Row {
+			fields := row.Fields()
+			switch strings.ToLower(firstField(fields, "status", "state")) {
+			case "cleared", "clear", "inactive", "0":
+				continue
+			}
+			key := alarmKey{
+				severity: strings.ToLower(firstField(fields, "severity", "level")),
+				category: strings.ToLower(firstField(fields, "category", "type")),
+			}
+			active[key]++
+			if t, ok := parseTimestamp(firstField(fields, "timestamp", "time", "raise_time", "date")); ok && t.After(newest) {
+				newest = t
+			}
+		}
+	}
+
+	labels := []string{"severity", "category"}
+	for key, count := range active {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_alarm_active", "Number of active alarms on the SBC.", labels),
+			prometheus.GaugeValue,
+			float64(count), key.severity, key.category)
+	}
+	if !newest.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_alarm_last_timestamp_seconds", "Time the newest active alarm was raised.", nil),
+			prometheus.GaugeValue,
+			float64(newest.Unix()))
+	}
+}
+
+// responseCode returns the SIP response code a response code table field
+// counts, e.g. "sip_486" or "code_503", or 0 if the field is not a code.
+func responseCode(name string) int {
+	for _, prefix := range []string{"sip_", "code_", "resp_", "response_"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	code, err := strconv.Atoi(name)
+	if err != nil || code < 100 || code > 699 {
+		return 0
+	}
+	return code
+}
+
+// processResponseCodeTable exports the per-trunk SIP response code counts,
+// grouped by code class.  Rows either hold one code per field (sip_404,
+// sip_486, ...) or a code and count field pair.
+func (c collector) processResponseCodeTable(ch chan<- prometheus.Metric, table Table) {
+	type responseKey struct{ trunkgroup, class string }
+	responses := map[responseKey]float64{}
+	for _, row := range table.Row {
+		fields := row.Fields()
+		trunkgroup := firstField(fields, "trunkId", "trunk_id")
+		if code := responseCode(firstField(fields, "code", "response_code")); code != 0 {
+			count, err := strconv.ParseFloat(firstField(fields, "count", "total"), 64)
+			if err == nil {
+				responses[responseKey{trunkgroup, fmt.Sprintf("%dxx", code/100)}] += count
+			}
+			continue
+		}
+		for name, value := range fields {
+			code := responseCode(name)
+			if code == 0 {
+				continue
+			}
+			count, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			responses[responseKey{trunkgroup, fmt.Sprintf("%dxx", code/100)}] += count
+		}
+	}
+	for key, count := range responses {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_trunk_responses_total", "SIP responses received from the trunk's peers by code class.", []string{"trunkgroup", "code_class"}),
+			prometheus.CounterValue,
+			count, key.trunkgroup, key.class)
+	}
+}
+
+// statField describes an optional numeric stats table field, with the field
+// names used by different firmware and the factor converting it to base units.
+type statField struct {
+	metric, help string
+	valueType    prometheus.ValueType
+	scale        float64
+	fields       []string
+}
+
+// trunkRejections are the call admission control and policing counters of
+// the realtime trunk table.
+var trunkRejections = []statField{
+	{"sansay_trunk_cac_rejections_total", "Calls rejected by call admission control.", prometheus.CounterValue, 1, []string{"numCACReject", "numCacReject", "cacReject"}},
+	{"sansay_trunk_cps_limit_drops_total", "Calls dropped for exceeding the CPS limit.", prometheus.CounterValue, 1, []string{"numCpsReject", "numCPSReject", "cpsReject", "cpsLimitDrop"}},
+	{"sansay_trunk_session_limit_drops_total", "Calls dropped for exceeding the session limit.", prometheus.CounterValue, 1, []string{"numSessionReject", "numCapReject", "sessionReject", "sessionLimitDrop"}},
+}
+
+// trunkQualityFields are the voice quality fields of the media quality
+// tables.  Loss is reported in percent and jitter in milliseconds.
+var trunkQualityFields = []statField{
+	{"sansay_trunk_rtp_packet_loss_ratio", "RTP packet loss towards the trunk.", prometheus.GaugeValue, 0.01, []string{"packet_loss", "packetLoss", "pkt_loss", "loss"}},
+	{"sansay_trunk_rtp_jitter_seconds", "RTP jitter towards the trunk.", prometheus.GaugeValue, 0.001, []string{"jitter", "avg_jitter", "jitter_ms"}},
+	{"sansay_trunk_mos", "Mean opinion score of the trunk's calls.", prometheus.GaugeValue, 1, []string{"mos", "avg_mos", "MOS"}},
+	{"sansay_trunk_r_factor", "R-factor of the trunk's calls.", prometheus.GaugeValue, 1, []string{"r_factor", "rFactor", "rfactor"}},
+}
+
+// addTrunkFields exports the given optional fields of a trunk row, where the
+// firmware reports them.
+func addTrunkFields(ch chan<- prometheus.Metric, trunk Trunk, fields map[string]string, defs []statField) {
+	labels, labelValues := trunkLabels(trunk)
+	addStatFields(ch, fields, defs, labels, labelValues)
+}
+
+// addStatFields exports the given optional fields of a row, where the
+// firmware reports them.
+func addStatFields(ch chan<- prometheus.Metric, fields map[string]string, defs []statField, labels, labelValues []string) {
+	for _, def := range defs {
+		value, err := strconv.ParseFloat(firstField(fields, def.fields...), 64)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc(def.metric, def.help, labels),
+			def.valueType,
+			value*def.scale, labelValues...)
+	}
+}
+
+// rowGroup is the rows of a table exported with the same labels.
+type rowGroup struct {
+	labels, labelValues []string
+	rows                []map[string]string
+}
+
+// groupRows groups the rows of table by the labels rowLabels returns for
+// their fields, in the order first seen, so rows sharing them are exported
+// as one series rather than as duplicates failing the scrape.
+func groupRows(table Table, rowLabels func(fields map[string]string) ([]string, []string)) []*rowGroup {
+	var groups []*rowGroup
+	byKey := map[string]*rowGroup{}
+	for _, row := range table.Row {
+		fields := row.Fields()
+		labels, labelValues := rowLabels(fields)
+		key := strings.Join(labels, "\xff") + "\xfe" + strings.Join(labelValues, "\xff")
+		group, ok := byKey[key]
+		if !ok {
+			group = &rowGroup{labels: labels, labelValues: labelValues}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.rows = append(group.rows, fields)
+	}
+	return groups
+}
+
+// addGroupStatFields exports the given optional fields of a group of rows,
+// where the firmware reports them, averaged over the rows reporting them
+// with mean, and summed otherwise.
+func addGroupStatFields(ch chan<- prometheus.Metric, group *rowGroup, defs []statField, mean bool) {
+	for _, def := range defs {
+		value, reported := 0.0, 0
+		for _, fields := range group.rows {
+			v, err := strconv.ParseFloat(firstField(fields, def.fields...), 64)
+			if err != nil {
+				continue
+			}
+			value += v
+			reported++
+		}
+		if reported == 0 {
+			continue
+		}
+		if mean {
+			value /= float64(reported)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc(def.metric, def.help, group.labels),
+			def.valueType,
+			value*def.scale, group.labelValues...)
+	}
+}
+
+// processQualityTable exports the per-trunk voice quality statistics,
+// averaged over the rows of the same trunk.
+func (c collector) processQualityTable(ch chan<- prometheus.Metric, table Table) {
+	groups := groupRows(table, func(fields map[string]string) ([]string, []string) {
+		return trunkLabels(Trunk{
+			TrunkId: firstField(fields, "trunkId", "trunk_id"),
+			Alias:   firstField(fields, "alias", "name"),
+			Node:    nodeLabel(fields),
+		})
+	})
+	for _, group := range groups {
+		addGroupStatFields(ch, group, trunkQualityFields, true)
+	}
+}
+
+// transcodingFields are the session fields of the transcoding/DSP resource
+// tables, summed over the rows of the same codec.
+var transcodingFields = []statField{
+	{"sansay_transcoding_sessions", "Active transcoding sessions.", prometheus.GaugeValue, 1, []string{"sessions", "active_sessions", "numSessions", "in_use", "used"}},
+	{"sansay_transcoding_sessions_limit", "Licensed transcoding capacity.", prometheus.GaugeValue, 1, []string{"capacity", "licensed", "max_sessions", "total"}},
+}
+
+// transcodingRatioFields are the utilization fields of the transcoding/DSP
+// resource tables, averaged over the rows of the same codec.  Utilization is
+// reported in percent.
+var transcodingRatioFields = []statField{
+	{"sansay_transcoding_utilization_ratio", "Utilization of the transcoding/DSP capacity.", prometheus.GaugeValue, 0.01, []string{"utilization", "usage_percent", "dsp_usage"}},
+}
+
+// transcodingCodec returns the codec (or codec pair) a transcoding row is for.
+func transcodingCodec(fields map[string]string) string {
+	from := firstField(fields, "codec_from", "src_codec", "codec1")
+	to := firstField(fields, "codec_to", "dst_codec", "codec2")
+	if from != "" && to != "" {
+		return from + "-" + to
+	}
+	return firstField(fields, "codec", "codec_pair")
+}
+
+// processTranscodingTable exports the transcoding session counts and DSP
+// capacity, labeled by codec where the table breaks them down.
+func (c collector) processTranscodingTable(ch chan<- prometheus.Metric, table Table) {
+	groups := groupRows(table, func(fields map[string]string) ([]string, []string) {
+		labels := []string{"codec"}
+		labelValues := []string{transcodingCodec(fields)}
+		if node := nodeLabel(fields); node != "" {
+			labels = append(labels, "node")
+			labelValues = append(labelValues, node)
+		}
+		return labels, labelValues
+	})
+	for _, group := range groups {
+		addGroupStatFields(ch, group, transcodingFields, false)
+		addGroupStatFields(ch, group, transcodingRatioFields, true)
+	}
+}
+
+// processRTPPortTable exports the media port allocation per media interface,
+// summed over the rows of the same interface.  The configured pool is either
+// given as a count or as a port range.
+func (c collector) processRTPPortTable(ch chan<- prometheus.Metric, table Table) {
+	groups := groupRows(table, func(fields map[string]string) ([]string, []string) {
+		return []string{"interface"}, []string{firstField(fields, "interface", "media_ip", "ip", "publicIP", "name")}
+	})
+	for _, group := range groups {
+		var used, pooledUsed, total float64
+		reported := false
+		for _, fields := range group.rows {
+			rowUsed, err := strconv.ParseFloat(firstField(fields, "ports_in_use", "used_ports", "ports_used", "in_use"), 64)
+			if err != nil {
+				continue
+			}
+			used += rowUsed
+			reported = true
+			if rowTotal := rtpPortPool(fields); rowTotal > 0 {
+				pooledUsed += rowUsed
+				total += rowTotal
+			}
+		}
+		if !reported {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_rtp_ports_used", "Media ports allocated on the interface.", group.labels),
+			prometheus.GaugeValue,
+			used, group.labelValues...)
+		if total <= 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_rtp_ports", "Media ports configured on the interface.", group.labels),
+			prometheus.GaugeValue,
+			total, group.labelValues...)
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_rtp_ports_utilization_ratio", "Ratio of the interface's media ports in use.", group.labels),
+			prometheus.GaugeValue,
+			pooledUsed/total, group.labelValues...)
+	}
+}
+
+// rtpPortPool returns the media ports configured in an RTP port row, or 0 if
+// it reports neither a count nor a valid range.
+func rtpPortPool(fields map[string]string) float64 {
+	if total, err := strconv.ParseFloat(firstField(fields, "total_ports", "port_count", "ports_total"), 64); err == nil {
+		return total
+	}
+	low, errLow := strconv.ParseFloat(firstField(fields, "port_min", "start_port", "port_range_start"), 64)
+	high, errHigh := strconv.ParseFloat(firstField(fields, "port_max", "end_port", "port_range_end"), 64)
+	if errLow != nil || errHigh != nil || high < low {
+		return 0
+	}
+	return high - low + 1
+}
+
+// processBlacklistTable exports the number of dynamically blacklisted
+// endpoints, and the block events recorded against them by reason.  The
+// events are a gauge: they are summed from the rows present, which drop out
+// of the table as their blocks expire.
+func (c collector) processBlacklistTable(ch chan<- prometheus.Metric, table Table) {
+	events := map[string]float64{}
+	for _, row := range table.Row {
+		fields := row.Fields()
+		reason := strings.ToLower(firstField(fields, "reason", "type", "cause"))
+		count, err := strconv.ParseFloat(firstField(fields, "block_count", "hits", "count", "events"), 64)
+		if err != nil {
+			count = 1
+		}
+		events[reason] += count
+	}
+	ch <- prometheus.MustNewConstMetric(
+		newDesc("sansay_blocked_endpoints", "Endpoints currently on the SBC's dynamic blacklist.", nil),
+		prometheus.GaugeValue,
+		float64(len(table.Row)))
+	for reason, count := range events {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_block_events", "Block events recorded against the endpoints currently blacklisted.", []string{"reason"}),
+			prometheus.GaugeValue,
+			count, reason)
+	}
+}
+
+// accountingServerFields are the per-server fields of the accounting/billing
+// server tables.
+var accountingServerFields = []statField{
+	{"sansay_accounting_server_failovers_total", "Failovers away from the accounting server.", prometheus.CounterValue, 1, []string{"failover_count", "failovers", "num_failover"}},
+	{"sansay_accounting_records_pending", "Accounting records queued and not yet sent to the server.", prometheus.GaugeValue, 1, []string{"queue_depth", "pending", "queued", "unsent_records"}},
+}
+
+// processAccountingServerTable exports the state of the configured RADIUS
+// and billing servers, so missing CDRs are caught early.
+func (c collector) processAccountingServerTable(ch chan<- prometheus.Metric, table Table) {
+	labels := []string{"server"}
+	for _, row := range table.Row {
+		fields := row.Fields()
+		labelValues := []string{firstField(fields, "server", "name", "ip", "address", "host")}
+		if status := firstField(fields, "status", "state"); status != "" {
+			ch <- prometheus.MustNewConstMetric(
+				newDesc("sansay_accounting_server_up", "Whether the accounting server is reachable.", labels),
+				prometheus.GaugeValue,
+				syncedValue(status), labelValues...)
+		}
+		addStatFields(ch, fields, accountingServerFields, labels, labelValues)
+	}
+}
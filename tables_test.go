@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// compareCollection runs the XML dump through processCollection and compares
+// the named metrics against the expected exposition text.  HELP lines are
+// ignored, as most of the exporter's metrics have no help text.
+func compareCollection(t *testing.T, dump string, expected string, names ...string) {
+	t.Helper()
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger()}
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, sansay)
+	}, expected, names...)
+}
+
+// compareMetrics compares the named metrics emitted by collect against the
+// expected exposition text, ignoring HELP lines.
+func compareMetrics(t *testing.T, collect metricsFunc, expected string, names ...string) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collect)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var got strings.Builder
+	for _, family := range families {
+		if wanted[family.GetName()] {
+			expfmt.MetricFamilyToText(&got, family)
+		}
+	}
+	if stripHelp(got.String()) != stripHelp(expected) {
+		t.Errorf("Unexpected metrics, want:\n%s\ngot:\n%s", expected, got.String())
+	}
+}
+
+func stripHelp(text string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if !strings.HasPrefix(line, "# HELP") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{value: "1577836800", want: 1577836800, ok: true},
+		{value: "2020-01-01 00:00:00", want: 1577836800, ok: true},
+		{value: "0", ok: false},
+		{value: "n/a", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTimestamp(tt.value)
+		if ok != tt.ok || (ok && got.Unix() != tt.want) {
+			t.Errorf("parseTimestamp(%q) = %v, %v; want %d, %v", tt.value, got.Unix(), ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestProcessAlarmTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="alarm">
+<row><field name="severity">Major</field><field name="category">Network</field><field name="timestamp">2020-01-01 00:00:00</field></row>
+<row><field name="severity">Major</field><field name="category">Network</field><field name="timestamp">2020-01-01 01:00:00</field></row>
+<row><field name="severity">Minor</field><field name="category">System</field><field name="status">cleared</field><field name="timestamp">2020-01-02 00:00:00</field></row>
+</table></database></mysqldump>`
+	expected := `
+# HELP sansay_alarm_active Number of active alarms on the SBC.
+# TYPE sansay_alarm_active gauge
+sansay_alarm_active{category="network",severity="major"} 2
+# HELP sansay_alarm_last_timestamp_seconds Time the newest active alarm was raised.
+# TYPE sansay_alarm_last_timestamp_seconds gauge
+sansay_alarm_last_timestamp_seconds 1.5778404e+09
+`
+	compareCollection(t, dump, expected, "sansay_alarm_active", "sansay_alarm_last_timestamp_seconds")
+}
+
+func TestProcessAlarmTablesCombined(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="alarm">
+<row><field name="severity">Major</field><field name="category">Network</field><field name="timestamp">2020-01-01 00:00:00</field></row>
+</table><table name="active_alarm">
+<row><field name="severity">Major</field><field name="category">Network</field><field name="timestamp">2020-01-01 01:00:00</field></row>
+<row><field name="severity">Critical</field><field name="category">System</field></row>
+</table></database></mysqldump>`
+	expected := `
+# HELP sansay_alarm_active Number of active alarms on the SBC.
+# TYPE sansay_alarm_active gauge
+sansay_alarm_active{category="network",severity="major"} 2
+sansay_alarm_active{category="system",severity="critical"} 1
+# HELP sansay_alarm_last_timestamp_seconds Time the newest active alarm was raised.
+# TYPE sansay_alarm_last_timestamp_seconds gauge
+sansay_alarm_last_timestamp_seconds 1.5778404e+09
+`
+	compareCollection(t, dump, expected, "sansay_alarm_active", "sansay_alarm_last_timestamp_seconds")
+}
+
+func TestProcessSystemSync(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="system_stat"><row>
+<field name="db_sync_status">In Sync</field>
+<field name="db_last_sync_time">2020-01-01 00:00:00</field>
+<field name="config_version">1042</field>
+<field name="config_last_change">2020-01-02 00:00:00</field>
+</row></table></database></mysqldump>`
+	expected := `
+# HELP sansay_config_info Configuration version running on the SBC.
+# TYPE sansay_config_info gauge
+sansay_config_info{version="1042"} 1
+# HELP sansay_config_last_change_timestamp_seconds Time the configuration running on the SBC was last changed.
+# TYPE sansay_config_last_change_timestamp_seconds gauge
+sansay_config_last_change_timestamp_seconds 1.5779232e+09
+# HELP sansay_db_last_sync_timestamp_seconds Time of the last master/slave database sync.
+# TYPE sansay_db_last_sync_timestamp_seconds gauge
+sansay_db_last_sync_timestamp_seconds 1.5778368e+09
+# HELP sansay_db_synced Whether the master/slave database replication is in sync.
+# TYPE sansay_db_synced gauge
+sansay_db_synced 1
+`
+	compareCollection(t, dump, expected, "sansay_config_info", "sansay_config_last_change_timestamp_seconds", "sansay_db_last_sync_timestamp_seconds", "sansay_db_synced", "sansay_config_version")
+}
+
+func TestProcessClusterNodes(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="system_stat">
+<row><field name="node_id">1</field><field name="cpu_idle">90</field></row>
+<row><field name="node_id">2</field><field name="cpu_idle">40</field></row>
+</table>
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="nodeId">1</field><field name="numOrig">5</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="nodeId">2</field><field name="numOrig">7</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	expected := `
+# HELP sansay_cpu_idle 
+# TYPE sansay_cpu_idle gauge
+sansay_cpu_idle{node="1"} 90
+sansay_cpu_idle{node="2"} 40
+# HELP sansay_trunk_numorig 
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="carrier",node="1",trunkgroup="100"} 5
+sansay_trunk_numorig{alias="carrier",node="2",trunkgroup="100"} 7
+`
+	compareCollection(t, dump, expected, "sansay_cpu_idle", "sansay_trunk_numorig", "sansay_node_id")
+}
+
+func TestProcessTrunkType(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="direction">Term Only</field><field name="numOrig">0</field><field name="numTerm">9</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">200</field><field name="alias">customer</field><field name="fqdn">Group</field><field name="numOrig">4</field><field name="numTerm">0</field><field name="cps">0</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">0</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	expected := `
+# HELP sansay_trunk_numterm 
+# TYPE sansay_trunk_numterm gauge
+sansay_trunk_numterm{alias="customer",trunkgroup="200"} 0
+sansay_trunk_numterm{alias="carrier",trunkgroup="100",type="termination"} 9
+`
+	compareCollection(t, dump, expected, "sansay_trunk_numterm")
+}
+
+func TestTrunkType(t *testing.T) {
+	for direction, want := range map[string]string{
+		"":              "",
+		"Orig Only":     "origination",
+		"Inbound":       "origination",
+		"Term-Only":     "termination",
+		"Outbound":      "termination",
+		"Bidirectional": "bidirectional",
+		"Both":          "bidirectional",
+		"Peering":       "peering",
+	} {
+		if got := trunkType(direction); got != want {
+			t.Errorf("Expected %q to be %q, received %q", direction, want, got)
+		}
+	}
+}
+
+func TestTrunkAdminState(t *testing.T) {
+	for state, want := range map[string]string{
+		"":               "unknown",
+		"In Service":     "enabled",
+		"active":         "enabled",
+		"Enabled":        "enabled",
+		"Out of Service": "disabled",
+		"Inactive":       "disabled",
+		"disabled":       "disabled",
+		"Maintenance":    "maintenance",
+	} {
+		if got := trunkAdminState(state); got != want {
+			t.Errorf("Expected %q to be %q, received %q", state, want, got)
+		}
+	}
+}
+
+func TestProcessSystemNTP(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="system_stat"><row>
+<field name="ntp_status">synchronized</field>
+<field name="ntp_offset">-12.5</field>
+</row></table></database></mysqldump>`
+	expected := `
+# TYPE sansay_ntp_offset_seconds gauge
+sansay_ntp_offset_seconds -0.0125
+# TYPE sansay_ntp_synced gauge
+sansay_ntp_synced 1
+`
+	compareCollection(t, dump, expected, "sansay_ntp_offset_seconds", "sansay_ntp_synced", "sansay_ntp_offset")
+}
+
+func TestProcessStatsTimestamp(t *testing.T) {
+	dump := `<mysqldump timestamp="2020-01-01 00:00:00"><database name="stats"></database></mysqldump>`
+	expected := `
+# TYPE sansay_stats_timestamp_seconds gauge
+sansay_stats_timestamp_seconds{path=""} 1.5778368e+09
+`
+	compareCollection(t, dump, expected, "sansay_stats_timestamp_seconds")
+}
+
+func TestProcessResponseCodeTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="response_code_stat">
+<row><field name="trunkId">100</field><field name="sip_404">3</field><field name="sip_486">2</field><field name="sip_503">1</field></row>
+<row><field name="trunkId">200</field><field name="code">503</field><field name="count">4</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_trunk_responses_total counter
+sansay_trunk_responses_total{code_class="4xx",trunkgroup="100"} 5
+sansay_trunk_responses_total{code_class="5xx",trunkgroup="100"} 1
+sansay_trunk_responses_total{code_class="5xx",trunkgroup="200"} 4
+`
+	compareCollection(t, dump, expected, "sansay_trunk_responses_total")
+}
+
+func TestAddTrunkFields(t *testing.T) {
+	trunk := Trunk{TrunkId: "100", Alias: "carrier"}
+	fields := map[string]string{"numCACReject": "3", "cpsLimitDrop": "7"}
+	expected := `
+# TYPE sansay_trunk_cac_rejections_total counter
+sansay_trunk_cac_rejections_total{alias="carrier",trunkgroup="100"} 3
+# TYPE sansay_trunk_cps_limit_drops_total counter
+sansay_trunk_cps_limit_drops_total{alias="carrier",trunkgroup="100"} 7
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		addTrunkFields(ch, trunk, fields, trunkRejections)
+	}, expected, "sansay_trunk_cac_rejections_total", "sansay_trunk_cps_limit_drops_total", "sansay_trunk_session_limit_drops_total")
+}
+
+func TestProcessQualityTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="media_quality_stat">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="packet_loss">1.5</field><field name="jitter">20</field><field name="mos">4.1</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_trunk_mos gauge
+sansay_trunk_mos{alias="carrier",trunkgroup="100"} 4.1
+# TYPE sansay_trunk_rtp_jitter_seconds gauge
+sansay_trunk_rtp_jitter_seconds{alias="carrier",trunkgroup="100"} 0.02
+# TYPE sansay_trunk_rtp_packet_loss_ratio gauge
+sansay_trunk_rtp_packet_loss_ratio{alias="carrier",trunkgroup="100"} 0.015
+`
+	compareCollection(t, dump, expected, "sansay_trunk_mos", "sansay_trunk_rtp_jitter_seconds", "sansay_trunk_rtp_packet_loss_ratio", "sansay_trunk_r_factor")
+}
+
+func TestProcessQualityTableRepeatedTrunk(t *testing.T) {
+	// Rows of the same trunk, e.g. one per codec, and rows without a trunk
+	// are averaged rather than exported as duplicate series.
+	dump := `<mysqldump><database name="stats"><table name="media_quality_stat">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="packet_loss">1</field><field name="mos">4</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="packet_loss">2</field><field name="mos">4.5</field><field name="jitter">20</field></row>
+<row><field name="mos">3</field></row>
+<row><field name="mos">4</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_trunk_mos gauge
+sansay_trunk_mos{alias="",trunkgroup=""} 3.5
+sansay_trunk_mos{alias="carrier",trunkgroup="100"} 4.25
+# TYPE sansay_trunk_rtp_jitter_seconds gauge
+sansay_trunk_rtp_jitter_seconds{alias="carrier",trunkgroup="100"} 0.02
+# TYPE sansay_trunk_rtp_packet_loss_ratio gauge
+sansay_trunk_rtp_packet_loss_ratio{alias="carrier",trunkgroup="100"} 0.015
+`
+	compareCollection(t, dump, expected, "sansay_trunk_mos", "sansay_trunk_rtp_jitter_seconds", "sansay_trunk_rtp_packet_loss_ratio")
+}
+
+func TestProcessTranscodingTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="transcoding_stat">
+<row><field name="codec_from">PCMU</field><field name="codec_to">G729</field><field name="sessions">12</field></row>
+<row><field name="sessions">12</field><field name="capacity">100</field><field name="utilization">12</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_transcoding_sessions gauge
+sansay_transcoding_sessions{codec=""} 12
+sansay_transcoding_sessions{codec="PCMU-G729"} 12
+# TYPE sansay_transcoding_sessions_limit gauge
+sansay_transcoding_sessions_limit{codec=""} 100
+# TYPE sansay_transcoding_utilization_ratio gauge
+sansay_transcoding_utilization_ratio{codec=""} 0.12
+`
+	compareCollection(t, dump, expected, "sansay_transcoding_sessions", "sansay_transcoding_sessions_limit", "sansay_transcoding_utilization_ratio")
+}
+
+func TestProcessTranscodingTableRepeatedCodec(t *testing.T) {
+	// Rows of the same codec, e.g. one per DSP card, are summed, with their
+	// utilization averaged, rather than exported as duplicate series.
+	dump := `<mysqldump><database name="stats"><table name="dsp_stat">
+<row><field name="codec">G729</field><field name="sessions">10</field><field name="capacity">50</field><field name="utilization">20</field></row>
+<row><field name="codec">G729</field><field name="sessions">30</field><field name="capacity">50</field><field name="utilization">60</field></row>
+<row><field name="sessions">5</field></row>
+<row><field name="sessions">7</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_transcoding_sessions gauge
+sansay_transcoding_sessions{codec=""} 12
+sansay_transcoding_sessions{codec="G729"} 40
+# TYPE sansay_transcoding_sessions_limit gauge
+sansay_transcoding_sessions_limit{codec="G729"} 100
+# TYPE sansay_transcoding_utilization_ratio gauge
+sansay_transcoding_utilization_ratio{codec="G729"} 0.4
+`
+	compareCollection(t, dump, expected, "sansay_transcoding_sessions", "sansay_transcoding_sessions_limit", "sansay_transcoding_utilization_ratio")
+}
+
+func TestProcessRTPPortTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="rtp_port_stat">
+<row><field name="interface">10.0.0.1</field><field name="ports_in_use">2500</field><field name="port_min">10000</field><field name="port_max">19999</field></row>
+<row><field name="interface">10.0.0.2</field><field name="ports_in_use">100</field><field name="total_ports">1000</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_rtp_ports gauge
+sansay_rtp_ports{interface="10.0.0.1"} 10000
+sansay_rtp_ports{interface="10.0.0.2"} 1000
+# TYPE sansay_rtp_ports_used gauge
+sansay_rtp_ports_used{interface="10.0.0.1"} 2500
+sansay_rtp_ports_used{interface="10.0.0.2"} 100
+# TYPE sansay_rtp_ports_utilization_ratio gauge
+sansay_rtp_ports_utilization_ratio{interface="10.0.0.1"} 0.25
+sansay_rtp_ports_utilization_ratio{interface="10.0.0.2"} 0.1
+`
+	compareCollection(t, dump, expected, "sansay_rtp_ports", "sansay_rtp_ports_used", "sansay_rtp_ports_utilization_ratio")
+}
+
+func TestProcessRTPPortTableRepeatedInterface(t *testing.T) {
+	// Rows of the same interface, e.g. one per port range, and rows without
+	// an interface are summed rather than exported as duplicate series.
+	dump := `<mysqldump><database name="stats"><table name="media_port_stat">
+<row><field name="interface">10.0.0.1</field><field name="ports_in_use">500</field><field name="port_min">10000</field><field name="port_max">10999</field></row>
+<row><field name="interface">10.0.0.1</field><field name="ports_in_use">250</field><field name="port_min">20000</field><field name="port_max">20999</field></row>
+<row><field name="ports_in_use">10</field></row>
+<row><field name="ports_in_use">20</field><field name="total_ports">100</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_rtp_ports gauge
+sansay_rtp_ports{interface=""} 100
+sansay_rtp_ports{interface="10.0.0.1"} 2000
+# TYPE sansay_rtp_ports_used gauge
+sansay_rtp_ports_used{interface=""} 30
+sansay_rtp_ports_used{interface="10.0.0.1"} 750
+# TYPE sansay_rtp_ports_utilization_ratio gauge
+sansay_rtp_ports_utilization_ratio{interface=""} 0.2
+sansay_rtp_ports_utilization_ratio{interface="10.0.0.1"} 0.375
+`
+	compareCollection(t, dump, expected, "sansay_rtp_ports", "sansay_rtp_ports_used", "sansay_rtp_ports_utilization_ratio")
+}
+
+func TestProcessBlacklistTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="dynamic_blacklist">
+<row><field name="ip">192.0.2.1</field><field name="reason">Flood</field><field name="block_count">10</field></row>
+<row><field name="ip">192.0.2.2</field><field name="reason">Flood</field><field name="block_count">5</field></row>
+<row><field name="ip">192.0.2.3</field><field name="reason">auth_failure</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_block_events gauge
+sansay_block_events{reason="auth_failure"} 1
+sansay_block_events{reason="flood"} 15
+# TYPE sansay_blocked_endpoints gauge
+sansay_blocked_endpoints 3
+`
+	compareCollection(t, dump, expected, "sansay_block_events", "sansay_blocked_endpoints")
+}
+
+func TestProcessEmergencyCalls(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="system_stat"><row>
+<field name="num_emergency_calls">42</field>
+<field name="num_emergency_active">1</field>
+</row></table></database></mysqldump>`
+	expected := `
+# TYPE sansay_emergency_calls_active gauge
+sansay_emergency_calls_active 1
+# TYPE sansay_emergency_calls_total counter
+sansay_emergency_calls_total 42
+`
+	compareCollection(t, dump, expected, "sansay_emergency_calls_active", "sansay_emergency_calls_total", "sansay_num_emergency_calls")
+
+	dump = `<mysqldump><database name="stats"><table name="e911_stat"><row>
+<field name="e911_calls">7</field>
+<field name="e911_failed">2</field>
+</row></table></database></mysqldump>`
+	expected = `
+# TYPE sansay_emergency_calls_failed_total counter
+sansay_emergency_calls_failed_total 2
+# TYPE sansay_emergency_calls_total counter
+sansay_emergency_calls_total 7
+`
+	compareCollection(t, dump, expected, "sansay_emergency_calls_failed_total", "sansay_emergency_calls_total")
+}
+
+func TestProcessOverload(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="system_stat"><row>
+<field name="overload_state">Active</field>
+<field name="overload_level">2</field>
+<field name="call_gap_percent">25</field>
+<field name="calls_gapped">140</field>
+</row></table></database></mysqldump>`
+	expected := `
+# TYPE sansay_overload_active gauge
+sansay_overload_active 1
+# TYPE sansay_overload_gapped_calls_total counter
+sansay_overload_gapped_calls_total 140
+# TYPE sansay_overload_gapped_ratio gauge
+sansay_overload_gapped_ratio 0.25
+# TYPE sansay_overload_level gauge
+sansay_overload_level 2
+`
+	compareCollection(t, dump, expected, "sansay_overload_active", "sansay_overload_gapped_calls_total", "sansay_overload_gapped_ratio", "sansay_overload_level", "sansay_overload_state")
+
+	dump = `<mysqldump><database name="stats"><table name="system_stat"><row>
+<field name="call_gap_active">normal</field>
+</row></table></database></mysqldump>`
+	expected = `
+# TYPE sansay_overload_active gauge
+sansay_overload_active 0
+`
+	compareCollection(t, dump, expected, "sansay_overload_active")
+}
+
+func TestProcessAccountingBacklog(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="system_stat"><row>
+<field name="acct_queue_depth">830</field>
+</row></table></database></mysqldump>`
+	expected := `
+# TYPE sansay_accounting_backlog_records gauge
+sansay_accounting_backlog_records 830
+`
+	compareCollection(t, dump, expected, "sansay_accounting_backlog_records", "sansay_acct_queue_depth")
+}
+
+func TestProcessAccountingServerTable(t *testing.T) {
+	dump := `<mysqldump><database name="stats"><table name="radius_stat">
+<row><field name="server">10.0.0.10</field><field name="status">up</field><field name="failover_count">0</field><field name="queue_depth">0</field></row>
+<row><field name="server">10.0.0.11</field><field name="status">down</field><field name="failover_count">3</field><field name="queue_depth">250</field></row>
+</table></database></mysqldump>`
+	expected := `
+# TYPE sansay_accounting_records_pending gauge
+sansay_accounting_records_pending{server="10.0.0.10"} 0
+sansay_accounting_records_pending{server="10.0.0.11"} 250
+# TYPE sansay_accounting_server_failovers_total counter
+sansay_accounting_server_failovers_total{server="10.0.0.10"} 0
+sansay_accounting_server_failovers_total{server="10.0.0.11"} 3
+# TYPE sansay_accounting_server_up gauge
+sansay_accounting_server_up{server="10.0.0.10"} 1
+sansay_accounting_server_up{server="10.0.0.11"} 0
+`
+	compareCollection(t, dump, expected, "sansay_accounting_records_pending", "sansay_accounting_server_failovers_total", "sansay_accounting_server_up")
+}
+
+func TestProcessDNSStats(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="system_stat"><row><field name="dns_queries">1000</field><field name="dns_avg_response_ms">250</field></row></table>
+<table name="dns_stat"><row><field name="node_id">1</field><field name="dns_failures">4</field></row></table>
+</database></mysqldump>`
+	expected := `
+# TYPE sansay_dns_failures_total counter
+sansay_dns_failures_total{node="1"} 4
+# TYPE sansay_dns_queries_total counter
+sansay_dns_queries_total 1000
+# TYPE sansay_dns_response_time_seconds gauge
+sansay_dns_response_time_seconds 0.25
+`
+	compareCollection(t, dump, expected, "sansay_dns_failures_total", "sansay_dns_queries_total", "sansay_dns_response_time_seconds")
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tcdPath is the download of the SBC's terminated call detail records.
+const tcdPath = "download/tcd"
+
+// tcdTracker counts the terminated call detail (TCD) records of each target.
+// The download holds the most recent records, so records are only counted if
+// they are newer than the ones already seen.
+type tcdTracker struct {
+	mu      sync.Mutex
+	targets map[string]*tcdTarget
+}
+
+type tcdTarget struct {
+	// last is the newest record time seen, and seen the IDs of the records
+	// at exactly that time, which may be split across downloads.
+	last   time.Time
+	seen   map[string]bool
+	causes map[string]float64
+	calls  map[tcdCallKey]float64
+}
+
+type tcdCallKey struct {
+	trunkgroup, direction, result string
+}
+
+func newTCDTracker() *tcdTracker {
+	return &tcdTracker{targets: map[string]*tcdTarget{}}
+}
+
+// record counts the records of the TCD table that have not been seen yet.
+func (t *tcdTracker) record(name string, table Table) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target, ok := t.targets[name]
+	if !ok {
+		target = &tcdTarget{seen: map[string]bool{}, causes: map[string]float64{}, calls: map[tcdCallKey]float64{}}
+		t.targets[name] = target
+	}
+
+	last, seen := target.last, map[string]bool{}
+	for _, row := range table.Row {
+		fields := row.Fields()
+		ended, ok := parseTimestamp(firstField(fields, "disconnect_time", "end_time", "timestamp", "ts"))
+		if !ok {
+			continue
+		}
+		id := firstField(fields, "id", "call_id", "session_id")
+		if ended.Before(target.last) || (ended.Equal(target.last) && target.seen[id]) {
+			continue
+		}
+		if ended.After(last) {
+			last, seen = ended, map[string]bool{}
+		}
+		if ended.Equal(last) {
+			seen[id] = true
+		}
+
+		target.causes[firstField(fields, "release_cause", "disconnect_cause", "cause_code")]++
+		result := "failed"
+		if duration, err := strconv.ParseFloat(firstField(fields, "duration", "call_duration", "durationSec"), 64); err == nil && duration > 0 {
+			result = "answered"
+		}
+		if trunk := firstField(fields, "ingress_trunk", "orig_trunk", "ingress_trunk_id"); trunk != "" {
+			target.calls[tcdCallKey{trunk, "ingress", result}]++
+		}
+		if trunk := firstField(fields, "egress_trunk", "term_trunk", "egress_trunk_id"); trunk != "" {
+			target.calls[tcdCallKey{trunk, "egress", result}]++
+		}
+	}
+	if last.Equal(target.last) {
+		for id := range seen {
+			target.seen[id] = true
+		}
+	} else {
+		target.last, target.seen = last, seen
+	}
+}
+
+// collect exports the TCD counters of the target.
+func (t *tcdTracker) collect(ch chan<- prometheus.Metric, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target, ok := t.targets[name]
+	if !ok {
+		return
+	}
+	for cause, count := range target.causes {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_tcd_release_cause_total", "Terminated calls by release cause.", []string{"cause"}),
+			prometheus.CounterValue,
+			count, cause)
+	}
+	for key, count := range target.calls {
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_trunk_tcd_calls_total", "Terminated calls by trunk and whether they were answered.", []string{"trunkgroup", "direction", "result"}),
+			prometheus.CounterValue,
+			count, key.trunkgroup, key.direction, key.result)
+	}
+}
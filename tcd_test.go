@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTCDTracker(t *testing.T) {
+	parse := func(dump string) Table {
+		var sansay Sansay
+		if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+			t.Fatal(err)
+		}
+		return sansay.Database.Table[0]
+	}
+	first := parse(`<mysqldump><database name="tcd"><table name="tcd">
+<row><field name="id">1</field><field name="disconnect_time">2020-01-01 00:00:01</field><field name="release_cause">16</field><field name="ingress_trunk">100</field><field name="egress_trunk">200</field><field name="duration">30</field></row>
+<row><field name="id">2</field><field name="disconnect_time">2020-01-01 00:00:02</field><field name="release_cause">34</field><field name="ingress_trunk">100</field><field name="egress_trunk">200</field><field name="duration">0</field></row>
+</table></database></mysqldump>`)
+	// The second download repeats record 2 and adds record 3 from the same second.
+	second := parse(`<mysqldump><database name="tcd"><table name="tcd">
+<row><field name="id">2</field><field name="disconnect_time">2020-01-01 00:00:02</field><field name="release_cause">34</field><field name="ingress_trunk">100</field><field name="egress_trunk">200</field><field name="duration">0</field></row>
+<row><field name="id">3</field><field name="disconnect_time">2020-01-01 00:00:02</field><field name="release_cause">34</field><field name="ingress_trunk">100</field><field name="egress_trunk">300</field><field name="duration">0</field></row>
+</table></database></mysqldump>`)
+
+	tracker := newTCDTracker()
+	tracker.record("sbc", first)
+	tracker.record("sbc", second)
+
+	expected := `
+# TYPE sansay_tcd_release_cause_total counter
+sansay_tcd_release_cause_total{cause="16"} 1
+sansay_tcd_release_cause_total{cause="34"} 2
+# TYPE sansay_trunk_tcd_calls_total counter
+sansay_trunk_tcd_calls_total{direction="egress",result="answered",trunkgroup="200"} 1
+sansay_trunk_tcd_calls_total{direction="egress",result="failed",trunkgroup="200"} 1
+sansay_trunk_tcd_calls_total{direction="egress",result="failed",trunkgroup="300"} 1
+sansay_trunk_tcd_calls_total{direction="ingress",result="answered",trunkgroup="100"} 1
+sansay_trunk_tcd_calls_total{direction="ingress",result="failed",trunkgroup="100"} 2
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.collect(ch, "sbc")
+	}, expected, "sansay_tcd_release_cause_total", "sansay_trunk_tcd_calls_total")
+}
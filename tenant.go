@@ -0,0 +1,124 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Tenant is a customer served a view of only its own trunk groups, e.g. a
+// reseller scraping the exporter with its own Prometheus.
+type Tenant struct {
+	// BearerToken must be sent by scrapes of the tenant's view, which get
+	// the tenant's view whatever the tenant parameter says.
+	BearerToken string `yaml:"bearer_token"`
+}
+
+// Reasons a scrape is refused when tenants are configured.
+var (
+	errTenantUnauthorized = errors.New("a bearer token is required")
+	errTenantForbidden    = errors.New("unknown bearer token")
+)
+
+// RequestTenant returns the tenant whose view the scrape gets, or "" for the
+// full view.  Without tenants every scrape gets the full view.  With tenants,
+// scrapes must send a bearer token: a tenant's token gets that tenant's view,
+// and the admin token the full view, or with the tenant parameter that
+// tenant's view.
+func (c *Config) RequestTenant(r *http.Request) (string, error) {
+	if len(c.Tenants) == 0 {
+		return "", nil
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", errTenantUnauthorized
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	for name, t := range c.Tenants {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.BearerToken)) == 1 {
+			return name, nil
+		}
+	}
+	if c.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.adminToken)) == 1 {
+		name := r.URL.Query().Get("tenant")
+		if _, ok := c.Tenants[name]; name != "" && !ok {
+			return "", fmt.Errorf("unknown tenant %q", name)
+		}
+		return name, nil
+	}
+	return "", errTenantForbidden
+}
+
+// tenantGatherer keeps the series of a tenant's view: those of the trunk
+// groups mapped to the tenant by the target's trunk_customers, and the
+// tenant's own customer totals.  Everything else, including the SBC-wide
+// series, is dropped.
+type tenantGatherer struct {
+	prometheus.Gatherer
+	tenant string
+	trunks map[string]bool
+}
+
+func newTenantGatherer(g prometheus.Gatherer, tenant string, customers map[string]string) tenantGatherer {
+	trunks := map[string]bool{}
+	for trunk, customer := range customers {
+		if customer == tenant {
+			trunks[trunk] = true
+		}
+	}
+	return tenantGatherer{Gatherer: g, tenant: tenant, trunks: trunks}
+}
+
+// Gather implements prometheus.Gatherer.
+func (g tenantGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		var kept []*dto.Metric
+		for _, m := range family.Metric {
+			if g.keep(family.GetName(), m) {
+				kept = append(kept, m)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		family.Metric = kept
+		result = append(result, family)
+	}
+	return result, err
+}
+
+// keep reports whether a series of the named family is part of the tenant's
+// view.  The customer label is only looked at on the customer totals, as
+// metadata labels may add one to every series of the target.
+func (g tenantGatherer) keep(name string, m *dto.Metric) bool {
+	customerTotal := strings.HasPrefix(name, "sansay_customer_")
+	for _, l := range m.Label {
+		switch {
+		case l.GetName() == "trunkgroup":
+			return g.trunks[l.GetValue()]
+		case l.GetName() == "customer" && customerTotal:
+			return l.GetValue() == g.tenant
+		}
+	}
+	return false
+}
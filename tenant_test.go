@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRequestTenant(t *testing.T) {
+	conf := &Config{Tenants: map[string]*Tenant{
+		"acme":   {BearerToken: "acme-token"},
+		"globex": {BearerToken: "globex-token"},
+	}, adminToken: "admin-token"}
+	for _, tt := range []struct {
+		url, token, tenant string
+		wantErr            error
+	}{
+		{url: "/sansay?target=sbc1", wantErr: errTenantUnauthorized},
+		{url: "/sansay?target=sbc1&tenant=acme", wantErr: errTenantUnauthorized},
+		{url: "/sansay?target=sbc1", token: "unknown", wantErr: errTenantForbidden},
+		{url: "/sansay?target=sbc1&tenant=acme", token: "wrong", wantErr: errTenantForbidden},
+		{url: "/sansay?target=sbc1", token: "acme-token", tenant: "acme"},
+		{url: "/sansay?target=sbc1&tenant=acme", token: "acme-token", tenant: "acme"},
+		// A tenant's token never gets another tenant's view.
+		{url: "/sansay?target=sbc1&tenant=globex", token: "acme-token", tenant: "acme"},
+		{url: "/sansay?target=sbc1&tenant=", token: "acme-token", tenant: "acme"},
+		{url: "/sansay?target=sbc1", token: "admin-token", tenant: ""},
+		{url: "/sansay?target=sbc1&tenant=globex", token: "admin-token", tenant: "globex"},
+	} {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		tenant, err := conf.RequestTenant(r)
+		if err != tt.wantErr {
+			t.Errorf("Expected error %v for %s with token %q, received %v", tt.wantErr, tt.url, tt.token, err)
+			continue
+		}
+		if tenant != tt.tenant {
+			t.Errorf("Expected tenant %q for %s with token %q, received %q", tt.tenant, tt.url, tt.token, tenant)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/sansay?target=sbc1&tenant=initech", nil)
+	r.Header.Set("Authorization", "Bearer admin-token")
+	if _, err := conf.RequestTenant(r); err == nil {
+		t.Error("Expected an error for an unknown tenant")
+	}
+	// Without tenants every scrape gets the full view.
+	if tenant, err := (&Config{}).RequestTenant(httptest.NewRequest("GET", "/sansay?target=sbc1&tenant=acme", nil)); tenant != "" || err != nil {
+		t.Errorf("Expected the full view without tenants, received %q, %v", tenant, err)
+	}
+}
+
+func TestTenantGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	// A metadata label adding a customer to every series of the target
+	// mustn't leak them into the view.
+	prometheus.WrapRegistererWith(prometheus.Labels{"customer": "acme"}, registry).MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		trunk := []string{"trunkgroup"}
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_trunk_sessions", "", trunk), prometheus.GaugeValue, 5, "100")
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_trunk_sessions", "", trunk), prometheus.GaugeValue, 7, "200")
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_trunk_sessions", "", trunk), prometheus.GaugeValue, 9, "300")
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_cpu_usage", "", nil), prometheus.GaugeValue, 12)
+	}))
+	registry.MustRegister(metricsFunc(func(ch chan<- prometheus.Metric) {
+		customer := []string{"customer"}
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_customer_sessions_active", "", customer), prometheus.GaugeValue, 12, "acme")
+		ch <- prometheus.MustNewConstMetric(newDesc("sansay_customer_sessions_active", "", customer), prometheus.GaugeValue, 9, "globex")
+	}))
+	g := newTenantGatherer(registry, "acme", map[string]string{"100": "acme", "200": "acme", "300": "globex"})
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, family := range families {
+		got[family.GetName()] = len(family.Metric)
+	}
+	expected := map[string]int{"sansay_trunk_sessions": 2, "sansay_customer_sessions_active": 1}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected families %v, received %v", expected, got)
+	}
+	for name, n := range expected {
+		if got[name] != n {
+			t.Errorf("Expected %d series of %s, received %d", n, name, got[name])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// thresholdRetention is how long the threshold state of a trunk group that
+// is no longer observed is kept.
+const thresholdRetention = time.Hour
+
+// thresholdState is how a trunk group stands against a utilization
+// threshold.
+type thresholdState struct {
+	trunkGroup, node string
+	threshold        float64
+	above            bool
+	// observed is when the trunk group was last observed.
+	observed  time.Time
+	crossings float64
+	seconds   float64
+}
+
+// thresholdTracker counts how often the trunk groups of each target cross
+// utilization thresholds, and for how long they stay above them, across
+// scrapes, for "brownout minutes" style SLO reporting that sampling the
+// utilization gauges would only approximate.
+type thresholdTracker struct {
+	mu      sync.Mutex
+	targets map[string]map[string]*thresholdState
+	// swept is when the states past thresholdRetention were last deleted.
+	swept time.Time
+}
+
+func newThresholdTracker() *thresholdTracker {
+	return &thresholdTracker{targets: map[string]map[string]*thresholdState{}}
+}
+
+// observe records the utilization of a trunk group's Group row at now
+// against each of thresholds.  The time between two observations counts as
+// above a threshold if the trunk group was above it at the first.
+func (t *thresholdTracker) observe(target string, group Trunk, thresholds []float64, now time.Time) {
+	if t == nil || len(thresholds) == 0 {
+		return
+	}
+	limit, err := strconv.ParseFloat(group.TotalLimit, 64)
+	if err != nil || limit <= 0 {
+		return
+	}
+	orig, _ := strconv.ParseFloat(group.NumOrig, 64)
+	term, _ := strconv.ParseFloat(group.NumTerm, 64)
+	utilization := (orig + term) / limit
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.swept) >= thresholdRetention {
+		t.sweep(now)
+	}
+	states, ok := t.targets[target]
+	if !ok {
+		states = map[string]*thresholdState{}
+		t.targets[target] = states
+	}
+	for _, threshold := range thresholds {
+		key := trunkKey(group) + "/" + strconv.FormatFloat(threshold, 'g', -1, 64)
+		state, ok := states[key]
+		if !ok {
+			state = &thresholdState{trunkGroup: group.TrunkId, node: group.Node, threshold: threshold}
+			states[key] = state
+		}
+		if state.above && now.After(state.observed) {
+			state.seconds += now.Sub(state.observed).Seconds()
+		}
+		above := utilization > threshold
+		if above && !state.above && !state.observed.IsZero() {
+			state.crossings++
+		}
+		state.above = above
+		state.observed = now
+	}
+}
+
+// sweep deletes the states of the trunk groups not observed within
+// thresholdRetention of now, and the targets left without any, as trunk
+// groups and targets may be removed.  t.mu must be held.
+func (t *thresholdTracker) sweep(now time.Time) {
+	for target, states := range t.targets {
+		for key, state := range states {
+			if now.Sub(state.observed) > thresholdRetention {
+				delete(states, key)
+			}
+		}
+		if len(states) == 0 {
+			delete(t.targets, target)
+		}
+	}
+	t.swept = now
+}
+
+// collect exports the crossings and time above each threshold of the
+// target's trunk groups.
+func (t *thresholdTracker) collect(ch chan<- prometheus.Metric, target string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.targets[target]))
+	for key := range t.targets[target] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		state := t.targets[target][key]
+		labels := []string{"trunkgroup", "threshold"}
+		labelValues := []string{state.trunkGroup, strconv.FormatFloat(state.threshold, 'g', -1, 64)}
+		if state.node != "" {
+			labels = append(labels, "node")
+			labelValues = append(labelValues, state.node)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_trunk_utilization_crossings_total", "Times a trunk group's share of its session limit in use rose above the threshold.", labels),
+			prometheus.CounterValue, state.crossings, labelValues...)
+		ch <- prometheus.MustNewConstMetric(
+			newDesc("sansay_trunk_utilization_above_seconds_total", "Time a trunk group's share of its session limit in use was above the threshold.", labels),
+			prometheus.CounterValue, state.seconds, labelValues...)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestThresholdTracker(t *testing.T) {
+	tracker := newThresholdTracker()
+	start := time.Unix(1000, 0)
+	thresholds := []float64{0.5, 0.9}
+	for i, sessions := range []string{"40", "60", "95", "70", "20", "55"} {
+		group := Trunk{TrunkId: "100", NumOrig: sessions, NumTerm: "0", TotalLimit: "100"}
+		tracker.observe("sbc1", group, thresholds, start.Add(time.Duration(i)*time.Minute))
+	}
+	// Without a session limit there is no utilization.
+	tracker.observe("sbc1", Trunk{TrunkId: "200", NumOrig: "5", TotalLimit: "0"}, thresholds, start)
+
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.collect(ch, "sbc1")
+	}, `
+# TYPE sansay_trunk_utilization_above_seconds_total counter
+sansay_trunk_utilization_above_seconds_total{threshold="0.5",trunkgroup="100"} 180
+sansay_trunk_utilization_above_seconds_total{threshold="0.9",trunkgroup="100"} 60
+# TYPE sansay_trunk_utilization_crossings_total counter
+sansay_trunk_utilization_crossings_total{threshold="0.5",trunkgroup="100"} 2
+sansay_trunk_utilization_crossings_total{threshold="0.9",trunkgroup="100"} 1
+`, "sansay_trunk_utilization_above_seconds_total", "sansay_trunk_utilization_crossings_total")
+}
+
+func TestThresholdTrackerRetention(t *testing.T) {
+	tracker := newThresholdTracker()
+	start := time.Unix(1000, 0)
+	thresholds := []float64{0.5}
+	tracker.observe("sbc1", Trunk{TrunkId: "100", NumOrig: "60", TotalLimit: "100"}, thresholds, start)
+	tracker.observe("sbc2", Trunk{TrunkId: "100", NumOrig: "60", TotalLimit: "100"}, thresholds, start)
+	tracker.observe("sbc1", Trunk{TrunkId: "200", NumOrig: "60", TotalLimit: "100"}, thresholds, start.Add(2*thresholdRetention))
+
+	if _, ok := tracker.targets["sbc2"]; ok {
+		t.Error("Expected the target no longer observed to be deleted")
+	}
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.collect(ch, "sbc1")
+	}, `
+# TYPE sansay_trunk_utilization_crossings_total counter
+sansay_trunk_utilization_crossings_total{threshold="0.5",trunkgroup="200"} 0
+`, "sansay_trunk_utilization_crossings_total")
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter paces reads to a number of bytes per second.  It is shared by
+// the downloads from a target, whichever scrape, module or poll makes them,
+// so together they stay within the rate.
+type rateLimiter struct {
+	rate float64
+
+	mu sync.Mutex
+	// next is when the bytes read so far are paid for.
+	next time.Time
+
+	sleep func(context.Context, time.Duration) error
+	now   func() time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{rate: float64(bytesPerSecond), sleep: sleepContext, now: time.Now}
+}
+
+// sleepContext sleeps for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiters holds the rate limiter of each target.
+type rateLimiters struct {
+	mu      sync.Mutex
+	targets map[string]*rateLimiter
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{targets: map[string]*rateLimiter{}}
+}
+
+// limiter returns the rate limiter of the target, allowing bytesPerSecond.
+// The rate of the first call for a target is kept.
+func (l *rateLimiters) limiter(target string, bytesPerSecond int64) *rateLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.targets[target]
+	if !ok {
+		limiter = newRateLimiter(bytesPerSecond)
+		l.targets[target] = limiter
+	}
+	return limiter
+}
+
+// chunk is the most a single read may return, a tenth of a second's worth,
+// so that the pacing stays smooth and the deadline is noticed promptly.
+func (l *rateLimiter) chunk() int {
+	if n := int(l.rate / 10); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// wait blocks until n more bytes may be read, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+	return l.sleep(ctx, delay)
+}
+
+// throttledBody reads a response body no faster than its limiter allows,
+// until the request's context is done.
+type throttledBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if chunk := b.limiter.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.limiter.wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttleRoundTripper limits the rate response bodies are downloaded at.
+type throttleRoundTripper struct {
+	limiter *rateLimiter
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *throttleRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &throttledBody{ReadCloser: resp.Body, ctx: req.Context(), limiter: rt.limiter}
+	return resp, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledBody(t *testing.T) {
+	// The clock doesn't move, so each wait is until all the bytes read so
+	// far are paid for.
+	var slept time.Duration
+	limiter := newRateLimiter(100)
+	limiter.now = func() time.Time { return time.Unix(0, 0) }
+	limiter.sleep = func(_ context.Context, d time.Duration) error {
+		slept = d
+		return nil
+	}
+
+	body := &throttledBody{ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 1000))), ctx: context.Background(), limiter: limiter}
+	buf := make([]byte, 512)
+	n, err := body.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("Expected reads of a tenth of a second's worth, received %d bytes", n)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 990 {
+		t.Errorf("Expected the whole body, received %d bytes", len(data))
+	}
+	if slept != 10*time.Second {
+		t.Errorf("Expected to be paced to 10s, slept until %s", slept)
+	}
+}
+
+func TestThrottledBodyDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	body := &throttledBody{ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 1000))), ctx: ctx, limiter: newRateLimiter(100)}
+	start := time.Now()
+	_, err := ioutil.ReadAll(body)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to stop the download, received %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the wait to end at the deadline, took %s", elapsed)
+	}
+}
+
+func TestRateLimitersPerTarget(t *testing.T) {
+	limiters := newRateLimiters()
+	if limiters.limiter("sbc1", 100) != limiters.limiter("sbc1", 100) {
+		t.Error("Expected the scrapes of a target to share its limiter")
+	}
+	if limiters.limiter("sbc1", 100) == limiters.limiter("sbc2", 100) {
+		t.Error("Expected each target to have its own limiter")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+)
+
+// otherTrunk is the trunk group ID and alias the trunk groups outside the
+// top N are aggregated into.
+const otherTrunk = "other"
+
+// realtimeGroup is a Group row of the realtime trunk table.
+type realtimeGroup struct {
+	trunk  Trunk
+	fields map[string]string
+}
+
+// trunkRank returns the value trunk groups are ranked by, their sessions or
+// their calls per second.
+func trunkRank(trunk Trunk, by string) float64 {
+	if by == "cps" {
+		cps, _ := strconv.ParseFloat(trunk.Cps, 64)
+		return cps
+	}
+	orig, _ := strconv.ParseFloat(trunk.NumOrig, 64)
+	term, _ := strconv.ParseFloat(trunk.NumTerm, 64)
+	return orig + term
+}
+
+// topTrunks splits the Group rows into the n busiest by sessions or cps,
+// and the rest aggregated per node into an "other" trunk group.  All rows
+// are top if n is 0.
+func topTrunks(groups []realtimeGroup, n int, by string) ([]realtimeGroup, []Trunk) {
+	if n <= 0 || len(groups) <= n {
+		return groups, nil
+	}
+	sorted := append([]realtimeGroup{}, groups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := trunkRank(sorted[i].trunk, by), trunkRank(sorted[j].trunk, by)
+		if ri != rj {
+			return ri > rj
+		}
+		return sorted[i].trunk.TrunkId < sorted[j].trunk.TrunkId
+	})
+
+	sums := map[string]map[string]float64{}
+	var nodes []string
+	for _, group := range sorted[n:] {
+		node := group.trunk.Node
+		if _, ok := sums[node]; !ok {
+			sums[node] = map[string]float64{}
+			nodes = append(nodes, node)
+		}
+		for _, metric := range realtimeMetrics {
+			value, err := getField(&group.trunk, metric)
+			if err != nil {
+				continue
+			}
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				sums[node][metric] += v
+			}
+		}
+	}
+	sort.Strings(nodes)
+	others := make([]Trunk, 0, len(nodes))
+	for _, node := range nodes {
+		other := Trunk{TrunkId: otherTrunk, Alias: otherTrunk, Node: node}
+		for _, metric := range realtimeMetrics {
+			setField(&other, metric, strconv.FormatFloat(sums[node][metric], 'g', -1, 64))
+		}
+		others = append(others, other)
+	}
+	return sorted[:n], others
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTopTrunks(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">a</field><field name="fqdn">Group</field><field name="numOrig">1</field><field name="numTerm">1</field><field name="cps">9</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">10</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">200</field><field name="alias">b</field><field name="fqdn">Group</field><field name="numOrig">20</field><field name="numTerm">5</field><field name="cps">1</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">50</field><field name="cpsLimit">0</field></row>
+<row><field name="trunkId">300</field><field name="alias">c</field><field name="fqdn">Group</field><field name="numOrig">3</field><field name="numTerm">0</field><field name="cps">0.5</field><field name="numPeak">0</field><field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">20</field><field name="cpsLimit">0</field></row>
+</table>
+</database></mysqldump>`
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		by       string
+		expected string
+	}{
+		{
+			name: "Test that the busiest trunk groups by sessions are kept",
+			expected: `
+# TYPE sansay_trunk_groups_aggregated gauge
+sansay_trunk_groups_aggregated 2
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="b",trunkgroup="200"} 20
+sansay_trunk_numorig{alias="other",trunkgroup="other"} 4
+# TYPE sansay_trunk_totallimit gauge
+sansay_trunk_totallimit{alias="b",trunkgroup="200"} 50
+sansay_trunk_totallimit{alias="other",trunkgroup="other"} 30
+`,
+		},
+		{
+			name: "Test that the busiest trunk groups by cps are kept",
+			by:   "cps",
+			expected: `
+# TYPE sansay_trunk_groups_aggregated gauge
+sansay_trunk_groups_aggregated 2
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="a",trunkgroup="100"} 1
+sansay_trunk_numorig{alias="other",trunkgroup="other"} 23
+# TYPE sansay_trunk_totallimit gauge
+sansay_trunk_totallimit{alias="a",trunkgroup="100"} 10
+sansay_trunk_totallimit{alias="other",trunkgroup="other"} 70
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := collector{logger: log.NewNopLogger(), topTrunks: 1, topTrunksBy: tt.by}
+			compareMetrics(t, func(ch chan<- prometheus.Metric) {
+				c.processCollection(ch, sansay)
+			}, tt.expected, "sansay_trunk_groups_aggregated", "sansay_trunk_numorig", "sansay_trunk_totallimit")
+		})
+	}
+}
+
+func TestTopTrunksAll(t *testing.T) {
+	groups := []realtimeGroup{{trunk: Trunk{TrunkId: "100"}}, {trunk: Trunk{TrunkId: "200"}}}
+	if top, others := topTrunks(groups, 2, ""); len(top) != 2 || others != nil {
+		t.Errorf("Expected every trunk group within the limit, received %d and %d aggregated", len(top), len(others))
+	}
+	if top, others := topTrunks(groups, 0, ""); len(top) != 2 || others != nil {
+		t.Errorf("Expected every trunk group without a limit, received %d and %d aggregated", len(top), len(others))
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// traceID returns the trace ID of the scrape request's trace context, taken
+// from a W3C traceparent, B3 or Jaeger header, or "" if it has none.
+func traceID(r *http.Request) string {
+	if parts := strings.Split(r.Header.Get("traceparent"), "-"); len(parts) == 4 {
+		return validTraceID(parts[1])
+	}
+	if id := r.Header.Get("X-B3-TraceId"); id != "" {
+		return validTraceID(id)
+	}
+	if parts := strings.Split(r.Header.Get("uber-trace-id"), ":"); len(parts) == 4 {
+		return validTraceID(parts[0])
+	}
+	return ""
+}
+
+// validTraceID returns id if it is a 64 or 128 bit hex trace ID that isn't
+// all zeros, and "" otherwise.
+func validTraceID(id string) string {
+	if len(id) != 16 && len(id) != 32 {
+		return ""
+	}
+	if strings.Trim(id, "0") == "" {
+		return ""
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return ""
+		}
+	}
+	return strings.ToLower(id)
+}
+
+// exemplarLabels returns the exemplar labels linking a sample to the scrape
+// request's trace, or nil if exemplars are disabled or it isn't traced.
+func exemplarLabels(r *http.Request) prometheus.Labels {
+	if !*enableExemplars {
+		return nil
+	}
+	id := traceID(r)
+	if id == "" {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": id}
+}
+
+// requestError counts a failed scrape request.
+func requestError(r *http.Request) {
+	if labels := exemplarLabels(r); labels != nil {
+		sansayRequestErrors.(prometheus.ExemplarAdder).AddWithExemplar(1, labels)
+		return
+	}
+	sansayRequestErrors.Inc()
+}
+
+// observeDuration records how long a scrape request took.
+func observeDuration(r *http.Request, seconds float64) {
+	sansayDuration.Observe(seconds)
+	if labels := exemplarLabels(r); labels != nil {
+		sansayDurationHistogram.(prometheus.ExemplarObserver).ObserveWithExemplar(seconds, labels)
+		return
+	}
+	sansayDurationHistogram.Observe(seconds)
+}
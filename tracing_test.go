@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"Test that W3C trace contexts are read", "traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"Test that B3 trace IDs are read", "X-B3-TraceId", "a3ce929d0e0e4736", "a3ce929d0e0e4736"},
+		{"Test that Jaeger trace IDs are read", "uber-trace-id", "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"Test that all-zero trace IDs are ignored", "traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"Test that malformed trace IDs are ignored", "X-B3-TraceId", "not-a-trace-id!!", ""},
+		{"Test that untraced requests have no trace ID", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/sansay?target=sbc1", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			if got := traceID(r); got != tt.want {
+				t.Errorf("Expected trace ID %q, received %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRequestErrorExemplar(t *testing.T) {
+	defer func(enabled bool) { *enableExemplars = enabled }(*enableExemplars)
+	*enableExemplars = true
+
+	r := httptest.NewRequest("GET", "/sansay", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	requestError(r)
+	observeDuration(r, 0.2)
+
+	var m dto.Metric
+	if err := sansayRequestErrors.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := exemplarTraceID(m.GetCounter().GetExemplar()); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the error counter's exemplar to link the trace, received %q", got)
+	}
+
+	m.Reset()
+	if err := sansayDurationHistogram.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	var linked bool
+	for _, b := range m.GetHistogram().GetBucket() {
+		if exemplarTraceID(b.GetExemplar()) == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			linked = true
+		}
+	}
+	if !linked {
+		t.Error("Expected a duration bucket's exemplar to link the trace")
+	}
+}
+
+func exemplarTraceID(e *dto.Exemplar) string {
+	for _, l := range e.GetLabel() {
+		if l.GetName() == "trace_id" {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
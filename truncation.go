@@ -0,0 +1,68 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/xml"
+)
+
+// salvageDump returns the tables of a truncated stats dump that were received
+// in full, and false if there are none.  A table cut short is dropped rather
+// than exported with only some of its rows, which would read as e.g. trunk
+// groups going idle.  A CPU-starved SBC regularly cuts its dumps short, and
+// most tables are then still worth exporting.
+func salvageDump(body []byte) (Sansay, bool) {
+	body, _ = escapeAmpersands(body)
+	d := newDecoder(body)
+	var sansay Sansay
+	root := true
+	for {
+		token, err := d.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch {
+		case root:
+			if start.Name.Local != "mysqldump" {
+				return Sansay{}, false
+			}
+			sansay.Timestamp = attr(start, "timestamp")
+			root = false
+		case start.Name.Local == "database":
+			sansay.Database.Name = attr(start, "name")
+			sansay.Database.Timestamp = attr(start, "timestamp")
+		case start.Name.Local == "table":
+			var table Table
+			if err := d.DecodeElement(&table, &start); err != nil {
+				return sansay, len(sansay.Database.Table) > 0
+			}
+			sansay.Database.Table = append(sansay.Database.Table, table)
+		}
+	}
+	return sansay, len(sansay.Database.Table) > 0
+}
+
+// attr returns the value of the element's attribute, "" if it has none.
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseSansayTruncated(t *testing.T) {
+	body := []byte(`<mysqldump timestamp="1"><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table><table name="XBResourceRealTimeStatList"><row><field name="trunkId">1</field></row><row><field name="trun`)
+	obj, err := parseSansay("stats/realtime", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sansay := obj.(Sansay)
+	if !sansay.Partial {
+		t.Error("Expected the dump to be marked partial")
+	}
+	if len(sansay.Database.Table) != 1 || sansay.Database.Table[0].Name != "system_stat" {
+		t.Errorf("Expected only the complete system_stat table, received %+v", sansay.Database.Table)
+	}
+	if sansay.Timestamp != "1" || sansay.Database.Name != "stats" || sansay.Path != "stats/realtime" {
+		t.Errorf("Expected the dump's attributes and path, received %+v", sansay)
+	}
+
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		collector{}.collectParseStats(ch, sansay)
+	}, `
+# TYPE sansay_parse_partial gauge
+sansay_parse_partial{path="stats/realtime"} 1
+`, "sansay_parse_partial")
+}
+
+func TestParseSansayTruncatedNothing(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "Test that a dump cut in its first table fails",
+			body: `<mysqldump><database name="stats"><table name="system_stat"><row>`,
+		},
+		{
+			name: "Test that other truncated documents fail",
+			body: `<html><table name="system_stat"></table>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSansay("stats/realtime", []byte(tt.body)); !errors.Is(err, errTruncatedBody) {
+				t.Errorf("Expected a truncated body error, received %v", err)
+			}
+		})
+	}
+}
+
+func TestScrapeTargetTruncatedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(`<mysqldump><database name="stats"><table name="system_stat"><row><field name="cpu_idle">90</field></row></table><table name="XBResourceRealTimeStatList">`))
+	}))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+
+	c, err := newCollector(target, &Target{Protocol: "http"}, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.paths = []string{"stats/realtime"}
+	compareMetrics(t, c.Collect, `
+# TYPE sansay_cpu_idle gauge
+sansay_cpu_idle 90
+# TYPE sansay_parse_partial gauge
+sansay_parse_partial{path="stats/realtime"} 1
+`, "sansay_cpu_idle", "sansay_parse_partial")
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// zeroFillMetrics are the realtime trunk metrics exported as zero for trunk
+// groups missing from a dump.
+var zeroFillMetrics = []string{"NumOrig", "NumTerm", "Cps"}
+
+// trunkTracker remembers the trunk groups each target reported, so trunk
+// groups that disappear from the realtime stats, as idle trunk groups do on
+// some firmware, show as zero sessions rather than as absent series.
+type trunkTracker struct {
+	mu      sync.Mutex
+	targets map[string]map[string]*trunkEntry
+	// changed is whether the trunk groups changed since they were last
+	// saved.
+	changed bool
+}
+
+type trunkEntry struct {
+	trunk    Trunk
+	lastSeen time.Time
+}
+
+func newTrunkTracker() *trunkTracker {
+	return &trunkTracker{targets: map[string]map[string]*trunkEntry{}}
+}
+
+// trunkKey identifies a trunk group of a target, on its cluster node.
+func trunkKey(trunk Trunk) string {
+	return trunk.TrunkId + "/" + trunk.Node
+}
+
+// len returns the number of trunk groups remembered across the targets.
+func (t *trunkTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, known := range t.targets {
+		n += len(known)
+	}
+	return n
+}
+
+// fill records the Group rows of the target's realtime stats, and exports
+// zeros for the provisioned trunk groups and those seen within retention
+// that are missing from them.  The skipped Group rows, whose impossible
+// values weren't exported, are present all the same and aren't filled.
+func (t *trunkTracker) fill(ch chan<- prometheus.Metric, target string, groups, skipped []Trunk, provisioned []string, retention time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	known, ok := t.targets[target]
+	if !ok {
+		known = map[string]*trunkEntry{}
+		t.targets[target] = known
+	}
+	present := map[string]bool{}
+	for _, trunk := range groups {
+		key := trunkKey(trunk)
+		present[key] = true
+		known[key] = &trunkEntry{trunk: trunk, lastSeen: now}
+	}
+	for _, trunk := range skipped {
+		key := trunkKey(trunk)
+		present[key] = true
+		known[key] = &trunkEntry{trunk: Trunk{TrunkId: trunk.TrunkId, Alias: trunk.Alias, Node: trunk.Node, Type: trunk.Type}, lastSeen: now}
+	}
+	t.changed = true
+
+	missing := map[string]Trunk{}
+	for key, entry := range known {
+		if present[key] {
+			continue
+		}
+		if now.Sub(entry.lastSeen) > retention {
+			delete(known, key)
+			continue
+		}
+		missing[key] = entry.trunk
+	}
+	for _, id := range provisioned {
+		reported := false
+		for _, entry := range known {
+			if entry.trunk.TrunkId == id {
+				reported = true
+				break
+			}
+		}
+		if !reported {
+			missing[id] = Trunk{TrunkId: id}
+		}
+	}
+
+	for _, trunk := range missing {
+		zero := Trunk{TrunkId: trunk.TrunkId, Alias: trunk.Alias, Node: trunk.Node, Type: trunk.Type}
+		for _, metric := range zeroFillMetrics {
+			setField(&zero, metric, "0")
+		}
+		if err := addTrunkMetrics(ch, zero, zeroFillMetrics); err != nil {
+			ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTrunkTrackerFill(t *testing.T) {
+	tracker := newTrunkTracker()
+	now := time.Now()
+	fill := func(groups []Trunk, at time.Time, expected string) {
+		t.Helper()
+		compareMetrics(t, func(ch chan<- prometheus.Metric) {
+			tracker.fill(ch, "sbc1", groups, nil, []string{"300"}, time.Hour, at)
+		}, expected, "sansay_trunk_numorig")
+	}
+
+	fill([]Trunk{{TrunkId: "100", Alias: "carrier"}, {TrunkId: "200", Alias: "customer"}}, now, `
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="",trunkgroup="300"} 0
+`)
+	// The customer trunk group disappears from the realtime stats.
+	fill([]Trunk{{TrunkId: "100", Alias: "carrier"}}, now.Add(time.Minute), `
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="",trunkgroup="300"} 0
+sansay_trunk_numorig{alias="customer",trunkgroup="200"} 0
+`)
+	// Past the retention only the provisioned trunk group is filled.
+	fill([]Trunk{{TrunkId: "100", Alias: "carrier"}}, now.Add(2*time.Hour), `
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="",trunkgroup="300"} 0
+`)
+}
+
+func TestTrunkTrackerFillSkipped(t *testing.T) {
+	tracker := newTrunkTracker()
+	now := time.Now()
+	tracker.fill(make(chan prometheus.Metric, 10), "sbc1", []Trunk{{TrunkId: "100"}, {TrunkId: "200"}}, nil, nil, time.Hour, now)
+
+	// Trunk groups skipped for impossible values are in the realtime stats,
+	// so neither they nor a provisioned one are filled.
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.fill(ch, "sbc1", []Trunk{{TrunkId: "100"}}, []Trunk{{TrunkId: "200"}, {TrunkId: "300"}}, []string{"300", "400"}, time.Hour, now.Add(time.Minute))
+	}, `
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="",trunkgroup="400"} 0
+`, "sansay_trunk_numorig")
+}
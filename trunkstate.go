@@ -0,0 +1,115 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"gopkg.in/yaml.v2"
+)
+
+// trunkStateInterval is how often a changed trunk inventory is saved.
+const trunkStateInterval = time.Minute
+
+// trunkState is a trunk group of the saved trunk inventory.
+type trunkState struct {
+	TrunkGroup string    `yaml:"trunkgroup"`
+	Alias      string    `yaml:"alias,omitempty"`
+	Node       string    `yaml:"node,omitempty"`
+	Type       string    `yaml:"type,omitempty"`
+	LastSeen   time.Time `yaml:"last_seen"`
+}
+
+// load restores the trunk groups of each target saved in filename, if it
+// exists, so zero-filling knows the expected trunk groups right after a
+// restart.
+func (t *trunkTracker) load(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved := map[string][]trunkState{}
+	if err := yaml.UnmarshalStrict(content, &saved); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for target, trunks := range saved {
+		known := map[string]*trunkEntry{}
+		for _, s := range trunks {
+			trunk := Trunk{TrunkId: s.TrunkGroup, Alias: s.Alias, Node: s.Node, Type: s.Type}
+			known[trunkKey(trunk)] = &trunkEntry{trunk: trunk, lastSeen: s.LastSeen}
+		}
+		t.targets[target] = known
+	}
+	return nil
+}
+
+// save writes the trunk groups of each target to filename.
+func (t *trunkTracker) save(filename string) error {
+	t.mu.Lock()
+	saved := map[string][]trunkState{}
+	for target, known := range t.targets {
+		trunks := make([]trunkState, 0, len(known))
+		for _, entry := range known {
+			trunks = append(trunks, trunkState{
+				TrunkGroup: entry.trunk.TrunkId,
+				Alias:      entry.trunk.Alias,
+				Node:       entry.trunk.Node,
+				Type:       entry.trunk.Type,
+				LastSeen:   entry.lastSeen,
+			})
+		}
+		sort.Slice(trunks, func(i, j int) bool {
+			if trunks[i].TrunkGroup != trunks[j].TrunkGroup {
+				return trunks[i].TrunkGroup < trunks[j].TrunkGroup
+			}
+			return trunks[i].Node < trunks[j].Node
+		})
+		saved[target] = trunks
+	}
+	t.mu.Unlock()
+	content, err := yaml.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, content, 0644)
+}
+
+// run saves the trunk inventory to filename every interval it changed.
+func (t *trunkTracker) run(filename string, interval time.Duration, logger log.Logger) {
+	for range time.Tick(interval) {
+		t.mu.Lock()
+		changed := t.changed
+		t.changed = false
+		t.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := t.save(filename); err != nil {
+			level.Error(logger).Log("msg", "Error saving trunk inventory", "file", filename, "err", err)
+			t.mu.Lock()
+			t.changed = true
+			t.mu.Unlock()
+		}
+	}
+}
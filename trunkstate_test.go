@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTrunkTrackerSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sansay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "trunks.yml")
+
+	now := time.Now()
+	tracker := newTrunkTracker()
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		tracker.fill(ch, "sbc1", []Trunk{{TrunkId: "100", Alias: "carrier", Node: "1"}, {TrunkId: "200", Alias: "customer"}}, nil, nil, time.Hour, now)
+	}, "", "sansay_trunk_numorig")
+	if err := tracker.save(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted exporter zero-fills the saved trunk groups missing from
+	// its first scrape.
+	restarted := newTrunkTracker()
+	if err := restarted.load(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		restarted.fill(ch, "sbc1", []Trunk{{TrunkId: "200", Alias: "customer"}}, nil, nil, time.Hour, now.Add(time.Minute))
+	}, `
+# TYPE sansay_trunk_numorig gauge
+sansay_trunk_numorig{alias="carrier",node="1",trunkgroup="100"} 0
+`, "sansay_trunk_numorig")
+}
+
+func TestTrunkTrackerLoadMissing(t *testing.T) {
+	if err := newTrunkTracker().load(filepath.Join(os.TempDir(), "missing-sansay-trunks.yml")); err != nil {
+		t.Errorf("Expected no error for a missing state file, received %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// unit is a device unit and how to convert it to a Prometheus base unit.
+type unit struct {
+	scale float64
+	// suffix is the base unit's metric name suffix.
+	suffix string
+	// deviceSuffixes are stripped from field names before adding suffix.
+	deviceSuffixes []string
+}
+
+// units are the device units a field can be normalized from.
+var units = map[string]unit{
+	"milliseconds": {0.001, "_seconds", []string{"_ms", "_msec", "_millis"}},
+	"seconds":      {1, "_seconds", []string{"_sec", "_secs", "_s"}},
+	"bytes":        {1, "_bytes", []string{"_b"}},
+	"kilobytes":    {1024, "_bytes", []string{"_kb", "_kbytes"}},
+	"megabytes":    {1024 * 1024, "_bytes", []string{"_mb", "_mbytes"}},
+	"percent":      {0.01, "_ratio", []string{"_pct", "_percent", "_perc"}},
+}
+
+// normalizeUnit converts the value of a field reported in the named unit to
+// the base unit, returning the field name with the base unit's suffix.
+func normalizeUnit(field, value, name string) (string, string) {
+	u, ok := units[name]
+	if !ok {
+		return field, value
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return field, value
+	}
+	for _, suffix := range u.deviceSuffixes {
+		if strings.HasSuffix(field, suffix) {
+			field = strings.TrimSuffix(field, suffix)
+			break
+		}
+	}
+	if !strings.HasSuffix(field, u.suffix) {
+		field += u.suffix
+	}
+	return field, strconv.FormatFloat(v*u.scale, 'g', -1, 64)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNormalizeUnit(t *testing.T) {
+	tests := []struct {
+		field, value, unit string
+		wantField          string
+		wantValue          string
+	}{
+		{"response_time_ms", "250", "milliseconds", "response_time_seconds", "0.25"},
+		{"uptime", "3600", "seconds", "uptime_seconds", "3600"},
+		{"mem_free_kb", "2048", "kilobytes", "mem_free_bytes", "2.097152e+06"},
+		{"mem_used_pct", "42", "percent", "mem_used_ratio", "0.42"},
+		{"disk_used_bytes", "10", "bytes", "disk_used_bytes", "10"},
+		{"cpu_idle", "90", "", "cpu_idle", "90"},
+		{"mem_used_pct", "n/a", "percent", "mem_used_pct", "n/a"},
+	}
+	for _, tt := range tests {
+		field, value := normalizeUnit(tt.field, tt.value, tt.unit)
+		if field != tt.wantField || value != tt.wantValue {
+			t.Errorf("Expected %s %s for %s %s in %q, received %s %s", tt.wantField, tt.wantValue, tt.field, tt.value, tt.unit, field, value)
+		}
+	}
+}
+
+func TestSystemStatUnits(t *testing.T) {
+	dump := `<mysqldump><database name="stats">
+<table name="system_stat">
+<row><field name="cpu_idle">90</field><field name="mem_used_pct">42</field></row>
+</table>
+</database></mysqldump>`
+	var sansay Sansay
+	if err := xml.Unmarshal([]byte(dump), &sansay); err != nil {
+		t.Fatal(err)
+	}
+	c := collector{logger: log.NewNopLogger(), units: map[string]string{"mem_used_pct": "percent"}}
+	expected := `
+# TYPE sansay_cpu_idle gauge
+sansay_cpu_idle 90
+# TYPE sansay_mem_used_ratio gauge
+sansay_mem_used_ratio 0.42
+`
+	compareMetrics(t, func(ch chan<- prometheus.Metric) {
+		c.processCollection(ch, sansay)
+	}, expected, "sansay_cpu_idle", "sansay_mem_used_pct", "sansay_mem_used_ratio")
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlError is an error in a downloaded document, located by line and column
+// (in bytes, both counted from 1) and by the path of the element it is in,
+// e.g. /mysqldump/database[1]/table[3]/row[12], so it can be looked up in
+// the dump.
+type xmlError struct {
+	Line   int
+	Column int
+	Path   string
+	Err    error
+}
+
+func (e *xmlError) Error() string {
+	msg := e.Err.Error()
+	var syntaxErr *xml.SyntaxError
+	if errors.As(e.Err, &syntaxErr) {
+		// The syntax error's own line is superseded by ours.
+		msg = "XML syntax error: " + syntaxErr.Msg
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, msg)
+	}
+	return fmt.Sprintf("line %d, column %d, in %s: %s", e.Line, e.Column, e.Path, msg)
+}
+
+func (e *xmlError) Unwrap() error {
+	return e.Err
+}
+
+// xmlPath tracks the path of the element a decoder is in.  Elements below
+// the root are numbered among their siblings of the same name, from 1.
+type xmlPath struct {
+	segments []string
+	children []map[string]int
+}
+
+func (p *xmlPath) push(name string) {
+	segment := name
+	if n := len(p.children); n > 0 {
+		p.children[n-1][name]++
+		segment = fmt.Sprintf("%s[%d]", name, p.children[n-1][name])
+	}
+	p.segments = append(p.segments, segment)
+	p.children = append(p.children, map[string]int{})
+}
+
+func (p *xmlPath) pop() {
+	if n := len(p.segments); n > 0 {
+		p.segments = p.segments[:n-1]
+		p.children = p.children[:n-1]
+	}
+}
+
+func (p *xmlPath) String() string {
+	if len(p.segments) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(p.segments, "/")
+}
+
+// locateXMLError returns err, an error unmarshalling body, located in body.
+// Syntax errors are located where the decoder stopped, other errors such as
+// an unexpected root element at the root element.
+func locateXMLError(body []byte, err error) error {
+	d := newDecoder(body)
+	var path xmlPath
+	var root *xmlError
+	for {
+		offset := d.InputOffset()
+		token, tokenErr := d.Token()
+		if tokenErr == io.EOF {
+			break
+		}
+		if tokenErr != nil {
+			line, column := position(body, d.InputOffset())
+			return &xmlError{Line: line, Column: column, Path: path.String(), Err: tokenErr}
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path.push(t.Name.Local)
+			if root == nil {
+				line, column := position(body, offset)
+				root = &xmlError{Line: line, Column: column, Path: path.String(), Err: err}
+			}
+		case xml.EndElement:
+			path.pop()
+		}
+	}
+	if root == nil {
+		return &xmlError{Line: 1, Column: 1, Err: err}
+	}
+	return root
+}
+
+// locateElement returns err located at the start of the element at path in
+// body, or err itself if there is no such element.
+func locateElement(body []byte, path string, err error) error {
+	d := newDecoder(body)
+	var p xmlPath
+	for {
+		offset := d.InputOffset()
+		token, tokenErr := d.Token()
+		if tokenErr != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			p.push(t.Name.Local)
+			if p.String() == path {
+				line, column := position(body, offset)
+				return &xmlError{Line: line, Column: column, Path: path, Err: err}
+			}
+		case xml.EndElement:
+			p.pop()
+		}
+	}
+}
+
+// position returns the line and column of offset in body.
+func position(body []byte, offset int64) (int, int) {
+	if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+	before := body[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// validateDump checks the structure of an unmarshalled stats dump the
+// processing relies on: every table and every field must be named.
+func validateDump(body []byte, sansay Sansay) error {
+	for i, table := range sansay.Database.Table {
+		tablePath := fmt.Sprintf("/mysqldump/database[1]/table[%d]", i+1)
+		if table.Name == "" {
+			return locateElement(body, tablePath, errors.New("table without a name"))
+		}
+		for j, row := range table.Row {
+			for k, field := range row.Field {
+				if field.Name == "" {
+					path := fmt.Sprintf("%s/row[%d]/field[%d]", tablePath, j+1, k+1)
+					return locateElement(body, path, fmt.Errorf("field without a name in table %q", table.Name))
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseSansayLocatesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "Test that a syntax error is located by line, column and element",
+			body: "<mysqldump>\n<database name=\"stats\">\n<table name=\"system_stat\">\n<row><field name=\"cpu_idle\">90</fiel></row>",
+			want: `line 4, column 38, in /mysqldump/database[1]/table[1]/row[1]/field[1]: XML syntax error: element <field> closed by </fiel>`,
+		},
+		{
+			name: "Test that an unexpected root element is located",
+			body: "<?xml version=\"1.0\"?>\n  <error>Login required</error>",
+			want: `line 2, column 3, in /error: expected element type <mysqldump> but have <error>`,
+		},
+		{
+			name: "Test that a field without a name is located",
+			body: "<mysqldump><database><table name=\"system_stat\"><row><field name=\"a\">1</field></row>\n<row><field>2</field></row></table></database></mysqldump>",
+			want: `line 2, column 6, in /mysqldump/database[1]/table[1]/row[2]/field[1]: field without a name in table "system_stat"`,
+		},
+		{
+			name: "Test that a table without a name is located",
+			body: "<mysqldump><database><table name=\"a\"/><table/></database></mysqldump>",
+			want: `line 1, column 39, in /mysqldump/database[1]/table[2]: table without a name`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSansay("stats/realtime", []byte(tt.body))
+			if err == nil {
+				t.Fatal("Expected an error, received none")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Expected error %q, received %q", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseSansayTruncatedLocated(t *testing.T) {
+	_, err := parseSansay("stats/realtime", []byte("<mysqldump>\n<database name=\"stats\">"))
+	if !errors.Is(err, errTruncatedBody) {
+		t.Errorf("Expected a truncated body error, received %v", err)
+	}
+	if !strings.Contains(err.Error(), "line 2, column 24, in /mysqldump/database[1]") {
+		t.Errorf("Expected the error located in /mysqldump/database[1], received %v", err)
+	}
+}
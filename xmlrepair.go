@@ -0,0 +1,89 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"regexp"
+)
+
+// xmlReference matches the entity and character references the decoder
+// knows of, there being no DTD declaring others.
+var xmlReference = regexp.MustCompile(`^&(?:lt|gt|amp|apos|quot|#[0-9]+|#x[0-9A-Fa-f]+);`)
+
+// unmarshalDump unmarshals body, in any encoding newDecoder reads, into v,
+// which must be a pointer.  The VSXi doesn't escape ampersands in trunk
+// aliases, so a body that isn't valid XML is retried with its stray
+// ampersands escaped rather than failing the whole scrape over one alias.
+// The error of the original body is returned if that doesn't help.
+func unmarshalDump(body []byte, v interface{}) error {
+	err := newDecoder(body).Decode(v)
+	var syntaxErr *xml.SyntaxError
+	if err == nil || !errors.As(err, &syntaxErr) {
+		return err
+	}
+	repaired, n := escapeAmpersands(body)
+	if n == 0 {
+		return err
+	}
+	// Drop whatever the failed attempt unmarshalled.
+	value := reflect.ValueOf(v).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	if newDecoder(repaired).Decode(v) != nil {
+		value.Set(reflect.Zero(value.Type()))
+		return err
+	}
+	sansayXMLRepairs.Add(float64(n))
+	return nil
+}
+
+// escapeAmpersands returns body with the ampersands that don't start a
+// reference escaped, leaving CDATA sections and comments alone, and the
+// number of ampersands escaped.  body is returned as is if there are none.
+func escapeAmpersands(body []byte) ([]byte, int) {
+	var out []byte
+	n, last := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '<':
+			for _, section := range [][2]string{{"<![CDATA[", "]]>"}, {"<!--", "-->"}} {
+				if !bytes.HasPrefix(body[i:], []byte(section[0])) {
+					continue
+				}
+				end := bytes.Index(body[i+len(section[0]):], []byte(section[1]))
+				if end < 0 {
+					i = len(body)
+				} else {
+					i += len(section[0]) + end + len(section[1]) - 1
+				}
+				break
+			}
+		case '&':
+			if xmlReference.Match(body[i:]) {
+				continue
+			}
+			out = append(out, body[last:i]...)
+			out = append(out, "&amp;"...)
+			last = i + 1
+			n++
+		}
+	}
+	if n == 0 {
+		return body, 0
+	}
+	return append(out, body[last:]...), n
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestEscapeAmpersands(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+		n    int
+	}{
+		{
+			name: "Test that stray ampersands are escaped",
+			body: `<field name="alias">AT&T & Co</field>`,
+			want: `<field name="alias">AT&amp;T &amp; Co</field>`,
+			n:    2,
+		},
+		{
+			name: "Test that references are left alone",
+			body: `<field name="alias">A&amp;B &lt; &#38; &#x26;</field>`,
+			want: `<field name="alias">A&amp;B &lt; &#38; &#x26;</field>`,
+		},
+		{
+			name: "Test that unknown entities are escaped",
+			body: `<field name="alias">AT&T;</field>`,
+			want: `<field name="alias">AT&amp;T;</field>`,
+			n:    1,
+		},
+		{
+			name: "Test that CDATA sections and comments are left alone",
+			body: `<!-- a & b --><field><![CDATA[a & b]]>&</field>`,
+			want: `<!-- a & b --><field><![CDATA[a & b]]>&amp;</field>`,
+			n:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n := escapeAmpersands([]byte(tt.body))
+			if string(got) != tt.want || n != tt.n {
+				t.Errorf("Expected %q with %d escaped, received %q with %d", tt.want, tt.n, got, n)
+			}
+		})
+	}
+}
+
+func TestParseSansayUnescapedAlias(t *testing.T) {
+	body := `<mysqldump><database name="stats"><table name="XBResourceRealTimeStatList">` +
+		`<row><field name="trunkId">1</field><field name="alias">AT&T</field></row>` +
+		`<row><field name="trunkId">2</field><field name="alias">B&amp;C</field></row>` +
+		`</table></database></mysqldump>`
+	obj, err := parseSansay("stats/realtime", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := obj.(Sansay).Database.Table[0].Row
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, received %d", len(rows))
+	}
+	if got := rows[0].Fields()["alias"]; got != "AT&T" {
+		t.Errorf("Expected the alias AT&T, received %q", got)
+	}
+	if got := rows[1].Fields()["alias"]; got != "B&C" {
+		t.Errorf("Expected the alias B&C, received %q", got)
+	}
+}